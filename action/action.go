@@ -20,12 +20,17 @@
 //
 //	 Security:
 //	 - saml2:
+//	 - bearer:
 //
 //	 SecurityDefinitions:
 //	 saml2:
 //	   type: saml2
 //	   authorizationUrl: /auth/login
 //	   callbackUrl: /auth/callback
+//	 bearer:
+//	   type: apiKey
+//	   name: Authorization
+//	   in: header
 //
 // swagger:meta
 package action
@@ -36,6 +41,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
@@ -51,103 +57,180 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// App is the HTTP server. It holds the dependencies of the handlers, so that more than one App, each with its own
+// configuration, may exist at the same time.
 type App struct {
 	*echo.Echo
+	db           *sql.DB
+	emailService email.Service
 	store        sessions.Store
 	samlProvider *saml.Provider
+
+	// now returns the current time. It can be replaced for testing.
+	now func() time.Time
 }
 
+// Config holds the dependencies of an App. DB and EmailService are required. The other fields are optional.
 type Config struct {
-	DB           *sql.DB
+	DB *sql.DB
+
+	// EmailService sends email. Use app.NewEmailService to create the configured service.
 	EmailService email.Service
-	Store        sessions.Store
-}
 
-var a *App
+	// Store defaults to a cookie store using the session secret
+	Store sessions.Store
 
-var errorNotAuthenticated = errors.New("not authenticated")
+	// SAMLProvider defaults to the provider described by the SAML environment variables, if any
+	SAMLProvider *saml.Provider
+
+	// Clock defaults to time.Now
+	Clock func() time.Time
+}
 
-var emailService = email.NewFake()
+var errorNotAuthenticated = errors.New("not authenticated")
 
+// NewApp creates an App with the given dependencies and registers its middleware and routes. It panics if a required
+// dependency is missing.
 func NewApp(config *Config) *App {
-	if a == nil {
-		a = &App{
-			Echo: echo.New(),
-		}
+	if config.DB == nil {
+		panic("NewApp: Config.DB is required")
+	}
+	if config.EmailService == nil {
+		panic("NewApp: Config.EmailService is required")
+	}
+
+	a := &App{
+		Echo:         echo.New(),
+		db:           config.DB,
+		emailService: config.EmailService,
+		store:        config.Store,
+		samlProvider: config.SAMLProvider,
+		now:          config.Clock,
+	}
+	if a.store == nil {
+		a.store = newCookieStore()
+	}
+	if a.samlProvider == nil {
+		a.samlProvider = initSAML()
+	}
+	if a.now == nil {
+		a.now = time.Now
+	}
 
-		a.Binder = &Binder{}
-		a.Debug = app.Env.AppEnv == app.EnvDevelopment
-		a.HTTPErrorHandler = customHTTPErrorHandler
+	a.Binder = &Binder{}
+	a.Debug = app.Env.AppEnv == app.EnvDevelopment
+	a.HTTPErrorHandler = customHTTPErrorHandler
 
-		if config.Store != nil {
-			a.store = config.Store
-		} else {
-			a.store = newCookieStore()
-		}
-		a.Use(session.Middleware(a.store))
-
-		a.Renderer = &public.TemplRenderer{}
-
-		a.Use(requestLogger())
-
-		if app.Env.AppEnv == app.EnvDevelopment {
-			a.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
-				LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
-					// log stack dump on multiple lines
-					log.Error(err.Error() + string(stack))
-					return nil
-				},
-			}))
-		} else {
-			a.Use(middleware.Recover())
-		}
+	a.Use(session.Middleware(a.store))
 
-		a.Use(transactionMiddleware(config.DB))
-
-		switch app.Env.EmailService {
-		case "mailgun":
-			log.WithFields(log.Fields{"domain": app.Env.MailgunDomain}).Info("using Mailgun")
-			emailService = email.NewMailgun(email.MailgunConfig{
-				Domain:       app.Env.MailgunDomain,
-				PrivateKey:   app.Env.MailgunAPIKey,
-				SandboxEmail: app.Env.SandboxEmail,
-			})
-		case "ses":
-			log.WithFields(log.Fields{"region": app.Env.AWSRegion, "accessKeyID": app.Env.AWSAccessKeyID}).
-				Infof("using AWS SES")
-			var err error
-			emailService, err = email.NewSES(app.Env.SandboxEmail)
-			if err != nil {
-				log.Fatalf("Error creating SES email service: %v", err)
-			}
-		}
+	a.Renderer = &public.TemplRenderer{}
 
-		a.samlProvider = initSAML()
-		a.Use(authenticationMiddleware())
+	a.Use(middleware.RequestID())
+	a.Use(requestLogger())
 
-		a.Group("/assets").Use(middleware.StaticWithConfig(middleware.StaticConfig{
-			Root:       "assets",
-			Browse:     true,
-			Filesystem: http.FS(public.EFS()),
+	if app.Env.AppEnv == app.EnvDevelopment {
+		a.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+			LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+				// log stack dump on multiple lines
+				log.Error(err.Error() + string(stack))
+				return nil
+			},
 		}))
+	} else {
+		a.Use(middleware.Recover())
+	}
 
-		// Authentication endpoints for UI
-		a.GET("/auth/login", a.authLogin)
-		a.POST("/auth/callback", a.authCallback)
-		a.GET("/auth/logout", a.authLogout)
-		a.GET("/auth/logout-callback", a.authLogoutCallback)
-
-		// HTML endpoints for UI
-		a.GET("/", home)
-		a.PUT("/card", cardItem)
+	a.Use(transactionMiddleware(a.db))
+	a.Use(a.authenticationMiddleware())
+	a.Use(auditMiddleware())
+
+	a.Group("/assets").Use(middleware.StaticWithConfig(middleware.StaticConfig{
+		Root:       "assets",
+		Browse:     true,
+		Filesystem: http.FS(public.EFS()),
+	}))
+
+	// Authentication endpoints for UI
+	a.GET("/auth/login", a.authLogin)
+	a.POST("/auth/callback", a.authCallback)
+	a.GET("/auth/logout", a.authLogout)
+	a.GET("/auth/logout-callback", a.authLogoutCallback)
+
+	// HTML endpoints for UI
+	a.GET("/", a.home)
+	a.PUT("/card", a.cardItem)
+	a.GET("/profile", a.profile)
+	a.PUT("/profile", a.profileUpdate)
+	a.POST("/profile/email", a.profileEmailChange)
+	a.GET("/profile/email/confirm", a.profileEmailConfirm)
+	a.POST("/profile/export", a.profileDataExport)
+	a.GET("/exports/download", a.dataExportDownload)
+
+	// HTML endpoints for admin UI
+	admin := a.Group("/admin", adminMiddleware())
+	admin.GET("/users", a.adminUsers)
+	admin.GET("/users/export", a.adminUserExport)
+	admin.GET("/users/import", a.adminUserImport)
+	admin.POST("/users/import", a.adminUserImportPreview)
+	admin.POST("/users/import/apply", a.adminUserImportApply)
+	admin.GET("/users/search", a.userPickerSearch)
+	admin.GET("/users/picker", a.userPickerSelect)
+	admin.GET("/users/:id", a.adminUserRow)
+	admin.PUT("/users/:id", a.adminUserUpdate)
+	admin.GET("/users/:id/edit", a.adminUserEdit)
+	admin.PUT("/users/:id/lock", a.adminUserToggleLocked)
+	admin.PUT("/users/:id/active", a.adminUserToggleActive)
+	admin.POST("/users/:id/export", a.adminUserDataExport)
+	admin.DELETE("/users/:id", a.adminUserDelete)
+	admin.PUT("/users/:id/restore", a.adminUserRestore)
+	admin.DELETE("/users/:id/purge", a.adminUserPurge)
+	admin.GET("/audit", a.adminAudit)
+	admin.GET("/audit/export", a.adminAuditExport)
+
+	// Email template preview, for admins, or for anyone in development
+	emailTemplates := a.Group("/email-templates", devOrAdminMiddleware())
+	emailTemplates.GET("", a.emailPreview)
+	emailTemplates.GET("/:name/html", a.emailPreviewHTML)
+	emailTemplates.POST("/:name/send", a.emailPreviewSend)
+
+	// JSON endpoints for REST API
+	v1 := a.Group("/api/v1", tokenAuthMiddleware())
+	v1.GET("/users", a.apiListUsers)
+	v1.POST("/users", a.apiCreateUser)
+	v1.GET("/users/:id", a.apiGetUser)
+	v1.PUT("/users/:id", a.apiUpdateUser)
+	v1.POST("/users/:id/deactivate", a.apiDeactivateUser)
+	v1.GET("/users/employee-id/:employee_id", a.apiGetUserByEmployeeID)
+
+	// SCIM 2.0 endpoints for identity provider provisioning
+	scimV2 := a.Group(scimPathPrefix, scimAuthMiddleware())
+	scimV2.GET("/ServiceProviderConfig", a.scimServiceProviderConfig)
+	scimV2.GET("/ResourceTypes", a.scimResourceTypes)
+	scimV2.GET("/ResourceTypes/User", a.scimResourceTypeUser)
+	scimV2.GET("/Schemas", a.scimSchemas)
+	scimV2.GET("/Schemas/:id", a.scimSchema)
+	scimV2.GET("/Users", a.scimListUsers)
+	scimV2.POST("/Users", a.scimCreateUser)
+	scimV2.GET("/Users/:id", a.scimGetUser)
+	scimV2.PUT("/Users/:id", a.scimReplaceUser)
+	scimV2.PATCH("/Users/:id", a.scimPatchUser)
+	scimV2.DELETE("/Users/:id", a.scimDeleteUser)
+
+	// Developer mail inbox, showing the messages captured by the fake email service
+	if _, ok := a.emailService.(*email.FakeEmailService); ok && app.Env.AppEnv == app.EnvDevelopment {
+		dev := a.Group("/dev")
+		dev.GET("/mail", a.devMail)
+		dev.DELETE("/mail", a.devMailClear)
+		dev.GET("/mail/:id/html", a.devMailHTML)
+		dev.GET("/mail/:id/images/:cid", a.devMailImage)
+		dev.GET("/mail/:id/raw", a.devMailRaw)
+	}
 
-		// for ECS healthcheck
-		a.GET("/site/status", siteStatus)
+	// for ECS healthcheck
+	a.GET("/site/status", a.siteStatus)
 
-		routes := a.Routes()
-		for _, r := range routes {
-			log.Tracef("%s %s\n", r.Method, r.Path)
-		}
+	for _, r := range a.Routes() {
+		log.Tracef("%s %s\n", r.Method, r.Path)
 	}
 
 	return a
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
@@ -20,6 +21,7 @@ import (
 	"github.com/briskt/go-htmx-app/app"
 	"github.com/briskt/go-htmx-app/core"
 	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email"
 	"github.com/briskt/go-htmx-app/log"
 )
 
@@ -35,6 +37,7 @@ type Suite struct {
 	app     *App
 	ctx     context.Context
 	db      *sql.DB
+	email   *email.FakeEmailService
 	session *sessions.Session
 }
 
@@ -52,16 +55,17 @@ func TestSuite(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	fake := email.NewFake(email.FakeConfig{}).(*email.FakeEmailService)
 	s := &Suite{
 		app: NewApp(&Config{
 			DB:           db,
-			EmailService: emailService,
+			EmailService: fake,
 			Store:        newTestSessionStore(),
 		}),
-		ctx: context.Background(),
-		db:  db,
+		ctx:   context.Background(),
+		db:    db,
+		email: fake,
 	}
-	s.app.samlProvider = initSAML()
 	suite.Run(t, s)
 }
 
@@ -69,6 +73,11 @@ func TestSuite(t *testing.T) {
 // API calls) and as the session token (for user calls). If input is a string, it is assumed to be URL-encoded.
 // Otherwise, it will be json encoded.
 func (s *Suite) requestResponse(method, path, token string, input any) *httptest.ResponseRecorder {
+	return s.requestAppResponse(s.app, method, path, token, input)
+}
+
+// requestAppResponse is like requestResponse, but submits the request to the given App
+func (s *Suite) requestAppResponse(a *App, method, path, token string, input any) *httptest.ResponseRecorder {
 	var r io.Reader
 	var contentType string
 	if input != nil {
@@ -85,10 +94,12 @@ func (s *Suite) requestResponse(method, path, token string, input any) *httptest
 	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
 	req.Header.Set("Content-Type", contentType)
 
-	s.session.Values[AccessTokenSessionKey] = token
+	sess, err := a.store.Get(req, sessionName)
+	s.NoError(err)
+	sess.Values[AccessTokenSessionKey] = token
 
 	res := httptest.NewRecorder()
-	s.app.ServeHTTP(res, req)
+	a.ServeHTTP(res, req)
 	return res
 }
 
@@ -102,6 +113,45 @@ func (s *Suite) request(method, path, token string, input any) ([]byte, int) {
 	return body, res.Code
 }
 
+// sendQueuedEmails sends the messages waiting in the email outbox, as the email worker would
+func (s *Suite) sendQueuedEmails() {
+	_, err := core.ProcessEmailOutbox(s.ctx, s.db, s.email, time.Now())
+	s.NoError(err)
+}
+
+// TestNewApp checks that apps created with different configurations each use their own dependencies
+func (s *Suite) TestNewApp() {
+	s.createAdmin()
+
+	dates := []time.Time{
+		time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC),
+	}
+	fakes := make([]*email.FakeEmailService, len(dates))
+	apps := make([]*App, len(dates))
+	for i, date := range dates {
+		fakes[i] = email.NewFake(email.FakeConfig{}).(*email.FakeEmailService)
+		apps[i] = NewApp(&Config{
+			DB:           s.db,
+			EmailService: fakes[i],
+			Store:        newTestSessionStore(),
+			Clock:        func() time.Time { return date },
+		})
+	}
+	s.NotSame(apps[0], apps[1])
+
+	for i, a := range apps {
+		s.Same(fakes[i], a.emailService)
+
+		res := s.requestAppResponse(a, "GET", "/admin/users/export", testToken, nil)
+		s.Equal(http.StatusOK, res.Code)
+		s.Contains(res.Header().Get(echo.HeaderContentDisposition), "users-"+dates[i].Format(time.DateOnly)+".csv")
+	}
+
+	s.Panics(func() { NewApp(&Config{DB: s.db}) }, "a missing email service should not be replaced by a default")
+	s.Panics(func() { NewApp(&Config{EmailService: fakes[0]}) }, "a missing database should not be accepted")
+}
+
 // testSessionStore is a limited session store that satisfies the gorilla/sessions Store interface
 type testSessionStore struct {
 	sessions map[string]*sessions.Session
@@ -0,0 +1,355 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+const adminUsersPageSize = 25
+
+var userSortKeys = []string{
+	data.UserSortName,
+	data.UserSortUsername,
+	data.UserSortEmail,
+	data.UserSortEmployeeID,
+	data.UserSortLastLogin,
+}
+
+// adminUsers renders the admin user list. An HTMX request gets only the table, for search, sort and paging. Deleted
+// users are listed separately, when the "deleted" query parameter is "true".
+func (a *App) adminUsers(c echo.Context) error {
+	filter := data.UserFilter{
+		Search:   strings.TrimSpace(c.QueryParam("q")),
+		SortBy:   c.QueryParam("sort"),
+		SortDesc: c.QueryParam("desc") == "true",
+		Deleted:  c.QueryParam("deleted") == "true",
+		Limit:    adminUsersPageSize,
+	}
+	if !slices.Contains(userSortKeys, filter.SortBy) {
+		filter.SortBy = data.UserSortName
+	}
+	var err error
+	if filter.Attributes, err = attributeFilterFromQuery(c); err != nil {
+		return err
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	page = max(page, 1)
+	filter.Offset = (page - 1) * adminUsersPageSize
+
+	users, total, err := data.ListUsers(toCtx(c), Tx(c), filter)
+	if err != nil {
+		return err
+	}
+
+	table := app.UserTableView{
+		Users:   make([]app.UserView, len(users)),
+		Search:  filter.Search,
+		Deleted: filter.Deleted,
+		Sort: app.TableSort{
+			Key:    filter.SortBy,
+			Desc:   filter.SortDesc,
+			Target: "#user-table",
+			URL: func(key string, desc bool) string {
+				sorted := filter
+				sorted.SortBy = key
+				sorted.SortDesc = desc
+				return adminUsersURL(sorted, 1)
+			},
+		},
+		Pagination: app.Pagination{
+			Page:     page,
+			PageSize: adminUsersPageSize,
+			Total:    total,
+			Target:   "#user-table",
+			URL: func(page int) string {
+				return adminUsersURL(filter, page)
+			},
+		},
+		ExportURL: "/admin/users/export?" + adminUsersQuery(filter, 1).Encode(),
+	}
+	for i, user := range users {
+		table.Users[i] = newUserView(c, user)
+	}
+
+	if isHTMXRequest(c) {
+		return c.Render(http.StatusOK, "", view.AdminUserTable(table))
+	}
+
+	currentUser := CurrentUser(c)
+	return c.Render(http.StatusOK, "", view.AdminUsers(app.AdminUsersView{
+		AppName:       app.Env.AppName,
+		DisplayName:   currentUser.GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+		Table:         table,
+		Filters:       newAttributeFilterViews(filter.Attributes),
+	}))
+}
+
+// adminUserRow renders a single row of the admin user list
+func (a *App) adminUserRow(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserRow(newUserView(c, user)))
+}
+
+// adminUserEdit renders the inline edit form for a row of the admin user list
+func (a *App) adminUserEdit(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserEditRow(app.UserEditView{User: newUserView(c, user)}))
+}
+
+// adminUserUpdate saves the inline edit form. If the input is not valid, the form is rendered again with errors.
+func (a *App) adminUserUpdate(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	input := core.UserInput{
+		EmployeeID:  c.FormValue("employee_id"),
+		FirstName:   c.FormValue("first_name"),
+		LastName:    c.FormValue("last_name"),
+		DisplayName: c.FormValue("display_name"),
+		Username:    c.FormValue("username"),
+		Email:       c.FormValue("email"),
+		Attributes:  attributeFormValues(c, app.UserAttribute.EditableByAdmin),
+	}
+	if version, err := strconv.Atoi(c.FormValue("version")); err == nil {
+		user.Version = int32(version)
+	}
+
+	updated, err := core.UpdateUser(toCtx(c), Tx(c), user, input)
+	if fieldErrors, ok := formErrors(err); ok {
+		edit := newUserEditView(c, user, input)
+		edit.Errors = fieldErrors
+		return c.Render(http.StatusOK, "", view.AdminUserEditRow(edit))
+	}
+	if errors.Is(err, data.ErrorRowNotUpdated) {
+		saved, err := data.GetUser(toCtx(c), Tx(c), int(user.ID))
+		if err != nil {
+			return err
+		}
+		edit := newUserEditView(c, user, input)
+		edit.Conflict = newUserConflictView(saved, input)
+		return c.Render(http.StatusOK, "", view.AdminUserEditRow(edit))
+	}
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserRow(newUserView(c, updated)))
+}
+
+// newUserEditView returns the user edit form filled with the values entered
+func newUserEditView(c echo.Context, user data.User, input core.UserInput) app.UserEditView {
+	edit := app.UserEditView{User: newUserView(c, user)}
+	edit.User.EmployeeID = input.EmployeeID
+	edit.User.FirstName = input.FirstName
+	edit.User.LastName = input.LastName
+	edit.User.DisplayName = input.DisplayName
+	edit.User.Username = input.Username
+	edit.User.Email = input.Email
+	setAttributeViewValues(edit.User.Attributes, input.Attributes)
+	return edit
+}
+
+// newUserConflictView lists the fields of the user edit form whose saved values differ from the values entered
+func newUserConflictView(saved data.User, input core.UserInput) *app.UserConflictView {
+	conflict := &app.UserConflictView{Version: strconv.Itoa(int(saved.Version))}
+	for _, field := range []app.UserFieldConflictView{
+		{Label: "First name", Saved: saved.FirstName, Edited: input.FirstName},
+		{Label: "Last name", Saved: saved.LastName, Edited: input.LastName},
+		{Label: "Display name", Saved: saved.DisplayName, Edited: input.DisplayName},
+		{Label: "Username", Saved: saved.Username, Edited: input.Username},
+		{Label: "Email", Saved: saved.Email, Edited: input.Email},
+		{Label: "Employee ID", Saved: saved.EmployeeID, Edited: input.EmployeeID},
+	} {
+		if strings.TrimSpace(field.Edited) != field.Saved {
+			conflict.Changes = append(conflict.Changes, field)
+		}
+	}
+	for _, a := range app.UserAttributes {
+		edited, ok := input.Attributes[a.Name]
+		if !ok {
+			continue
+		}
+		if value, err := a.Parse(edited); err == nil && a.Format(value) == a.Format(saved.Attribute(a.Name)) {
+			continue
+		}
+		conflict.Changes = append(conflict.Changes, app.UserFieldConflictView{
+			Label:  a.Label,
+			Saved:  a.Format(saved.Attribute(a.Name)),
+			Edited: edited,
+		})
+	}
+	return conflict
+}
+
+// adminUserToggleLocked locks an unlocked user, or unlocks a locked user
+func (a *App) adminUserToggleLocked(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	user, err = core.SetUserLocked(toCtx(c), Tx(c), CurrentUser(c), user, !user.Locked)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserRow(newUserView(c, user)))
+}
+
+// adminUserToggleActive deactivates an active user, or activates an inactive user
+func (a *App) adminUserToggleActive(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	user, err = core.SetUserActive(toCtx(c), Tx(c), CurrentUser(c), user, !user.Active)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserRow(newUserView(c, user)))
+}
+
+// adminUserDelete marks a user as deleted. The empty response removes the row from the user list.
+func (a *App) adminUserDelete(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	if err = core.DeleteUser(toCtx(c), Tx(c), CurrentUser(c), user); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// adminUserRestore restores a deleted user. The empty response removes the row from the list of deleted users.
+func (a *App) adminUserRestore(c echo.Context) error {
+	user, err := getUserFromParamIncludingDeleted(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err = core.RestoreUser(toCtx(c), Tx(c), CurrentUser(c), user); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// adminUserPurge permanently removes a deleted user. The empty response removes the row from the list of deleted
+// users.
+func (a *App) adminUserPurge(c echo.Context) error {
+	user, err := getUserFromParamIncludingDeleted(c)
+	if err != nil {
+		return err
+	}
+
+	if err = core.PurgeUser(toCtx(c), Tx(c), CurrentUser(c), user); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// getUserFromParam loads the user identified by the "id" path parameter. A deleted user is not found.
+func getUserFromParam(c echo.Context) (data.User, error) {
+	return loadUserFromParam(c, false)
+}
+
+// getUserFromParamIncludingDeleted is like getUserFromParam, but also finds a deleted user
+func getUserFromParamIncludingDeleted(c echo.Context) (data.User, error) {
+	return loadUserFromParam(c, true)
+}
+
+func loadUserFromParam(c echo.Context, includeDeleted bool) (data.User, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = fmt.Errorf("invalid user ID %q: %w", c.Param("id"), err)
+		return data.User{}, api.NewAppError(err, api.ErrorUserNotFound, http.StatusNotFound)
+	}
+
+	get := data.GetUser
+	if includeDeleted {
+		get = data.GetUserIncludingDeleted
+	}
+	user, err := get(toCtx(c), Tx(c), id)
+	if err != nil {
+		return data.User{}, api.NewAppError(err, api.ErrorUserNotFound, http.StatusNotFound)
+	}
+	return user, nil
+}
+
+// newUserView converts a user record to its display form
+func newUserView(c echo.Context, user data.User) app.UserView {
+	return app.UserView{
+		ID:          strconv.Itoa(int(user.ID)),
+		EmployeeID:  user.EmployeeID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DisplayName: user.DisplayName,
+		Username:    user.Username,
+		Email:       user.Email,
+		LastLogin:   formatDate(user.LastLoginAt, CurrentUser(c)),
+		Active:      user.Active,
+		Locked:      user.Locked,
+		Admin:       user.Admin,
+		Deleted:     user.IsDeleted(),
+		Self:        user.ID == CurrentUser(c).ID,
+		Version:     strconv.Itoa(int(user.Version)),
+		Attributes:  newUserAttributeViews(user, anyAttribute, app.UserAttribute.EditableByAdmin),
+	}
+}
+
+// adminUsersURL builds the URL of a page of the admin user list
+func adminUsersURL(filter data.UserFilter, page int) string {
+	return "/admin/users?" + adminUsersQuery(filter, page).Encode()
+}
+
+// adminUsersQuery builds the query parameters of the admin user list
+func adminUsersQuery(filter data.UserFilter, page int) url.Values {
+	v := url.Values{}
+	if filter.Search != "" {
+		v.Set("q", filter.Search)
+	}
+	v.Set("sort", filter.SortBy)
+	if filter.SortDesc {
+		v.Set("desc", "true")
+	}
+	if filter.Deleted {
+		v.Set("deleted", "true")
+	}
+	for _, a := range app.UserAttributes {
+		if value, ok := filter.Attributes[a.Name]; ok {
+			v.Set(a.FieldName(), a.Format(value))
+		}
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return v
+}
+
+// isHTMXRequest returns true if the request was made by HTMX
+func isHTMXRequest(c echo.Context) bool {
+	return c.Request().Header.Get("HX-Request") == "true"
+}
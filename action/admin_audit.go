@@ -0,0 +1,183 @@
+package action
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+const adminAuditPageSize = 50
+
+var auditTargetTypes = []string{
+	core.AuditTargetUser,
+	core.AuditTargetToken,
+	core.AuditTargetDataExport,
+}
+
+// adminAudit renders the audit log, newest first. An HTMX request gets only the table, for filtering and paging.
+func (a *App) adminAudit(c echo.Context) error {
+	form := newAuditFilterView(c)
+	filter, err := auditFilterFromForm(form, CurrentUser(c))
+	if err != nil {
+		return err
+	}
+	filter.Limit = adminAuditPageSize
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	page = max(page, 1)
+	filter.Offset = (page - 1) * adminAuditPageSize
+
+	events, total, err := core.ListAuditEvents(toCtx(c), Tx(c), filter)
+	if err != nil {
+		return err
+	}
+
+	table := app.AuditTableView{
+		Events: make([]app.AuditEventView, len(events)),
+		Pagination: app.Pagination{
+			Page:     page,
+			PageSize: adminAuditPageSize,
+			Total:    total,
+			Target:   "#audit-table",
+			URL: func(page int) string {
+				return "/admin/audit?" + adminAuditQuery(form, page).Encode()
+			},
+		},
+		ExportURL: "/admin/audit/export?" + adminAuditQuery(form, 1).Encode(),
+	}
+	for i, event := range events {
+		table.Events[i] = newAuditEventView(c, event)
+	}
+
+	if isHTMXRequest(c) {
+		return c.Render(http.StatusOK, "", view.AdminAuditTable(table))
+	}
+
+	currentUser := CurrentUser(c)
+	return c.Render(http.StatusOK, "", view.AdminAudit(app.AdminAuditView{
+		AppName:       app.Env.AppName,
+		DisplayName:   currentUser.GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+		Filter:        form,
+		Actions:       core.AuditActions,
+		TargetTypes:   auditTargetTypes,
+		Table:         table,
+	}))
+}
+
+// adminAuditExport downloads all audit events matching the filter as CSV
+func (a *App) adminAuditExport(c echo.Context) error {
+	filter, err := auditFilterFromForm(newAuditFilterView(c), CurrentUser(c))
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("audit-%s.csv", a.now().Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+	return core.ExportAuditEvents(toCtx(c), Tx(c), c.Response(), filter)
+}
+
+// newAuditFilterView reads the audit log filter form from the query parameters
+func newAuditFilterView(c echo.Context) app.AuditFilterView {
+	return app.AuditFilterView{
+		Action:     c.QueryParam("action"),
+		Actor:      strings.TrimSpace(c.QueryParam("actor")),
+		TargetType: c.QueryParam("target_type"),
+		TargetID:   strings.TrimSpace(c.QueryParam("target_id")),
+		From:       c.QueryParam("from"),
+		To:         c.QueryParam("to"),
+	}
+}
+
+// auditFilterFromForm converts the audit log filter form to a data filter. The dates are whole days, inclusive, in the
+// viewer's time zone.
+func auditFilterFromForm(form app.AuditFilterView, viewer data.User) (data.AuditFilter, error) {
+	filter := data.AuditFilter{
+		Action:     form.Action,
+		Actor:      form.Actor,
+		TargetType: form.TargetType,
+		TargetID:   form.TargetID,
+	}
+
+	loc, err := time.LoadLocation(viewer.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	if filter.Since, err = parseDateParam("from", form.From, loc); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseDateParam("to", form.To, loc); err != nil {
+		return filter, err
+	}
+	if filter.Until.Valid {
+		filter.Until.Time = filter.Until.Time.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+// parseDateParam parses an optional date query parameter in the form YYYY-MM-DD, returning the start of the day
+func parseDateParam(name, value string, loc *time.Location) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		err = fmt.Errorf("invalid date %q for query parameter %q: %w", value, name, err)
+		return sql.NullTime{}, api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// adminAuditQuery builds the query parameters of the audit log
+func adminAuditQuery(form app.AuditFilterView, page int) url.Values {
+	v := url.Values{}
+	for name, value := range map[string]string{
+		"action":      form.Action,
+		"actor":       form.Actor,
+		"target_type": form.TargetType,
+		"target_id":   form.TargetID,
+		"from":        form.From,
+		"to":          form.To,
+	} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return v
+}
+
+func newAuditEventView(c echo.Context, event data.AuditEvent) app.AuditEventView {
+	eventView := app.AuditEventView{
+		Time:         app.FormatDateTime(event.CreatedAt, CurrentUser(c).TimeZone),
+		Actor:        event.ActorUsername,
+		Impersonator: event.ImpersonatorUsername,
+		Action:       event.Action,
+		Target:       event.TargetType + " " + event.TargetID,
+		IP:           event.Ip,
+		RequestID:    event.RequestID,
+	}
+	if string(event.Before) != "{}" {
+		eventView.Before = string(event.Before)
+	}
+	if string(event.After) != "{}" {
+		eventView.After = string(event.After)
+	}
+	return eventView
+}
@@ -0,0 +1,54 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+func (s *Suite) TestAdminAudit() {
+	s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+
+	_, status := s.request("PUT", fmt.Sprintf("/admin/users/%d/lock", user.ID), testToken, nil)
+	s.Equal(http.StatusOK, status)
+
+	events, total, err := data.ListAuditEvents(s.ctx, s.db, data.AuditFilter{Action: core.AuditUserLock, Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+	s.Equal("admin", events[0].ActorUsername)
+	s.Equal(core.AuditTargetUser, events[0].TargetType)
+	s.Equal(strconv.Itoa(int(user.ID)), events[0].TargetID)
+	s.JSONEq(`{"locked":false}`, string(events[0].Before))
+	s.JSONEq(`{"locked":true}`, string(events[0].After))
+	s.NotEmpty(events[0].RequestID)
+
+	body, status := s.request("GET", "/admin/audit", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Audit log")
+	s.Contains(string(body), core.AuditUserLock)
+
+	body, status = s.request("GET", "/admin/audit?action=user.unlock", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "No results")
+
+	_, status = s.request("GET", "/admin/audit?from=yesterday", testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+
+	res := s.requestResponse("GET", "/admin/audit/export?action=user.lock", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Header().Get("Content-Type"), "text/csv")
+	s.Contains(res.Body.String(), "time,actor,impersonator,action")
+	s.Contains(res.Body.String(), "admin,,user.lock,user,"+strconv.Itoa(int(user.ID)))
+}
+
+func (s *Suite) TestAdminAudit_NotAdmin() {
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	_, status := s.request("GET", "/admin/audit", testToken, nil)
+	s.Equal(http.StatusForbidden, status)
+}
@@ -0,0 +1,137 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+const maxImportFileSize = 5 << 20
+
+// adminUserImport renders the user import page
+func (a *App) adminUserImport(c echo.Context) error {
+	currentUser := CurrentUser(c)
+	return c.Render(http.StatusOK, "", view.AdminUserImport(app.UserImportView{
+		AppName:       app.Env.AppName,
+		DisplayName:   currentUser.GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+	}))
+}
+
+// adminUserImportPreview reads an uploaded CSV file and renders the changes it would make, without saving them
+func (a *App) adminUserImportPreview(c echo.Context) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return renderImportError(c, "Choose a CSV file to upload.")
+	}
+	if fileHeader.Size > maxImportFileSize {
+		return renderImportError(c, fmt.Sprintf("The file is too large. The limit is %d MB.", maxImportFileSize>>20))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	return importUsers(c, string(content), false)
+}
+
+// adminUserImportApply saves the changes of a CSV file that was previously previewed
+func (a *App) adminUserImportApply(c echo.Context) error {
+	return importUsers(c, c.FormValue("csv"), true)
+}
+
+// importUsers runs the import and renders the result. An unreadable file is reported in the page rather than as an
+// error status, so that HTMX swaps it in.
+func importUsers(c echo.Context, content string, apply bool) error {
+	result, err := core.ImportUsers(toCtx(c), Tx(c), strings.NewReader(content), apply)
+	var appErr *api.AppError
+	if errors.As(err, &appErr) && appErr.Key == api.ErrorImportInvalidFile {
+		return renderImportError(c, appErr.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.AdminUserImportPreview(newUserImportPreviewView(result, content)))
+}
+
+func renderImportError(c echo.Context, msg string) error {
+	return c.Render(http.StatusOK, "", view.AdminUserImportPreview(app.UserImportPreviewView{Error: msg}))
+}
+
+// adminUserExport downloads the users matching the search and sort of the admin user list as CSV
+func (a *App) adminUserExport(c echo.Context) error {
+	filter := data.UserFilter{
+		Search:   strings.TrimSpace(c.QueryParam("q")),
+		SortBy:   c.QueryParam("sort"),
+		SortDesc: c.QueryParam("desc") == "true",
+		Deleted:  c.QueryParam("deleted") == "true",
+	}
+	if !slices.Contains(userSortKeys, filter.SortBy) {
+		filter.SortBy = data.UserSortName
+	}
+
+	var err error
+	if filter.Attributes, err = attributeFilterFromQuery(c); err != nil {
+		return err
+	}
+	if filter.Active, err = queryParamNullBool(c, "active"); err != nil {
+		return err
+	}
+	if filter.Locked, err = queryParamNullBool(c, "locked"); err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("users-%s.csv", a.now().Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+	return core.ExportUsers(toCtx(c), Tx(c), c.Response(), filter)
+}
+
+// newUserImportPreviewView converts an import result to its display form
+func newUserImportPreviewView(result core.ImportResult, content string) app.UserImportPreviewView {
+	preview := app.UserImportPreviewView{
+		Rows:      make([]app.UserImportRowView, len(result.Rows)),
+		Created:   result.Created,
+		Updated:   result.Updated,
+		Unchanged: result.Unchanged,
+		Invalid:   result.Invalid,
+		Applied:   result.Applied,
+		CSV:       content,
+	}
+	for i, row := range result.Rows {
+		rowView := app.UserImportRowView{
+			Line:       row.Line,
+			Action:     string(row.Action),
+			EmployeeID: row.EmployeeID,
+			Username:   row.Username,
+		}
+		for _, change := range row.Changes {
+			rowView.Changes = append(rowView.Changes, app.FieldChangeView(change))
+		}
+		for _, field := range slices.Sorted(maps.Keys(row.Errors)) {
+			rowView.Errors = append(rowView.Errors, row.Errors[field])
+		}
+		preview.Rows[i] = rowView
+	}
+	return preview
+}
@@ -0,0 +1,122 @@
+package action
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/data"
+)
+
+// upload submits a file as multipart form data, with the token set as the session token
+func (s *Suite) upload(path, token, field, filename, content string) ([]byte, int) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, err := w.CreateFormFile(field, filename)
+	s.NoError(err)
+	_, err = part.Write([]byte(content))
+	s.NoError(err)
+	s.NoError(w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	s.session.Values[AccessTokenSessionKey] = token
+
+	res := httptest.NewRecorder()
+	s.app.ServeHTTP(res, req)
+	body, err := io.ReadAll(res.Body)
+	s.NoError(err)
+	return body, res.Code
+}
+
+func (s *Suite) TestAdminUserImport() {
+	s.createAdmin()
+	s.createTestUser("10001", "john_doe")
+
+	const file = "employee_id,first_name,last_name,username,email,locked\n" +
+		"10001,Jon,User 10001,john_doe,john_doe@example.com,false\n" +
+		"10002,Jane,Smith,jane_smith,jane_smith@example.com,true\n"
+
+	body, status := s.upload("/admin/users/import", testToken, "file", "users.csv", file)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "1 new")
+	s.Contains(string(body), "1 changed")
+	s.Contains(string(body), "Import 2 users")
+
+	_, err := data.FindUserByEmployeeID(s.ctx, s.db, "10002")
+	s.Error(err, "preview should not create users")
+
+	body, status = s.request("POST", "/admin/users/import/apply", testToken, "csv="+url.QueryEscape(file))
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "The import was saved")
+
+	jane, err := data.FindUserByEmployeeID(s.ctx, s.db, "10002")
+	s.NoError(err)
+	s.Equal("jane_smith", jane.Username)
+	s.True(jane.Active)
+	s.True(jane.Locked, "the locked column should be imported")
+
+	john, err := data.FindUserByEmployeeID(s.ctx, s.db, "10001")
+	s.NoError(err)
+	s.Equal("Jon", john.FirstName)
+}
+
+func (s *Suite) TestAdminUserImport_Invalid() {
+	s.createAdmin()
+	s.createTestUser("10001", "john_doe")
+
+	const file = "employee_id,username,email\n" +
+		"10002,john_doe,jane@example.com\n" +
+		"10003,ann_other,not an email\n" +
+		"10003,ann_other2,ann@example.com\n" +
+		"10004,ann_third,ANN@example.com\n" +
+		"10005,new_user,John_Doe@Example.com\n"
+
+	body, status := s.upload("/admin/users/import", testToken, "file", "users.csv", file)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "5 invalid")
+	s.Contains(string(body), "Username is already in use by employee 10001")
+	s.Contains(string(body), "Email must be a valid email address")
+	s.Contains(string(body), "Employee ID is repeated from line 3")
+	s.Contains(string(body), "Email is repeated from line 4")
+	s.Contains(string(body), "Email is already in use by employee 10001")
+
+	_, status = s.request("POST", "/admin/users/import/apply", testToken, "csv="+url.QueryEscape(file))
+	s.Equal(http.StatusOK, status)
+	_, err := data.FindUserByEmployeeID(s.ctx, s.db, "10002")
+	s.Error(err, "an import with invalid rows should not create users")
+
+	body, status = s.upload("/admin/users/import", testToken, "file", "users.csv", "employee_id,email\n1,a@b.c\n")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "missing the &#34;username&#34; column")
+}
+
+func (s *Suite) TestAdminUserExport() {
+	s.createAdmin()
+	s.createTestUser("10001", "john_doe")
+	s.createTestUser("10002", "jane_smith")
+
+	res := s.requestResponse("GET", "/admin/users/export?q=smith", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Header().Get(echo.HeaderContentDisposition), "attachment")
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	s.NoError(err)
+	s.Len(records, 2)
+	s.Equal("employee_id", records[0][0])
+	s.Equal("10002", records[1][0])
+	s.Equal("jane_smith", records[1][4])
+
+	res = s.requestResponse("GET", "/admin/users/export?sort=username&desc=true", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	s.Len(lines, 4)
+	s.True(strings.HasPrefix(lines[1], "10001,"))
+}
@@ -0,0 +1,236 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/briskt/go-htmx-app/data"
+)
+
+// createAdmin creates a user with the admin flag set and saves testToken as its access token
+func (s *Suite) createAdmin() data.User {
+	admin, err := data.CreateUser(s.ctx, s.db, data.UserCreateInput{
+		EmployeeID: "90001",
+		Username:   "admin",
+		Email:      "admin@example.com",
+	})
+	s.NoError(err)
+	admin.Admin = true
+	s.NoError(admin.Update(s.ctx, s.db))
+	saveToken(s.db, int(admin.ID), testToken)
+	return admin
+}
+
+func (s *Suite) createTestUser(employeeID, username string) data.User {
+	user, err := data.CreateUser(s.ctx, s.db, data.UserCreateInput{
+		EmployeeID: employeeID,
+		FirstName:  "Test",
+		LastName:   "User " + employeeID,
+		Username:   username,
+		Email:      username + "@example.com",
+	})
+	s.NoError(err)
+	return user
+}
+
+func (s *Suite) TestAdminUsers_NotAdmin() {
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	_, status := s.request("GET", "/admin/users", testToken, nil)
+	s.Equal(http.StatusForbidden, status)
+}
+
+func (s *Suite) TestAdminUsers() {
+	s.createAdmin()
+	s.createTestUser("10001", "john_doe")
+	s.createTestUser("10002", "jane_smith")
+
+	body, status := s.request("GET", "/admin/users", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "john_doe@example.com")
+	s.Contains(string(body), "jane_smith@example.com")
+
+	body, status = s.request("GET", "/admin/users?q=SMITH", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.NotContains(string(body), "john_doe@example.com")
+	s.Contains(string(body), "jane_smith@example.com")
+
+	body, status = s.request("GET", "/admin/users?q=10001", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "john_doe@example.com")
+	s.NotContains(string(body), "jane_smith@example.com")
+}
+
+func (s *Suite) TestAdminUserUpdate() {
+	s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+	path := fmt.Sprintf("/admin/users/%d", user.ID)
+
+	body, status := s.request("PUT", path, testToken,
+		"first_name=Jon&last_name=Doe&display_name=&username=jon_doe&email=invalid&employee_id=10001")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Email must be a valid email address")
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("john_doe", got.Username)
+
+	body, status = s.request("PUT", path, testToken,
+		"first_name=Jon&last_name=Doe&display_name=&username=jon_doe&email=jon_doe@example.com&employee_id=10001")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "jon_doe@example.com")
+
+	got, err = data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("jon_doe", got.Username)
+	s.Equal("Jon", got.FirstName)
+
+	_, status = s.request("PUT", "/admin/users/0", testToken, "username=x")
+	s.Equal(http.StatusNotFound, status)
+}
+
+func (s *Suite) TestAdminUserToggles() {
+	admin := s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+
+	body, status := s.request("PUT", fmt.Sprintf("/admin/users/%d/lock", user.ID), testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Unlock")
+
+	body, status = s.request("PUT", fmt.Sprintf("/admin/users/%d/active", user.ID), testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Activate")
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.True(got.Locked)
+	s.False(got.Active)
+
+	_, status = s.request("PUT", fmt.Sprintf("/admin/users/%d/lock", admin.ID), testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+}
+
+func (s *Suite) TestAdminUserDeleteRestorePurge() {
+	admin := s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+	path := fmt.Sprintf("/admin/users/%d", user.ID)
+
+	_, status := s.request("PUT", path+"/restore", testToken, nil)
+	s.Equal(http.StatusBadRequest, status, "user is not deleted")
+
+	_, status = s.request("DELETE", path+"/purge", testToken, nil)
+	s.Equal(http.StatusBadRequest, status, "user must be deleted before it is purged")
+
+	_, status = s.request("DELETE", path, testToken, nil)
+	s.Equal(http.StatusOK, status)
+
+	_, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.Error(err)
+
+	body, status := s.request("GET", "/admin/users", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.NotContains(string(body), "john_doe@example.com")
+
+	body, status = s.request("GET", "/admin/users?deleted=true", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "john_doe@example.com")
+	s.Contains(string(body), "Restore")
+
+	_, status = s.request("PUT", path+"/restore", testToken, nil)
+	s.Equal(http.StatusOK, status)
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.False(got.IsDeleted())
+
+	_, status = s.request("DELETE", path, testToken, nil)
+	s.Equal(http.StatusOK, status)
+	_, status = s.request("DELETE", path+"/purge", testToken, nil)
+	s.Equal(http.StatusOK, status)
+
+	_, err = data.GetUserIncludingDeleted(s.ctx, s.db, int(user.ID))
+	s.Error(err)
+
+	_, status = s.request("DELETE", fmt.Sprintf("/admin/users/%d", admin.ID), testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+}
+
+func (s *Suite) TestAdminUserUpdate_Duplicate() {
+	s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+	s.createTestUser("10002", "jane_doe")
+
+	body, status := s.request("PUT", fmt.Sprintf("/admin/users/%d", user.ID), testToken,
+		"employee_id=10001&username=john_doe&email=Jane_Doe@example.com")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "This email is already in use by another user")
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("john_doe@example.com", got.Email)
+}
+
+func (s *Suite) TestAdminUserUpdate_Conflict() {
+	s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+	path := fmt.Sprintf("/admin/users/%d", user.ID)
+	form := "first_name=Jon&last_name=Doe&display_name=&username=john_doe&email=john_doe@example.com&employee_id=10001"
+
+	body, status := s.request("GET", path+"/edit", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), fmt.Sprintf(`name="version" value="%d"`, user.Version))
+
+	user.LastName = "Smith"
+	s.NoError(user.Update(s.ctx, s.db))
+
+	body, status = s.request("PUT", path, testToken, fmt.Sprintf("%s&version=%d", form, user.Version))
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "This user was changed by someone else")
+	s.Contains(string(body), "Smith")
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Smith", got.LastName)
+	s.NotEqual("Jon", got.FirstName)
+
+	body, status = s.request("PUT", path, testToken, fmt.Sprintf("%s&version=%d", form, got.Version))
+	s.Equal(http.StatusOK, status)
+	s.NotContains(string(body), "This user was changed by someone else")
+
+	got, err = data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Jon", got.FirstName)
+	s.Equal("Doe", got.LastName)
+}
+
+func (s *Suite) TestAdminUserAttributes() {
+	s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+	s.createTestUser("10002", "jane_doe")
+	path := fmt.Sprintf("/admin/users/%d", user.ID)
+	form := "first_name=Test&last_name=User&username=john_doe&email=john_doe@example.com&employee_id=10001"
+
+	body, status := s.request("GET", path+"/edit", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), `name="attribute_cost_center"`)
+	s.Contains(string(body), "Provided by the identity provider at login", "office is SAML-sourced")
+
+	body, status = s.request("PUT", path, testToken, form+"&attribute_cost_center="+strings.Repeat("9", 21))
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Cost center must be at most 20 characters")
+
+	_, status = s.request("PUT", path, testToken, form+"&attribute_cost_center=CC-100&attribute_office=Lima")
+	s.Equal(http.StatusOK, status)
+
+	got, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("CC-100", got.Attribute("cost_center"))
+	s.Nil(got.Attribute("office"), "a SAML-sourced attribute cannot be changed by an admin")
+
+	body, status = s.request("GET", "/admin/users?attribute_cost_center=CC-100", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "john_doe@example.com")
+	s.NotContains(string(body), "jane_doe@example.com")
+}
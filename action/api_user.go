@@ -0,0 +1,309 @@
+package action
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 200
+)
+
+// swagger:operation GET /api/v1/users Users ListUsers
+// ListUsers
+//
+// List users matching a filter, one page at a time
+// ---
+//
+//	parameters:
+//	- name: q
+//	  in: query
+//	  description: search text matched against names, username, email and employee ID
+//	  type: string
+//	- name: active
+//	  in: query
+//	  type: boolean
+//	- name: locked
+//	  in: query
+//	  type: boolean
+//	- name: sort
+//	  in: query
+//	  type: string
+//	  enum: [name, username, email, employee_id, last_login]
+//	- name: desc
+//	  in: query
+//	  type: boolean
+//	- name: limit
+//	  in: query
+//	  type: integer
+//	- name: offset
+//	  in: query
+//	  type: integer
+//	responses:
+//	  '200':
+//	    description: a page of users
+//	    schema:
+//	      "$ref": "#/definitions/UserList"
+func (a *App) apiListUsers(c echo.Context) error {
+	filter := data.UserFilter{
+		Search: c.QueryParam("q"),
+		SortBy: c.QueryParam("sort"),
+	}
+	if filter.SortBy != "" && !slices.Contains(userSortKeys, filter.SortBy) {
+		err := fmt.Errorf("invalid sort %q", filter.SortBy)
+		return api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+
+	var err error
+	if filter.Active, err = queryParamNullBool(c, "active"); err != nil {
+		return err
+	}
+	if filter.Locked, err = queryParamNullBool(c, "locked"); err != nil {
+		return err
+	}
+	desc, err := queryParamNullBool(c, "desc")
+	if err != nil {
+		return err
+	}
+	filter.SortDesc = desc.Bool
+	if filter.Limit, err = queryParamInt(c, "limit", apiDefaultLimit, 1, apiMaxLimit); err != nil {
+		return err
+	}
+	if filter.Offset, err = queryParamInt(c, "offset", 0, 0, -1); err != nil {
+		return err
+	}
+
+	users, total, err := data.ListUsers(toCtx(c), Tx(c), filter)
+	if err != nil {
+		return err
+	}
+
+	list := api.UserList{
+		Users:  make([]api.User, len(users)),
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	for i, user := range users {
+		list.Users[i] = newAPIUser(user)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// swagger:operation GET /api/v1/users/{id} Users GetUser
+// GetUser
+//
+// Get a user by ID
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: integer
+//	responses:
+//	  '200':
+//	    description: the user
+//	    schema:
+//	      "$ref": "#/definitions/User"
+func (a *App) apiGetUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+// swagger:operation GET /api/v1/users/employee-id/{employee_id} Users GetUserByEmployeeID
+// GetUserByEmployeeID
+//
+// Get a user by employee ID
+// ---
+//
+//	parameters:
+//	- name: employee_id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '200':
+//	    description: the user
+//	    schema:
+//	      "$ref": "#/definitions/User"
+func (a *App) apiGetUserByEmployeeID(c echo.Context) error {
+	user, err := data.FindUserByEmployeeID(toCtx(c), Tx(c), c.Param("employee_id"))
+	if err != nil {
+		return api.NewAppError(err, api.ErrorUserNotFound, http.StatusNotFound)
+	}
+	return c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+// swagger:operation POST /api/v1/users Users CreateUser
+// CreateUser
+//
+// Create a user
+// ---
+//
+//	parameters:
+//	- name: input
+//	  in: body
+//	  required: true
+//	  schema:
+//	    "$ref": "#/definitions/UserInput"
+//	responses:
+//	  '201':
+//	    description: the new user
+//	    schema:
+//	      "$ref": "#/definitions/User"
+func (a *App) apiCreateUser(c echo.Context) error {
+	var input api.UserInput
+	if err := c.Bind(&input); err != nil {
+		return api.NewAppError(err, api.ErrorInvalidRequestBody, http.StatusBadRequest)
+	}
+
+	user, err := core.CreateUser(toCtx(c), Tx(c), newCoreUserInput(input))
+	if err != nil {
+		return newValidationError(err)
+	}
+	return c.JSON(http.StatusCreated, newAPIUser(user))
+}
+
+// swagger:operation PUT /api/v1/users/{id} Users UpdateUser
+// UpdateUser
+//
+// Replace the editable fields of a user
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: integer
+//	- name: input
+//	  in: body
+//	  required: true
+//	  schema:
+//	    "$ref": "#/definitions/UserInput"
+//	responses:
+//	  '200':
+//	    description: the updated user
+//	    schema:
+//	      "$ref": "#/definitions/User"
+func (a *App) apiUpdateUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	var input api.UserInput
+	if err = c.Bind(&input); err != nil {
+		return api.NewAppError(err, api.ErrorInvalidRequestBody, http.StatusBadRequest)
+	}
+
+	user, err = core.UpdateUser(toCtx(c), Tx(c), user, newCoreUserInput(input))
+	if err != nil {
+		return newValidationError(err)
+	}
+	return c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+// swagger:operation POST /api/v1/users/{id}/deactivate Users DeactivateUser
+// DeactivateUser
+//
+// Deactivate a user
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: integer
+//	responses:
+//	  '200':
+//	    description: the deactivated user
+//	    schema:
+//	      "$ref": "#/definitions/User"
+func (a *App) apiDeactivateUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	user, err = core.SetUserActive(toCtx(c), Tx(c), CurrentUser(c), user, false)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+// newAPIUser converts a user record to its REST API form
+func newAPIUser(user data.User) api.User {
+	return api.User{
+		ID:          int(user.ID),
+		EmployeeID:  user.EmployeeID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DisplayName: user.DisplayName,
+		Username:    user.Username,
+		Email:       user.Email,
+		Active:      user.Active,
+		Locked:      user.Locked,
+		LastLoginAt: user.LastLoginAt,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
+
+func newCoreUserInput(input api.UserInput) core.UserInput {
+	return core.UserInput{
+		EmployeeID:  input.EmployeeID,
+		FirstName:   input.FirstName,
+		LastName:    input.LastName,
+		DisplayName: input.DisplayName,
+		Username:    input.Username,
+		Email:       input.Email,
+	}
+}
+
+// queryParamNullBool parses an optional boolean query parameter. If the parameter is absent, the result is not Valid.
+func queryParamNullBool(c echo.Context, name string) (sql.NullBool, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return sql.NullBool{}, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		err = fmt.Errorf("invalid boolean %q for query parameter %q: %w", v, name, err)
+		return sql.NullBool{}, api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+	return sql.NullBool{Bool: b, Valid: true}, nil
+}
+
+// queryParamInt parses an optional integer query parameter, returning def if it is absent. If maximum is negative, the
+// value has no upper limit.
+func queryParamInt(c echo.Context, name string, def, minimum, maximum int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err == nil && (i < minimum || (maximum >= 0 && i > maximum)) {
+		err = errors.New("out of range")
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid integer %q for query parameter %q: %w", v, name, err)
+		return 0, api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+	return i, nil
+}
@@ -0,0 +1,133 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+const testAPIKey = "test-api-key-0123456789"
+
+func (s *Suite) useAPIKey() {
+	keys := app.Env.APIAccessKeys
+	app.Env.APIAccessKeys = []string{testAPIKey}
+	s.T().Cleanup(func() { app.Env.APIAccessKeys = keys })
+}
+
+func (s *Suite) TestAPIListUsers() {
+	s.useAPIKey()
+	s.createTestUser("10001", "john_doe")
+	jane := s.createTestUser("10002", "jane_smith")
+	jane.Active = false
+	s.NoError(jane.Update(s.ctx, s.db))
+
+	_, status := s.request("GET", "/api/v1/users", "invalid", nil)
+	s.Equal(http.StatusUnauthorized, status)
+
+	body, status := s.request("GET", "/api/v1/users?sort=username", testAPIKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	var list api.UserList
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(2, list.Total)
+	s.Equal("jane_smith", list.Users[0].Username)
+
+	body, status = s.request("GET", "/api/v1/users?active=true&limit=1", testAPIKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(1, list.Total)
+	s.Equal(1, list.Limit)
+	s.Equal("john_doe", list.Users[0].Username)
+
+	_, status = s.request("GET", "/api/v1/users?limit=1000", testAPIKey, nil)
+	s.Equal(http.StatusBadRequest, status)
+
+	_, status = s.request("GET", "/api/v1/users?active=maybe", testAPIKey, nil)
+	s.Equal(http.StatusBadRequest, status)
+}
+
+func (s *Suite) TestAPIGetUser() {
+	s.useAPIKey()
+	user := s.createTestUser("10001", "john_doe")
+
+	body, status := s.request("GET", fmt.Sprintf("/api/v1/users/%d", user.ID), testAPIKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	var got api.User
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal("john_doe", got.Username)
+
+	body, status = s.request("GET", "/api/v1/users/employee-id/10001", testAPIKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal(int(user.ID), got.ID)
+
+	_, status = s.request("GET", "/api/v1/users/employee-id/99999", testAPIKey, nil)
+	s.Equal(http.StatusNotFound, status)
+}
+
+func (s *Suite) TestAPICreateUser() {
+	s.useAPIKey()
+
+	input := api.UserInput{
+		EmployeeID: "10003",
+		FirstName:  "Ann",
+		LastName:   "Other",
+		Username:   "ann_other",
+		Email:      "ann_other@example.com",
+	}
+	body, status := s.request("POST", "/api/v1/users", testAPIKey, input)
+	s.Equal(http.StatusCreated, status, string(body))
+	var got api.User
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal("ann_other", got.Username)
+	s.True(got.Active)
+
+	input.Email = "not an email"
+	body, status = s.request("POST", "/api/v1/users", testAPIKey, input)
+	s.Equal(http.StatusBadRequest, status)
+	var appErr api.AppError
+	s.NoError(json.Unmarshal(body, &appErr))
+	s.Contains(appErr.Fields, "email")
+
+	_, status = s.request("POST", "/api/v1/users", testAPIKey, map[string]string{"unknown": "field"})
+	s.Equal(http.StatusBadRequest, status)
+
+	input.EmployeeID = "10004"
+	input.Username = "ann_other2"
+	input.Email = "Ann_Other@Example.com"
+	body, status = s.request("POST", "/api/v1/users", testAPIKey, input)
+	s.Equal(http.StatusConflict, status)
+	appErr = api.AppError{}
+	s.NoError(json.Unmarshal(body, &appErr))
+	s.Contains(appErr.Fields, "email")
+}
+
+func (s *Suite) TestAPIUpdateAndDeactivateUser() {
+	s.useAPIKey()
+	user := s.createTestUser("10001", "john_doe")
+
+	input := api.UserInput{
+		EmployeeID: "10001",
+		FirstName:  "Jon",
+		LastName:   "Doe",
+		Username:   "jon_doe",
+		Email:      "jon_doe@example.com",
+	}
+	body, status := s.request("PUT", fmt.Sprintf("/api/v1/users/%d", user.ID), testAPIKey, input)
+	s.Equal(http.StatusOK, status, string(body))
+	var got api.User
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal("jon_doe", got.Username)
+
+	body, status = s.request("POST", fmt.Sprintf("/api/v1/users/%d/deactivate", user.ID), testAPIKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &got))
+	s.False(got.Active)
+
+	dbUser, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.False(dbUser.Active)
+}
@@ -65,7 +65,7 @@ func (a *App) authCallback(c echo.Context) error {
 		return api.NewAppError(err, api.ErrorClearingSession, http.StatusInternalServerError)
 	}
 
-	staffID, err := a.samlProvider.GetUser(c)
+	staffID, samlAttributes, err := a.samlProvider.GetUser(c)
 	if err != nil {
 		err = fmt.Errorf("auth response error: %w", err)
 		return api.NewAppError(err, api.ErrorAuthProvidersCallback, http.StatusInternalServerError)
@@ -76,10 +76,16 @@ func (a *App) authCallback(c echo.Context) error {
 		return err
 	}
 
-	user, err := core.FindUserByToken(toCtx(c), Tx(c), token)
+	user, err := core.FindUserByToken(toCtx(c), Tx(c), token, a.now())
 	if err != nil {
 		return err
 	}
+	if err = core.RecordLogin(toCtx(c), Tx(c), user); err != nil {
+		return err
+	}
+	if user, err = core.SyncSAMLAttributes(toCtx(c), Tx(c), user, samlAttributes); err != nil {
+		return err
+	}
 
 	// set person on log context
 	log.SetUser(toCtx(c), user.EmployeeID, email.MaskString(user.GetDisplayName()), email.MaskEmail(user.GetEmail()))
@@ -103,6 +109,12 @@ func (a *App) authCallback(c echo.Context) error {
 //	  '302':
 //	    description: redirect to UI
 func (a *App) authLogout(c echo.Context) error {
+	if token, err := sessionGetString(c, AccessTokenSessionKey); err == nil {
+		if err = core.RecordLogout(toCtx(c), Tx(c), token, a.now()); err != nil {
+			return err
+		}
+	}
+
 	err := clearSession(c)
 	if err != nil {
 		return api.NewAppError(err, api.ErrorClearingSession, http.StatusInternalServerError)
@@ -0,0 +1,64 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+// profileDataExport queues an export of the current user's data. The download link is sent by email.
+func (a *App) profileDataExport(c echo.Context) error {
+	user := CurrentUser(c)
+	if user.ID == 0 {
+		err := errors.New("no authenticated user for data export")
+		return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+	}
+
+	if _, err := core.RequestDataExport(toCtx(c), Tx(c), user, user); err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.DataExportRequested(user.GetEmail()))
+}
+
+// adminUserDataExport queues an export of a user's data. The download link is sent to the admin.
+func (a *App) adminUserDataExport(c echo.Context) error {
+	user, err := getUserFromParamIncludingDeleted(c)
+	if err != nil {
+		return err
+	}
+
+	admin := CurrentUser(c)
+	if _, err = core.RequestDataExport(toCtx(c), Tx(c), admin, user); err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.DataExportRequested(admin.GetEmail()))
+}
+
+// dataExportDownload responds with the archive of a data export identified by the token in the download link
+func (a *App) dataExportDownload(c echo.Context) error {
+	requester := CurrentUser(c)
+	if requester.ID == 0 {
+		return c.Redirect(http.StatusFound, "/auth/login")
+	}
+
+	export, err := core.DownloadDataExport(toCtx(c), Tx(c), requester, c.QueryParam("token"), a.now())
+	if err != nil {
+		return err
+	}
+
+	user, err := data.GetUserIncludingDeleted(toCtx(c), Tx(c), int(export.UserID))
+	if err != nil {
+		return api.NewAppError(err, api.ErrorUserNotFound, http.StatusNotFound)
+	}
+
+	filename := core.DataExportFilename(user, export)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, "application/zip", export.Archive)
+}
@@ -0,0 +1,75 @@
+package action
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+func (s *Suite) TestDataExport() {
+	fake := s.email
+	fake.DeleteSentMessages()
+
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	response, status := s.request("POST", "/profile/export", testToken, "")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Export requested")
+
+	tx, err := s.db.Begin()
+	s.NoError(err)
+	n, err := core.ProcessDataExports(s.ctx, tx)
+	s.NoError(err)
+	s.NoError(tx.Commit())
+	s.Equal(1, n)
+	s.sendQueuedEmails()
+	s.Equal(1, fake.GetNumberOfMessagesSent())
+	s.Contains(fake.GetLastToEmail(), "john_doe@example.com")
+
+	// the token in the message is not known here, so give the export a known token
+	var export data.DataExport
+	s.NoError(s.db.QueryRow("SELECT id, archive FROM data_exports").Scan(&export.ID, &export.Archive))
+	s.NoError(export.MarkReady(s.ctx, s.db, export.Archive, core.HashAccessToken("known"), time.Now().Add(time.Hour)))
+
+	_, status = s.request("GET", "/exports/download?token=wrong", testToken, nil)
+	s.Equal(http.StatusNotFound, status)
+
+	res := s.requestResponse("GET", "/exports/download?token=known", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Header().Get("Content-Disposition"), "john_doe-data-")
+
+	body := res.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	s.NoError(err)
+	s.Len(archive.File, 3)
+	f, err := archive.Open("profile.json")
+	s.NoError(err)
+	profile, err := io.ReadAll(f)
+	s.NoError(err)
+	s.Contains(string(profile), `"username": "john_doe"`)
+
+	other := s.createTestUser("10002", "jane_doe")
+	saveToken(s.db, int(other.ID), "other-token")
+	_, status = s.request("GET", "/exports/download?token=known", "other-token", nil)
+	s.Equal(http.StatusNotFound, status, "only the requester may download the export")
+}
+
+func (s *Suite) TestAdminUserDataExport() {
+	admin := s.createAdmin()
+	user := s.createTestUser("10001", "john_doe")
+
+	response, status := s.request("POST", fmt.Sprintf("/admin/users/%d/export", user.ID), testToken, "")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "A download link will be sent to admin@example.com")
+
+	var requestedBy int32
+	s.NoError(s.db.QueryRow("SELECT requested_by FROM data_exports WHERE user_id = $1", user.ID).Scan(&requestedBy))
+	s.Equal(admin.ID, requestedBy)
+}
@@ -0,0 +1,152 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/email"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+// devMail shows the developer mail inbox, with the message given by the "id" query parameter, or the newest message
+func (a *App) devMail(c echo.Context) error {
+	selectedID, _ := strconv.Atoi(c.QueryParam("id"))
+	inbox, err := a.newDevMailInboxView(c, selectedID)
+	if err != nil {
+		return err
+	}
+
+	if isHTMXRequest(c) {
+		return c.Render(http.StatusOK, "", view.DevMailInbox(inbox))
+	}
+
+	return c.Render(http.StatusOK, "", view.DevMail(app.DevMailView{
+		AppName:       app.Env.AppName,
+		DisplayName:   CurrentUser(c).GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+		Inbox:         inbox,
+	}))
+}
+
+// devMailClear deletes all captured messages and renders the empty inbox
+func (a *App) devMailClear(c echo.Context) error {
+	a.fakeEmailService().DeleteSentMessages()
+	return c.Render(http.StatusOK, "", view.DevMailInbox(app.DevMailInboxView{}))
+}
+
+// devMailHTML serves the HTML part of a captured message, for showing in a sandboxed frame. The inline images are
+// linked to devMailImage.
+func (a *App) devMailHTML(c echo.Context) error {
+	msg, parts, err := a.findDevMailMessage(c)
+	if err != nil {
+		return err
+	}
+	html := strings.ReplaceAll(parts.HTML, `src="cid:`, `src="`+devMailURL(msg.ID)+`/images/`)
+	return c.HTML(http.StatusOK, html)
+}
+
+// devMailImage serves an inline image of a captured message
+func (a *App) devMailImage(c echo.Context) error {
+	_, parts, err := a.findDevMailMessage(c)
+	if err != nil {
+		return err
+	}
+	image, ok := parts.Images[c.Param("cid")]
+	if !ok {
+		err = fmt.Errorf("message has no image %q", c.Param("cid"))
+		return api.NewAppError(err, api.ErrorNotFound, http.StatusNotFound)
+	}
+	return c.Blob(http.StatusOK, image.ContentType, image.Data)
+}
+
+// devMailRaw downloads a captured message as a MIME (.eml) file
+func (a *App) devMailRaw(c echo.Context) error {
+	msg, _, err := a.findDevMailMessage(c)
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("message-%d.eml", msg.ID)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, "message/rfc822", []byte(msg.Body))
+}
+
+// fakeEmailService returns the App's email service. The developer mail routes are only registered if it is fake.
+func (a *App) fakeEmailService() *email.FakeEmailService {
+	return a.emailService.(*email.FakeEmailService)
+}
+
+// findDevMailMessage returns the captured message given by the "id" path parameter, and its decoded parts
+func (a *App) findDevMailMessage(c echo.Context) (email.FakeMessage, email.MIMEParts, error) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	msg, ok := a.fakeEmailService().FindSentMessage(id)
+	if !ok {
+		err := fmt.Errorf("no captured message with ID %q", c.Param("id"))
+		return msg, email.MIMEParts{}, api.NewAppError(err, api.ErrorNotFound, http.StatusNotFound)
+	}
+	parts, err := msg.Parts()
+	if err != nil {
+		return msg, parts, api.NewAppError(err, api.ErrorInternal, http.StatusInternalServerError)
+	}
+	return msg, parts, nil
+}
+
+func (a *App) newDevMailInboxView(c echo.Context, selectedID int) (app.DevMailInboxView, error) {
+	messages := a.fakeEmailService().GetSentMessages()
+	slices.Reverse(messages)
+
+	var inbox app.DevMailInboxView
+	if len(messages) == 0 {
+		return inbox, nil
+	}
+
+	selected := messages[0]
+	inbox.Messages = make([]app.DevMailMessageView, len(messages))
+	for i, msg := range messages {
+		inbox.Messages[i] = newDevMailMessageView(c, msg)
+		if msg.ID == selectedID {
+			selected = msg
+		}
+	}
+
+	parts, err := selected.Parts()
+	if err != nil {
+		return inbox, api.NewAppError(err, api.ErrorInternal, http.StatusInternalServerError)
+	}
+	selectedView := newDevMailMessageView(c, selected)
+	selectedView.Text = parts.Text
+	for cid := range parts.Images {
+		selectedView.Images = append(selectedView.Images, app.DevMailImageView{
+			ContentID: cid,
+			URL:       devMailURL(selected.ID) + "/images/" + cid,
+		})
+	}
+	slices.SortFunc(selectedView.Images, func(x, y app.DevMailImageView) int {
+		return strings.Compare(x.ContentID, y.ContentID)
+	})
+	inbox.Selected = &selectedView
+	return inbox, nil
+}
+
+func newDevMailMessageView(c echo.Context, msg email.FakeMessage) app.DevMailMessageView {
+	return app.DevMailMessageView{
+		ID:      strconv.Itoa(msg.ID),
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		SentAt:  app.FormatDateTime(msg.SentAt, CurrentUser(c).TimeZone),
+		HTMLURL: devMailURL(msg.ID) + "/html",
+		RawURL:  devMailURL(msg.ID) + "/raw",
+	}
+}
+
+func devMailURL(id int) string {
+	return "/dev/mail/" + strconv.Itoa(id)
+}
@@ -0,0 +1,75 @@
+package action
+
+import (
+	"net/http"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/email"
+	"github.com/briskt/go-htmx-app/email/message"
+)
+
+func (s *Suite) TestDevMail() {
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	_, status := s.request("GET", "/dev/mail", testToken, nil)
+	s.Equal(http.StatusNotFound, status, "the inbox should only exist in development")
+
+	appEnv := app.Env.AppEnv
+	app.Env.AppEnv = app.EnvDevelopment
+	defer func() { app.Env.AppEnv = appEnv }()
+
+	fake := email.NewFake(email.FakeConfig{}).(*email.FakeEmailService)
+	dev := NewApp(&Config{DB: s.db, EmailService: fake, Store: newTestSessionStore()})
+
+	res := s.requestAppResponse(dev, "GET", "/dev/mail", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Body.String(), "No messages")
+
+	for _, subject := range []string{"first subject", "second subject"} {
+		_, err := fake.Send(s.ctx, message.NewRendered(
+			message.NewAddress("App", "no_reply@example.com"),
+			message.NewAddress("John Doe", "john_doe@example.com"),
+			subject,
+			`<p>Hello John</p><img src="cid:logo">`,
+			map[string]string{"logo": "assets/img/logo.png"},
+		))
+		s.NoError(err)
+	}
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	body := res.Body.String()
+	s.Contains(body, "first subject")
+	s.Contains(body, "second subject")
+	s.Contains(body, "Hello John")
+	s.Contains(body, `src="/dev/mail/2/html"`, "the newest message should be selected")
+	s.Contains(body, "/dev/mail/2/images/logo")
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail?id=1", testToken, nil)
+	s.Contains(res.Body.String(), `src="/dev/mail/1/html"`)
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail/1/html", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Body.String(), `<img src="/dev/mail/1/images/logo">`)
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail/1/images/logo", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Equal("image/png", res.Header().Get("Content-Type"))
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail/1/images/missing", testToken, nil)
+	s.Equal(http.StatusNotFound, res.Code)
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail/1/raw", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Header().Get("Content-Disposition"), "message-1.eml")
+	s.Contains(res.Body.String(), "Subject: first subject")
+
+	res = s.requestAppResponse(dev, "DELETE", "/dev/mail", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Contains(res.Body.String(), "No messages")
+	s.Equal(0, fake.GetNumberOfMessagesSent())
+
+	res = s.requestAppResponse(dev, "GET", "/dev/mail/1/raw", testToken, nil)
+	s.Equal(http.StatusNotFound, res.Code)
+}
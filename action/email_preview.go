@@ -0,0 +1,125 @@
+package action
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email"
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+// emailPreview shows a message template, given by the "template" query parameter, rendered with its sample fields. The
+// first template is shown by default.
+func (a *App) emailPreview(c echo.Context) error {
+	templates := message.Templates()
+	name := c.QueryParam("template")
+	if name == "" {
+		name = templates[0]
+	}
+	if !slices.Contains(templates, name) {
+		err := fmt.Errorf("email template %q not found", name)
+		return api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+
+	preview, err := newEmailTemplatePreviewView(CurrentUser(c), name)
+	if err != nil {
+		return err
+	}
+
+	if isHTMXRequest(c) {
+		return c.Render(http.StatusOK, "", view.EmailTemplatePreview(preview))
+	}
+
+	return c.Render(http.StatusOK, "", view.EmailPreview(app.EmailPreviewView{
+		AppName:       app.Env.AppName,
+		DisplayName:   CurrentUser(c).GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+		Templates:     templates,
+		Preview:       preview,
+	}))
+}
+
+// emailPreviewHTML serves the HTML part of a message template rendered with its sample fields, for showing in a frame.
+// The inline images are linked to the static assets they are read from.
+func (a *App) emailPreviewHTML(c echo.Context) error {
+	msg, err := previewEmailFromParam(c)
+	if err != nil {
+		return err
+	}
+	html := msg.Body()
+	for cid, filename := range msg.Images() {
+		html = strings.ReplaceAll(html, `src="cid:`+cid+`"`, `src="/`+filename+`"`)
+	}
+	return c.HTML(http.StatusOK, html)
+}
+
+// emailPreviewSend sends a message template rendered with its sample fields to the current user
+func (a *App) emailPreviewSend(c echo.Context) error {
+	name := c.Param("name")
+	if !slices.Contains(message.Templates(), name) {
+		err := fmt.Errorf("email template %q not found", name)
+		return api.NewAppError(err, api.ErrorNotFound, http.StatusNotFound)
+	}
+
+	user := CurrentUser(c)
+	if err := core.SendEmailPreview(toCtx(c), Tx(c), user, name); err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "", view.EmailPreviewSent(user.GetEmail()))
+}
+
+func previewEmailFromParam(c echo.Context) (message.Message, error) {
+	name := c.Param("name")
+	if !slices.Contains(message.Templates(), name) {
+		err := fmt.Errorf("email template %q not found", name)
+		return message.Message{}, api.NewAppError(err, api.ErrorNotFound, http.StatusNotFound)
+	}
+	return core.PreviewEmail(CurrentUser(c), name)
+}
+
+func newEmailTemplatePreviewView(user data.User, name string) (app.EmailTemplatePreviewView, error) {
+	msg, err := core.PreviewEmail(user, name)
+	if err != nil {
+		return app.EmailTemplatePreviewView{}, err
+	}
+	raw, err := email.RawMessage(msg, app.EmailAssets())
+	if err != nil {
+		return app.EmailTemplatePreviewView{}, err
+	}
+	parts, err := email.ParseMIME(raw)
+	if err != nil {
+		return app.EmailTemplatePreviewView{}, err
+	}
+
+	preview := app.EmailTemplatePreviewView{
+		Template: name,
+		To:       msg.To(),
+		Subject:  msg.Subject(),
+		Text:     parts.Text,
+		HTMLURL:  "/email-templates/" + name + "/html",
+		SendURL:  "/email-templates/" + name + "/send",
+		Size: app.MIMESizeView{
+			Total: app.FormatByteSize(len(raw)),
+			Text:  app.FormatByteSize(len(parts.Text)),
+			HTML:  app.FormatByteSize(len(parts.HTML)),
+		},
+	}
+	for _, cid := range slices.Sorted(maps.Keys(parts.Images)) {
+		preview.Size.Images = append(preview.Size.Images, app.MIMEImageSizeView{
+			ContentID: cid,
+			Size:      app.FormatByteSize(len(parts.Images[cid].Data)),
+		})
+	}
+	return preview, nil
+}
@@ -0,0 +1,46 @@
+package action
+
+import (
+	"net/http"
+
+	"github.com/briskt/go-htmx-app/app"
+)
+
+func (s *Suite) TestEmailPreview() {
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), "user-token")
+	_, status := s.request("GET", "/email-templates", "user-token", nil)
+	s.Equal(http.StatusForbidden, status, "only admins may preview templates outside of development")
+
+	s.createAdmin()
+
+	body, status := s.request("GET", "/email-templates", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "inactivity_warning")
+	s.Contains(string(body), "Your "+app.Env.AppName+" data export is ready", "the first template should be shown")
+
+	body, status = s.request("GET", "/email-templates?template=welcome", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Important information about your "+app.Env.AppName+" account")
+	s.Contains(string(body), "admin@example.com")
+	s.Contains(string(body), "Username:")
+
+	_, status = s.request("GET", "/email-templates?template=unknown", testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+
+	body, status = s.request("GET", "/email-templates/welcome/html", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), `src="/assets/img/logo.png"`)
+	s.Contains(string(body), "<strong>Username:</strong> john_doe")
+
+	s.email.DeleteSentMessages()
+	body, status = s.request("POST", "/email-templates/welcome/send", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "Test message sent to admin@example.com")
+	s.sendQueuedEmails()
+	s.Equal(1, s.email.GetNumberOfMessagesSent())
+	s.Contains(s.email.GetLastToEmail(), "admin@example.com")
+
+	_, status = s.request("POST", "/email-templates/unknown/send", testToken, nil)
+	s.Equal(http.StatusNotFound, status)
+}
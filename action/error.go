@@ -10,7 +10,9 @@ import (
 
 	"github.com/briskt/go-htmx-app/api"
 	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
 	"github.com/briskt/go-htmx-app/log"
+	"github.com/briskt/go-htmx-app/scim"
 )
 
 // customHTTPErrorHandler adds details to an error and renders the error with echo.Render.
@@ -65,7 +67,12 @@ func customHTTPErrorHandler(err error, c echo.Context) {
 		return
 	}
 
-	err = c.JSON(appErr.HttpStatus, appErr)
+	if isSCIMRequest(c) {
+		c.Response().Header().Set(echo.HeaderContentType, scim.ContentType)
+		err = c.JSON(appErr.HttpStatus, newSCIMError(appErr))
+	} else {
+		err = c.JSON(appErr.HttpStatus, appErr)
+	}
 	if err != nil {
 		appErr.Extras = map[string]any{}
 		appErr.Err = fmt.Errorf("unable to encode extras for error (%s): %w", err, appErr.Err)
@@ -73,6 +80,32 @@ func customHTTPErrorHandler(err error, c echo.Context) {
 	}
 }
 
+// newValidationError converts core.FieldErrors to an AppError that lists the invalid fields. Any other error is
+// returned unchanged.
+func newValidationError(err error) error {
+	var fieldErrors core.FieldErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+	appErr := api.NewAppError(err, api.ErrorInvalidInput, http.StatusBadRequest)
+	appErr.Fields = fieldErrors
+	return appErr
+}
+
+// formErrors returns the invalid fields of a core.FieldErrors, or of an AppError that names the fields in conflict
+// with another record, for display in a form
+func formErrors(err error) (map[string]string, bool) {
+	var fieldErrors core.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		return fieldErrors, true
+	}
+	var appErr *api.AppError
+	if errors.As(err, &appErr) && appErr.Key == api.ErrorUserAlreadyExists && len(appErr.Fields) > 0 {
+		return appErr.Fields, true
+	}
+	return nil, false
+}
+
 // getClientIPAddress gets the client IP address from CF-Connecting-IP or RemoteAddr
 func getClientIPAddress(req *http.Request) (net.IP, error) {
 	// https://developers.cloudflare.com/fundamentals/get-started/reference/http-request-headers/#cf-connecting-ip
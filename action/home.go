@@ -18,7 +18,7 @@ import (
 var enabled bool
 
 // home renders the home page
-func home(c echo.Context) error {
+func (a *App) home(c echo.Context) error {
 	user := CurrentUser(c)
 	if user.ID == 0 {
 		return c.Redirect(http.StatusFound, "/auth/login")
@@ -30,11 +30,12 @@ func home(c echo.Context) error {
 // renderHome renders the "home" templ template
 func renderHome(c echo.Context, user data.User) error {
 	profileData := app.ProfileView{
+		Admin:         user.Admin,
 		AppName:       app.Env.AppName,
 		DisplayName:   user.GetDisplayName(),
 		Enabled:       enabled,
 		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
-		LastLogin:     formatDate(user.LastLoginAt),
+		LastLogin:     formatDate(user.LastLoginAt, user),
 		Username:      user.Username,
 		UserID:        strconv.Itoa(int(user.ID)),
 	}
@@ -44,20 +45,21 @@ func renderHome(c echo.Context, user data.User) error {
 }
 
 // card responds to the button on "card"
-func cardItem(c echo.Context) error {
+func (a *App) cardItem(c echo.Context) error {
 	enabled = !enabled
 	return c.Render(http.StatusOK, "", components.Card(enabled, true))
 }
 
 // formatNullDate returns a long-form, user-friendly date string from a valid sql.NullTime. If invalid, it returns "-"
-func formatNullDate(d sql.NullTime) string {
+func formatNullDate(d sql.NullTime, viewer data.User) string {
 	if d.Valid {
-		return formatDate(d.Time)
+		return formatDate(d.Time, viewer)
 	}
 	return "-"
 }
 
-// formatDate returns a long-form, user-friendly date string from a time.Time
-func formatDate(d time.Time) string {
-	return d.Format("Monday, January 2, 2006")
+// formatDate returns a long-form, user-friendly date string from a time.Time, in the time zone and language preferred
+// by the user viewing it
+func formatDate(d time.Time, viewer data.User) string {
+	return app.FormatDate(d, viewer.TimeZone, viewer.Language)
 }
@@ -24,14 +24,27 @@ func (s *Suite) TestHome() {
 func (s *Suite) TestFormatNullDate() {
 	date := time.Date(2024, 1, 1, 1, 1, 1, 0, time.UTC)
 
-	got := formatNullDate(sql.NullTime{Valid: true, Time: date})
+	got := formatNullDate(sql.NullTime{Valid: true, Time: date}, data.User{})
 	s.Equal("Monday, January 1, 2024", got)
 
-	got = formatNullDate(sql.NullTime{Valid: false, Time: date})
+	got = formatNullDate(sql.NullTime{Valid: false, Time: date}, data.User{})
 	s.Equal("-", got)
 }
 
 func (s *Suite) TestFormatDate() {
-	got := formatDate(time.Date(2024, 1, 1, 1, 1, 1, 0, time.UTC))
+	date := time.Date(2024, 1, 1, 1, 1, 1, 0, time.UTC)
+	got := formatDate(date, data.User{})
 	s.Equal("Monday, January 1, 2024", got)
+
+	var viewer data.User
+	viewer.TimeZone = "America/New_York"
+	viewer.Language = "en"
+	s.Equal("Sunday, December 31, 2023", formatDate(date, viewer))
+
+	viewer.Language = "fr"
+	s.Equal("dimanche 31 décembre 2023", formatDate(date, viewer))
+
+	viewer.TimeZone = "Europe/Madrid"
+	viewer.Language = "es"
+	s.Equal("lunes, 1 de enero de 2024", formatDate(date, viewer))
 }
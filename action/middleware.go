@@ -22,14 +22,14 @@ import (
 // authenticationMiddleware supports both bearer token and session-based user token authentication. If a valid bearer
 // token is found, the token-auth flag is set in context. If a valid user session is present, the user record is added
 // to context.
-func authenticationMiddleware() echo.MiddlewareFunc {
+func (a *App) authenticationMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if authnSkipper(c) {
 				return next(c)
 			}
 
-			if hasValidBearerToken(c.Request().Header) {
+			if hasValidBearerToken(c.Request().Header, app.Env.APIAccessKeys) {
 				app.ContextKeyTokenAuth.Set(c, true)
 				return next(c)
 			}
@@ -45,7 +45,7 @@ func authenticationMiddleware() echo.MiddlewareFunc {
 				return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
 			}
 
-			user, err := core.FindUserByToken(toCtx(c), Tx(c), token)
+			user, err := core.FindUserByToken(toCtx(c), Tx(c), token, a.now())
 			if err != nil {
 				return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
 			}
@@ -59,6 +59,81 @@ func authenticationMiddleware() echo.MiddlewareFunc {
 	}
 }
 
+// auditMiddleware adds the current user, IP address and request ID to the request context, for the audit events
+// recorded while handling the request. It must follow the authentication and request ID middleware.
+func auditMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := core.WithAuditInfo(toCtx(c), core.AuditInfo{
+				ActorID:   int(CurrentUser(c).ID),
+				IP:        c.RealIP(),
+				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+			})
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// adminMiddleware restricts access to authenticated users with the admin flag set
+func adminMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := CurrentUser(c)
+			if user.ID == 0 {
+				err := errors.New("no authenticated user for admin request")
+				return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+			}
+			if !user.Admin {
+				err := fmt.Errorf("user %q is not an admin", user.EmployeeID)
+				return api.NewAppError(err, api.ErrorNotAuthorized, http.StatusForbidden)
+			}
+			return next(c)
+		}
+	}
+}
+
+// devOrAdminMiddleware restricts access to admins, except in development, where any authenticated user is allowed
+func devOrAdminMiddleware() echo.MiddlewareFunc {
+	requireAdmin := adminMiddleware()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		adminNext := requireAdmin(next)
+		return func(c echo.Context) error {
+			if app.Env.AppEnv == app.EnvDevelopment && CurrentUser(c).ID != 0 {
+				return next(c)
+			}
+			return adminNext(c)
+		}
+	}
+}
+
+// tokenAuthMiddleware restricts access to callers authenticated with a bearer token
+func tokenAuthMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !isTokenAuth(c) {
+				err := errors.New("no valid bearer token provided for API request")
+				return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+			}
+			return next(c)
+		}
+	}
+}
+
+// scimAuthMiddleware restricts access to SCIM clients, which authenticate with a bearer token from the list of SCIM
+// access keys. These are separate from the API access keys so that each can be granted and revoked independently.
+func scimAuthMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasValidBearerToken(c.Request().Header, app.Env.SCIMAccessKeys) {
+				err := errors.New("no valid bearer token provided for SCIM request")
+				return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+			}
+			return next(c)
+		}
+	}
+}
+
 // isTokenAuth returns true if the token-auth flag was set in the context by the middleware
 func isTokenAuth(c echo.Context) bool {
 	if _, ok := app.ContextKeyTokenAuth.Get(c).(bool); !ok {
@@ -67,11 +142,11 @@ func isTokenAuth(c echo.Context) bool {
 	return true
 }
 
-// hasValidBearerToken compares a provided token against the know list of tokens and returns true if there's a match
-func hasValidBearerToken(h http.Header) bool {
+// hasValidBearerToken compares a provided token against the given list of tokens and returns true if there's a match
+func hasValidBearerToken(h http.Header, keys []string) bool {
 	authHeader := h.Get(echo.HeaderAuthorization)
 	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) == 2 && parts[0] == "Bearer" && slices.Contains(app.Env.APIAccessKeys, parts[1]) {
+	if len(parts) == 2 && parts[0] == "Bearer" && slices.Contains(keys, parts[1]) {
 		log.WithFields(log.Fields{"tokenPrefix": parts[1][0:3]}).Debug("authenticated with bearer token")
 		return true
 	}
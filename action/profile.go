@@ -0,0 +1,123 @@
+package action
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view"
+)
+
+// profile renders the profile page of the current user
+func (a *App) profile(c echo.Context) error {
+	user := CurrentUser(c)
+	if user.ID == 0 {
+		return c.Redirect(http.StatusFound, "/auth/login")
+	}
+
+	return renderProfile(c, user, "")
+}
+
+// renderProfile renders the profile page with an optional notice
+func renderProfile(c echo.Context, user data.User, notice string) error {
+	return c.Render(http.StatusOK, "", view.Profile(app.ProfileEditView{
+		AppName:       app.Env.AppName,
+		DisplayName:   user.GetDisplayName(),
+		HelpCenterURL: templ.URL(app.Env.HelpCenterURL),
+		Form:          newProfileFormView(user),
+		Notice:        notice,
+	}))
+}
+
+// profileUpdate saves the profile form. The form is rendered again, with errors if the input is not valid.
+func (a *App) profileUpdate(c echo.Context) error {
+	if CurrentUser(c).ID == 0 {
+		err := errors.New("no authenticated user for profile update")
+		return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+	}
+
+	input := core.ProfileInput{
+		DisplayName:        c.FormValue("display_name"),
+		TimeZone:           c.FormValue("time_zone"),
+		Language:           c.FormValue("language"),
+		EmailNotifications: c.FormValue("email_notifications") == "true",
+		Attributes:         attributeFormValues(c, app.UserAttribute.EditableByUser),
+	}
+	user, err := core.UpdateProfile(toCtx(c), Tx(c), CurrentUser(c), input)
+	var fieldErrors core.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		form := newProfileFormView(user)
+		form.DisplayName = input.DisplayName
+		form.TimeZone = input.TimeZone
+		form.Language = input.Language
+		form.EmailNotifications = input.EmailNotifications
+		setAttributeViewValues(form.Attributes, input.Attributes)
+		form.Errors = fieldErrors
+		return c.Render(http.StatusOK, "", view.ProfileForm(form))
+	}
+	if err != nil {
+		return err
+	}
+
+	form := newProfileFormView(user)
+	form.Saved = true
+	return c.Render(http.StatusOK, "", view.ProfileForm(form))
+}
+
+// profileEmailChange sends a confirmation link to the requested new email address. The form is rendered again, with
+// errors if the address is not valid.
+func (a *App) profileEmailChange(c echo.Context) error {
+	user := CurrentUser(c)
+	if user.ID == 0 {
+		err := errors.New("no authenticated user for email change")
+		return api.NewAppError(err, api.ErrorNotAuthenticated, http.StatusUnauthorized)
+	}
+
+	form := app.EmailChangeFormView{NewEmail: c.FormValue("new_email")}
+	err := core.RequestEmailChange(toCtx(c), Tx(c), user, form.NewEmail)
+	var fieldErrors core.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		form.Errors = fieldErrors
+		return c.Render(http.StatusOK, "", view.EmailChangeForm(form))
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "", view.EmailChangeForm(app.EmailChangeFormView{SentTo: form.NewEmail}))
+}
+
+// profileEmailConfirm applies a change of email address when the user follows the link in the confirmation message
+func (a *App) profileEmailConfirm(c echo.Context) error {
+	user := CurrentUser(c)
+	if user.ID == 0 {
+		return c.Redirect(http.StatusFound, "/auth/login")
+	}
+
+	user, err := core.ConfirmEmailChange(toCtx(c), Tx(c), user, c.QueryParam("token"), a.now())
+	if err != nil {
+		return err
+	}
+	return renderProfile(c, user, "Your email address was changed to "+user.Email+".")
+}
+
+// newProfileFormView converts a user record to the values of the profile form
+func newProfileFormView(user data.User) app.ProfileFormView {
+	return app.ProfileFormView{
+		Username:           user.Username,
+		Email:              user.Email,
+		DisplayName:        user.DisplayName,
+		TimeZone:           user.TimeZone,
+		Language:           user.Language,
+		EmailNotifications: user.EmailNotifications,
+		Languages:          app.Languages,
+		Attributes: newUserAttributeViews(user, app.UserAttribute.VisibleToUser,
+			app.UserAttribute.EditableByUser),
+	}
+}
@@ -0,0 +1,105 @@
+package action
+
+import (
+	"net/http"
+
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+func (s *Suite) TestProfile() {
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	response, status := s.request("GET", "/profile", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "My profile")
+
+	form := "display_name=Johnny&time_zone=America/New_York&language=fr&email_notifications=true"
+	response, status = s.request("PUT", "/profile", testToken, form)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Your profile was saved.")
+
+	saved, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Johnny", saved.DisplayName)
+	s.Equal("America/New_York", saved.TimeZone)
+	s.Equal("fr", saved.Language)
+	s.True(saved.EmailNotifications)
+
+	form = "display_name=Johnny&time_zone=Mars/Olympus&language=fr"
+	response, status = s.request("PUT", "/profile", testToken, form)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Time zone must be a valid IANA time zone")
+
+	saved, err = data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("America/New_York", saved.TimeZone)
+}
+
+func (s *Suite) TestProfileEmailChange() {
+	fake := s.email
+	fake.DeleteSentMessages()
+
+	user := s.createTestUser("10001", "john_doe")
+	saveToken(s.db, int(user.ID), testToken)
+
+	response, status := s.request("POST", "/profile/email", testToken, "new_email=not-an-email")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Email must be a valid email address")
+	s.Equal(0, fake.GetNumberOfMessagesSent())
+
+	response, status = s.request("POST", "/profile/email", testToken, "new_email=john@example.org")
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "A confirmation link was sent to john@example.org")
+	s.sendQueuedEmails()
+	s.Equal(1, fake.GetNumberOfMessagesSent())
+	s.Contains(fake.GetLastToEmail(), "john@example.org")
+
+	unchanged, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("john_doe@example.com", unchanged.Email)
+
+	// the token in the message is not known here, so add a pending change with a known token
+	_, err = data.CreateEmailChange(s.ctx, s.db, int(user.ID), "john@example.org", core.HashAccessToken("known"))
+	s.NoError(err)
+
+	_, status = s.request("GET", "/profile/email/confirm?token=wrong", testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+
+	response, status = s.request("GET", "/profile/email/confirm?token=known", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Your email address was changed to john@example.org.")
+	s.sendQueuedEmails()
+	s.Equal(2, fake.GetNumberOfMessagesSent())
+	s.Contains(fake.GetLastToEmail(), "john_doe@example.com")
+
+	changed, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("john@example.org", changed.Email)
+
+	_, status = s.request("GET", "/profile/email/confirm?token=known", testToken, nil)
+	s.Equal(http.StatusBadRequest, status, "token should be single-use")
+}
+
+func (s *Suite) TestProfile_Attributes() {
+	user := s.createTestUser("10001", "john_doe")
+	s.NoError(user.SetAttribute("manager", "Jane Manager"))
+	s.NoError(user.SetAttribute("cost_center", "CC-100"))
+	s.NoError(user.Update(s.ctx, s.db))
+	saveToken(s.db, int(user.ID), testToken)
+
+	response, status := s.request("GET", "/profile", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(response), "Jane Manager")
+	s.NotContains(string(response), "CC-100", "cost center is only for admins")
+
+	form := "display_name=Johnny&time_zone=UTC&language=en&attribute_manager=Someone+Else"
+	_, status = s.request("PUT", "/profile", testToken, form)
+	s.Equal(http.StatusOK, status)
+
+	saved, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Jane Manager", saved.Attribute("manager"), "manager may be changed only by an admin")
+	s.Equal("Johnny", saved.DisplayName)
+}
@@ -0,0 +1,427 @@
+package action
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/scim"
+)
+
+const (
+	scimPathPrefix   = "/scim/v2"
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+// swagger:operation GET /scim/v2/ServiceProviderConfig SCIM SCIMServiceProviderConfig
+// SCIMServiceProviderConfig
+//
+// Describe the SCIM features supported by this app
+// ---
+//
+//	responses:
+//	  '200':
+//	    description: the SCIM service provider configuration
+func (a *App) scimServiceProviderConfig(c echo.Context) error {
+	return scimJSON(c, http.StatusOK, scim.NewServiceProviderConfig(scimBaseURL(), scimMaxCount))
+}
+
+// swagger:operation GET /scim/v2/ResourceTypes SCIM SCIMResourceTypes
+// SCIMResourceTypes
+//
+// List the SCIM resource types supported by this app
+// ---
+//
+//	responses:
+//	  '200':
+//	    description: a list of resource types
+func (a *App) scimResourceTypes(c echo.Context) error {
+	resourceTypes := []scim.ResourceType{scim.NewUserResourceType(scimBaseURL())}
+	return scimJSON(c, http.StatusOK, scim.NewListResponse(resourceTypes, len(resourceTypes), 1))
+}
+
+// swagger:operation GET /scim/v2/ResourceTypes/User SCIM SCIMResourceTypeUser
+// SCIMResourceTypeUser
+//
+// Describe the SCIM User resource type
+// ---
+//
+//	responses:
+//	  '200':
+//	    description: the User resource type
+func (a *App) scimResourceTypeUser(c echo.Context) error {
+	return scimJSON(c, http.StatusOK, scim.NewUserResourceType(scimBaseURL()))
+}
+
+// swagger:operation GET /scim/v2/Schemas SCIM SCIMSchemas
+// SCIMSchemas
+//
+// List the SCIM schemas supported by this app
+// ---
+//
+//	responses:
+//	  '200':
+//	    description: a list of schemas
+func (a *App) scimSchemas(c echo.Context) error {
+	schemas := scim.NewSchemas(scimBaseURL())
+	return scimJSON(c, http.StatusOK, scim.NewListResponse(schemas, len(schemas), 1))
+}
+
+// swagger:operation GET /scim/v2/Schemas/{id} SCIM SCIMSchema
+// SCIMSchema
+//
+// Describe one SCIM schema
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '200':
+//	    description: the schema
+func (a *App) scimSchema(c echo.Context) error {
+	for _, schema := range scim.NewSchemas(scimBaseURL()) {
+		if schema.ID == c.Param("id") {
+			return scimJSON(c, http.StatusOK, schema)
+		}
+	}
+	err := fmt.Errorf("schema %q not found", c.Param("id"))
+	return api.NewAppError(err, api.ErrorNotFound, http.StatusNotFound)
+}
+
+// swagger:operation GET /scim/v2/Users SCIM SCIMListUsers
+// SCIMListUsers
+//
+// List users, optionally filtered by userName, emails or employeeNumber
+// ---
+//
+//	parameters:
+//	- name: filter
+//	  in: query
+//	  type: string
+//	- name: startIndex
+//	  in: query
+//	  type: integer
+//	- name: count
+//	  in: query
+//	  type: integer
+//	responses:
+//	  '200':
+//	    description: a list of users
+func (a *App) scimListUsers(c echo.Context) error {
+	if f := c.QueryParam("filter"); f != "" {
+		filter, err := scim.ParseFilter(f)
+		if err != nil {
+			return api.NewAppError(err, api.ErrorSCIMInvalidFilter, http.StatusBadRequest)
+		}
+
+		users := []scim.User{}
+		user, err := findUserBySCIMFilter(c, filter)
+		if err == nil {
+			users = append(users, newSCIMUser(user))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return scimJSON(c, http.StatusOK, scim.NewListResponse(users, len(users), 1))
+	}
+
+	startIndex, err := queryParamInt(c, "startIndex", 1, 1, -1)
+	if err != nil {
+		return err
+	}
+	count, err := queryParamInt(c, "count", scimDefaultCount, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	users, total, err := data.ListUsers(toCtx(c), Tx(c), data.UserFilter{
+		Limit:  min(count, scimMaxCount),
+		Offset: startIndex - 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	resources := make([]scim.User, len(users))
+	for i, user := range users {
+		resources[i] = newSCIMUser(user)
+	}
+	return scimJSON(c, http.StatusOK, scim.NewListResponse(resources, total, startIndex))
+}
+
+// swagger:operation GET /scim/v2/Users/{id} SCIM SCIMGetUser
+// SCIMGetUser
+//
+// Get a user
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '200':
+//	    description: the user
+func (a *App) scimGetUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, newSCIMUser(user))
+}
+
+// swagger:operation POST /scim/v2/Users SCIM SCIMCreateUser
+// SCIMCreateUser
+//
+// Provision a new user
+// ---
+//
+//	responses:
+//	  '201':
+//	    description: the new user
+func (a *App) scimCreateUser(c echo.Context) error {
+	var input scim.User
+	if err := bindSCIM(c, &input); err != nil {
+		return err
+	}
+
+	user, err := core.CreateUser(toCtx(c), Tx(c), newSCIMUserInput(input))
+	if err != nil {
+		return newValidationError(err)
+	}
+
+	if !input.IsActive() {
+		if user, err = core.SetUserActive(toCtx(c), Tx(c), data.User{}, user, false); err != nil {
+			return err
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, scimUserLocation(user))
+	return scimJSON(c, http.StatusCreated, newSCIMUser(user))
+}
+
+// swagger:operation PUT /scim/v2/Users/{id} SCIM SCIMReplaceUser
+// SCIMReplaceUser
+//
+// Replace a user's attributes
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '200':
+//	    description: the updated user
+func (a *App) scimReplaceUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	var input scim.User
+	if err = bindSCIM(c, &input); err != nil {
+		return err
+	}
+
+	if user, err = saveSCIMUser(c, user, input); err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, newSCIMUser(user))
+}
+
+// swagger:operation PATCH /scim/v2/Users/{id} SCIM SCIMPatchUser
+// SCIMPatchUser
+//
+// Change some of a user's attributes
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '200':
+//	    description: the updated user
+func (a *App) scimPatchUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	var patch scim.PatchRequest
+	if err = bindSCIM(c, &patch); err != nil {
+		return err
+	}
+
+	resource := newSCIMUser(user)
+	if err = patch.Apply(&resource); err != nil {
+		return api.NewAppError(err, api.ErrorSCIMInvalidPatch, http.StatusBadRequest)
+	}
+
+	if user, err = saveSCIMUser(c, user, resource); err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, newSCIMUser(user))
+}
+
+// swagger:operation DELETE /scim/v2/Users/{id} SCIM SCIMDeleteUser
+// SCIMDeleteUser
+//
+// Deprovision a user. The user is deactivated rather than deleted, to preserve its history.
+// ---
+//
+//	parameters:
+//	- name: id
+//	  in: path
+//	  required: true
+//	  type: string
+//	responses:
+//	  '204':
+//	    description: the user was deactivated
+func (a *App) scimDeleteUser(c echo.Context) error {
+	user, err := getUserFromParam(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err = core.SetUserActive(toCtx(c), Tx(c), data.User{}, user, false); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// saveSCIMUser saves the attributes of a SCIM User resource to an existing user
+func saveSCIMUser(c echo.Context, user data.User, resource scim.User) (data.User, error) {
+	user, err := core.UpdateUser(toCtx(c), Tx(c), user, newSCIMUserInput(resource))
+	if err != nil {
+		return user, newValidationError(err)
+	}
+
+	if user.Active != resource.IsActive() {
+		return core.SetUserActive(toCtx(c), Tx(c), data.User{}, user, resource.IsActive())
+	}
+	return user, nil
+}
+
+// findUserBySCIMFilter finds the user matching an equality filter. The error wraps sql.ErrNoRows if no user matches.
+func findUserBySCIMFilter(c echo.Context, filter scim.Filter) (data.User, error) {
+	switch filter.Attribute {
+	case scim.FilterAttributeID:
+		id, err := strconv.Atoi(filter.Value)
+		if err != nil {
+			return data.User{}, fmt.Errorf("invalid user id %q: %w", filter.Value, sql.ErrNoRows)
+		}
+		return data.GetUser(toCtx(c), Tx(c), id)
+	case scim.FilterAttributeUserName:
+		return data.FindUserByUsername(toCtx(c), Tx(c), filter.Value)
+	case scim.FilterAttributeEmail:
+		return data.FindUserByEmail(toCtx(c), Tx(c), filter.Value)
+	case scim.FilterAttributeEmployeeNumber:
+		return data.FindUserByEmployeeID(toCtx(c), Tx(c), filter.Value)
+	}
+	err := fmt.Errorf("unsupported filter attribute %q", filter.Attribute)
+	return data.User{}, api.NewAppError(err, api.ErrorSCIMInvalidFilter, http.StatusBadRequest)
+}
+
+// newSCIMUser converts a user record to a SCIM User resource
+func newSCIMUser(user data.User) scim.User {
+	active := user.Active
+	return scim.User{
+		Schemas:  []string{scim.SchemaUser, scim.SchemaEnterpriseUser},
+		ID:       strconv.Itoa(int(user.ID)),
+		UserName: user.Username,
+		Name: &scim.Name{
+			Formatted:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		DisplayName: user.DisplayName,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Enterprise:  &scim.EnterpriseUser{EmployeeNumber: user.EmployeeID},
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     scimUserLocation(user),
+		},
+	}
+}
+
+// newSCIMUserInput converts the attributes of a SCIM User resource to the editable fields of a user
+func newSCIMUserInput(resource scim.User) core.UserInput {
+	return core.UserInput{
+		EmployeeID:  resource.EmployeeNumber(),
+		FirstName:   resource.GivenName(),
+		LastName:    resource.FamilyName(),
+		DisplayName: resource.DisplayName,
+		Username:    resource.UserName,
+		Email:       resource.PrimaryEmail(),
+	}
+}
+
+// bindSCIM decodes a SCIM request body. Unlike Binder, unknown fields are allowed, because identity providers send
+// attributes beyond those supported here.
+func bindSCIM(c echo.Context, i any) error {
+	if err := json.NewDecoder(c.Request().Body).Decode(i); err != nil {
+		return api.NewAppError(err, api.ErrorInvalidRequestBody, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// scimJSON sends a JSON response with the SCIM content type
+func scimJSON(c echo.Context, status int, i any) error {
+	c.Response().Header().Set(echo.HeaderContentType, scim.ContentType)
+	return c.JSON(status, i)
+}
+
+// isSCIMRequest returns true if the request is for a SCIM endpoint
+func isSCIMRequest(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, scimPathPrefix+"/")
+}
+
+// newSCIMError converts an AppError to a SCIM error response
+func newSCIMError(appErr *api.AppError) scim.Error {
+	scimType := ""
+	switch appErr.Key {
+	case api.ErrorSCIMInvalidFilter:
+		scimType = scim.ErrorTypeInvalidFilter
+	case api.ErrorSCIMInvalidPatch, api.ErrorInvalidInput:
+		scimType = scim.ErrorTypeInvalidValue
+	case api.ErrorInvalidRequestBody:
+		scimType = scim.ErrorTypeInvalidSyntax
+	case api.ErrorUserAlreadyExists:
+		scimType = scim.ErrorTypeUniqueness
+	}
+
+	detail := appErr.Message
+	if len(appErr.Fields) > 0 {
+		detail = appErr.Err.Error()
+	}
+	return scim.NewError(appErr.HttpStatus, scimType, detail)
+}
+
+func scimBaseURL() string {
+	return app.Env.AppURL + scimPathPrefix
+}
+
+func scimUserLocation(user data.User) string {
+	return scimBaseURL() + "/Users/" + strconv.Itoa(int(user.ID))
+}
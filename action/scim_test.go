@@ -0,0 +1,165 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/scim"
+)
+
+const testSCIMKey = "test-scim-key-0123456789"
+
+func (s *Suite) useSCIMKey() {
+	keys := app.Env.SCIMAccessKeys
+	app.Env.SCIMAccessKeys = []string{testSCIMKey}
+	s.T().Cleanup(func() { app.Env.SCIMAccessKeys = keys })
+}
+
+type scimUserList struct {
+	TotalResults int
+	Resources    []scim.User
+}
+
+func (s *Suite) TestSCIMDiscovery() {
+	s.useSCIMKey()
+
+	_, status := s.request("GET", "/scim/v2/ServiceProviderConfig", "invalid", nil)
+	s.Equal(http.StatusUnauthorized, status)
+
+	res := s.requestResponse("GET", "/scim/v2/ServiceProviderConfig", testSCIMKey, nil)
+	s.Equal(http.StatusOK, res.Code, res.Body.String())
+	s.Equal(scim.ContentType, res.Header().Get("Content-Type"))
+
+	body, status := s.request("GET", "/scim/v2/ResourceTypes/User", testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.Contains(string(body), scim.SchemaEnterpriseUser)
+
+	_, status = s.request("GET", "/scim/v2/Schemas/"+scim.SchemaUser, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status)
+
+	_, status = s.request("GET", "/scim/v2/Schemas/unknown", testSCIMKey, nil)
+	s.Equal(http.StatusNotFound, status)
+}
+
+func (s *Suite) TestSCIMListUsers() {
+	s.useSCIMKey()
+	s.createTestUser("10001", "john_doe")
+	s.createTestUser("10002", "jane_smith")
+
+	body, status := s.request("GET", "/scim/v2/Users?count=1", testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	var list scimUserList
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(2, list.TotalResults)
+	s.Len(list.Resources, 1)
+
+	filter := url.QueryEscape(`userName eq "jane_smith"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(1, list.TotalResults)
+	s.Equal("10002", list.Resources[0].EmployeeNumber())
+
+	filter = url.QueryEscape(`emails[type eq "work"].value eq "jane_smith@example.com"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(1, list.TotalResults)
+	s.Equal("10002", list.Resources[0].EmployeeNumber())
+
+	filter = url.QueryEscape(`emails eq "jane_smith"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(0, list.TotalResults, "an email filter should not match a username")
+
+	filter = url.QueryEscape(`id eq "not-a-number"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(0, list.TotalResults)
+
+	// Postgres rejects a NUL character in text, so the lookup fails rather than finding no user
+	filter = url.QueryEscape(`emails eq "\u0000"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusInternalServerError, status, string(body))
+	var scimErr scim.Error
+	s.NoError(json.Unmarshal(body, &scimErr))
+
+	filter = url.QueryEscape(`employeeNumber eq "99999"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusOK, status, string(body))
+	s.NoError(json.Unmarshal(body, &list))
+	s.Equal(0, list.TotalResults)
+
+	filter = url.QueryEscape(`userName sw "j"`)
+	body, status = s.request("GET", "/scim/v2/Users?filter="+filter, testSCIMKey, nil)
+	s.Equal(http.StatusBadRequest, status)
+	s.NoError(json.Unmarshal(body, &scimErr))
+	s.Equal(scim.ErrorTypeInvalidFilter, scimErr.ScimType)
+}
+
+func (s *Suite) TestSCIMCreateUser() {
+	s.useSCIMKey()
+
+	input := map[string]any{
+		"schemas":                 []string{scim.SchemaUser, scim.SchemaEnterpriseUser},
+		"externalId":              "abc-123",
+		"userName":                "ann_other",
+		"name":                    map[string]string{"givenName": "Ann", "familyName": "Other"},
+		"emails":                  []map[string]any{{"value": "ann_other@example.com", "type": "work", "primary": true}},
+		"active":                  true,
+		scim.SchemaEnterpriseUser: map[string]string{"employeeNumber": "10003"},
+	}
+	body, status := s.request("POST", "/scim/v2/Users", testSCIMKey, input)
+	s.Equal(http.StatusCreated, status, string(body))
+	var got scim.User
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal("ann_other", got.UserName)
+	s.Equal("ann_other@example.com", got.PrimaryEmail())
+	s.True(got.IsActive())
+
+	body, status = s.request("POST", "/scim/v2/Users", testSCIMKey, input)
+	s.Equal(http.StatusConflict, status, string(body))
+	var scimErr scim.Error
+	s.NoError(json.Unmarshal(body, &scimErr))
+	s.Equal(scim.ErrorTypeUniqueness, scimErr.ScimType)
+}
+
+func (s *Suite) TestSCIMPatchAndDeleteUser() {
+	s.useSCIMKey()
+	user := s.createTestUser("10001", "john_doe")
+	path := fmt.Sprintf("/scim/v2/Users/%d", user.ID)
+
+	patch := map[string]any{
+		"schemas": []string{scim.SchemaPatchOp},
+		"Operations": []map[string]any{
+			{"op": "replace", "path": "name.givenName", "value": "Jon"},
+			{"op": "replace", "value": map[string]any{"active": "False"}},
+		},
+	}
+	body, status := s.request("PATCH", path, testSCIMKey, patch)
+	s.Equal(http.StatusOK, status, string(body))
+	var got scim.User
+	s.NoError(json.Unmarshal(body, &got))
+	s.Equal("Jon", got.GivenName())
+	s.False(got.IsActive())
+
+	dbUser, err := data.GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Jon", dbUser.FirstName)
+	s.False(dbUser.Active)
+
+	_, status = s.request("PATCH", path, testSCIMKey, map[string]any{
+		"schemas":    []string{scim.SchemaPatchOp},
+		"Operations": []map[string]any{{"op": "move", "path": "userName"}},
+	})
+	s.Equal(http.StatusBadRequest, status)
+
+	_, status = s.request("DELETE", path, testSCIMKey, nil)
+	s.Equal(http.StatusNoContent, status)
+}
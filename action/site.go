@@ -15,6 +15,6 @@ import (
 //	responses:
 //	  '204':
 //	    description: app status is good
-func siteStatus(c echo.Context) error {
+func (a *App) siteStatus(c echo.Context) error {
 	return c.JSON(http.StatusNoContent, nil)
 }
@@ -0,0 +1,96 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+// newUserAttributeViews lists the registered custom attributes allowed by include, with the user's values
+func newUserAttributeViews(user data.User, include, editable func(app.UserAttribute) bool) []app.UserAttributeView {
+	var views []app.UserAttributeView
+	for _, a := range app.UserAttributes {
+		if !include(a) {
+			continue
+		}
+		views = append(views, app.UserAttributeView{
+			Name:        a.Name,
+			FieldName:   a.FieldName(),
+			Label:       a.Label,
+			Type:        a.Type,
+			Value:       a.Format(user.Attribute(a.Name)),
+			Options:     a.Options,
+			Editable:    editable(a),
+			SAMLSourced: a.SAMLSourced(),
+		})
+	}
+	return views
+}
+
+// setAttributeViewValues replaces the values of attribute views with form values, keyed by attribute name, such as
+// the values entered in a form that is shown again
+func setAttributeViewValues(views []app.UserAttributeView, values map[string]string) {
+	for i := range views {
+		if value, ok := values[views[i].Name]; ok {
+			views[i].Value = value
+		}
+	}
+}
+
+// attributeFormValues reads the form values of the custom attributes allowed by editable, keyed by attribute name. A
+// missing value, such as an unchecked checkbox, is read as empty.
+func attributeFormValues(c echo.Context, editable func(app.UserAttribute) bool) map[string]string {
+	values := map[string]string{}
+	for _, a := range app.UserAttributes {
+		if editable(a) {
+			values[a.Name] = c.FormValue(a.FieldName())
+		}
+	}
+	return values
+}
+
+// attributeFilterFromQuery reads the custom attribute values the admin user list is filtered by. An empty query
+// parameter does not filter.
+func attributeFilterFromQuery(c echo.Context) (map[string]any, error) {
+	filter := map[string]any{}
+	for _, a := range app.UserAttributes {
+		param := c.QueryParam(a.FieldName())
+		if param == "" {
+			continue
+		}
+		value, err := a.Parse(param)
+		if err != nil {
+			err = fmt.Errorf("invalid value %q for query parameter %q: %w", param, a.FieldName(), err)
+			return nil, api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+		}
+		if value != nil {
+			filter[a.Name] = value
+		}
+	}
+	return filter, nil
+}
+
+// newAttributeFilterViews lists the custom attributes the admin user list may be filtered by, with the chosen values
+func newAttributeFilterViews(filter map[string]any) []app.AttributeFilterView {
+	views := make([]app.AttributeFilterView, len(app.UserAttributes))
+	for i, a := range app.UserAttributes {
+		views[i] = app.AttributeFilterView{
+			FieldName: a.FieldName(),
+			Label:     a.Label,
+			Type:      a.Type,
+			Value:     a.Format(filter[a.Name]),
+			Options:   a.Options,
+		}
+	}
+	return views
+}
+
+// anyAttribute selects every custom attribute, for admins, who may see all of them
+func anyAttribute(app.UserAttribute) bool {
+	return true
+}
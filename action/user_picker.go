@@ -0,0 +1,78 @@
+package action
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/public/view/components"
+)
+
+const userPickerResultsLimit = 8
+
+// userPickerFieldPattern restricts field names, which are also used in element IDs
+var userPickerFieldPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// userPickerSearch lists the users best matching the text typed in a user type-ahead field. The field name is given in
+// the "field" query parameter, and the text in the parameter of that name, which is how HTMX sends the input's value.
+func (a *App) userPickerSearch(c echo.Context) error {
+	field, err := userPickerField(c)
+	if err != nil {
+		return err
+	}
+
+	picker := app.UserPickerView{Field: field}
+	search := strings.TrimSpace(c.QueryParam(field))
+	if search == "" {
+		return c.Render(http.StatusOK, "", components.UserPickerResults(picker))
+	}
+
+	users, err := data.SearchUsers(toCtx(c), Tx(c), search, userPickerResultsLimit, 0)
+	if err != nil {
+		return err
+	}
+
+	picker.Searched = true
+	picker.Results = make([]app.UserOptionView, len(users))
+	for i, user := range users {
+		picker.Results[i] = app.UserOptionView{
+			Name:       user.GetDisplayName(),
+			Username:   user.Username,
+			Email:      user.Email,
+			EmployeeID: user.EmployeeID,
+			SelectURL:  "/admin/users/picker?" + url.Values{"field": {field}, "value": {user.Username}}.Encode(),
+		}
+	}
+	return c.Render(http.StatusOK, "", components.UserPickerResults(picker))
+}
+
+// userPickerSelect renders a user type-ahead field with a chosen user, and fires the "userPicked" event
+func (a *App) userPickerSelect(c echo.Context) error {
+	field, err := userPickerField(c)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("HX-Trigger-After-Settle", "userPicked")
+	return c.Render(http.StatusOK, "", components.UserPicker(app.UserPickerView{
+		Field: field,
+		Value: c.QueryParam("value"),
+	}))
+}
+
+// userPickerField returns the validated field name of a user type-ahead request
+func userPickerField(c echo.Context) (string, error) {
+	field := c.QueryParam("field")
+	if !userPickerFieldPattern.MatchString(field) {
+		err := errors.New("invalid user picker field name")
+		return "", api.NewAppError(err, api.ErrorInvalidQueryParam, http.StatusBadRequest)
+	}
+	return field, nil
+}
@@ -0,0 +1,28 @@
+package action
+
+import (
+	"net/http"
+)
+
+func (s *Suite) TestUserPicker() {
+	s.createAdmin()
+	s.createTestUser("10001", "john_doe")
+
+	body, status := s.request("GET", "/admin/users/search?field=actor&actor=jonh_doe", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), `id="actor-results"`)
+	s.Contains(string(body), "john_doe@example.com")
+	s.Contains(string(body), "/admin/users/picker?field=actor&amp;value=john_doe")
+
+	body, status = s.request("GET", "/admin/users/search?field=actor&actor=zzzz", testToken, nil)
+	s.Equal(http.StatusOK, status)
+	s.Contains(string(body), "No matching users")
+
+	res := s.requestResponse("GET", "/admin/users/picker?field=actor&value=john_doe", testToken, nil)
+	s.Equal(http.StatusOK, res.Code)
+	s.Equal("userPicked", res.Header().Get("HX-Trigger-After-Settle"))
+	s.Contains(res.Body.String(), `value="john_doe"`)
+
+	_, status = s.request("GET", "/admin/users/search?field=%22x&actor=john", testToken, nil)
+	s.Equal(http.StatusBadRequest, status)
+}
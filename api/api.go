@@ -36,6 +36,9 @@ type AppError struct {
 	// user-facing error message
 	Message string `json:"message"`
 
+	// invalid input fields, each with a user-facing message, provided for validation errors
+	Fields map[string]string `json:"fields,omitempty"`
+
 	// Extra data providing detail about the error condition, only provided in development environment
 	Extras map[string]any `json:"extras,omitempty"`
 
@@ -6,6 +6,8 @@ var (
 	// General
 
 	ErrorInvalidRequestBody = ErrorKey{"ErrorInvalidRequestBody"}
+	ErrorInvalidQueryParam  = ErrorKey{"ErrorInvalidQueryParam"}
+	ErrorInvalidInput       = ErrorKey{"ErrorInvalidInput"}
 	ErrorClearingSession    = ErrorKey{"ErrorClearingSession"}
 	ErrorRenderingTemplate  = ErrorKey{"ErrorRenderingTemplate"}
 
@@ -14,6 +16,7 @@ var (
 	ErrorInternal         = ErrorKey{"ErrorInternal"}
 	ErrorNotFound         = ErrorKey{"ErrorNotFound"}
 	ErrorNotAuthenticated = ErrorKey{"ErrorNotAuthenticated"}
+	ErrorNotAuthorized    = ErrorKey{"ErrorNotAuthorized"}
 
 	// Authentication
 
@@ -27,4 +30,19 @@ var (
 
 	ErrorUserNotFound      = ErrorKey{"ErrorUserNotFound"}
 	ErrorPasswordSetFailed = ErrorKey{"ErrorPasswordSetFailed"}
+	ErrorModifyingSelf     = ErrorKey{"ErrorModifyingSelf"}
+	ErrorUserAlreadyExists = ErrorKey{"ErrorUserAlreadyExists"}
+	ErrorUserNotDeleted    = ErrorKey{"ErrorUserNotDeleted"}
+	ErrorUserChanged       = ErrorKey{"ErrorUserChanged"}
+	ErrorImportInvalidFile = ErrorKey{"ErrorImportInvalidFile"}
+	ErrorInvalidEmailToken = ErrorKey{"ErrorInvalidEmailToken"}
+
+	// Data export
+
+	ErrorInvalidDownloadToken = ErrorKey{"ErrorInvalidDownloadToken"}
+
+	// SCIM
+
+	ErrorSCIMInvalidFilter = ErrorKey{"ErrorSCIMInvalidFilter"}
+	ErrorSCIMInvalidPatch  = ErrorKey{"ErrorSCIMInvalidPatch"}
 )
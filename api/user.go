@@ -0,0 +1,43 @@
+package api
+
+import "time"
+
+// User is a user account as presented by the REST API
+// swagger:model
+type User struct {
+	ID          int       `json:"id"`
+	EmployeeID  string    `json:"employee_id"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	DisplayName string    `json:"display_name"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Active      bool      `json:"active"`
+	Locked      bool      `json:"locked"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserList is one page of a list of users
+// swagger:model
+type UserList struct {
+	Users []User `json:"users"`
+
+	// total number of users matching the filter, of which this is one page
+	Total int `json:"total"`
+
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// UserInput is the request body for creating or updating a user
+// swagger:model
+type UserInput struct {
+	EmployeeID  string `json:"employee_id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+}
@@ -0,0 +1,181 @@
+package app
+
+import "github.com/a-h/templ"
+
+// UserView is a display-ready representation of a user record
+type UserView struct {
+	ID          string
+	EmployeeID  string
+	FirstName   string
+	LastName    string
+	DisplayName string
+	Username    string
+	Email       string
+	LastLogin   string
+	Active      bool
+	Locked      bool
+	Admin       bool
+	Deleted     bool
+
+	// Self is true if this is the user viewing the page
+	Self bool
+
+	// Version identifies the saved state of the user, to detect changes made by someone else during an edit
+	Version string
+
+	// Attributes lists all registered custom attributes, with the user's values
+	Attributes []UserAttributeView
+}
+
+// UserEditView holds the values and validation errors of the user edit form
+type UserEditView struct {
+	User   UserView
+	Errors map[string]string
+
+	// Conflict, if not nil, describes changes saved by someone else while the form was open
+	Conflict *UserConflictView
+}
+
+// UserConflictView describes a user that was changed by someone else while it was being edited
+type UserConflictView struct {
+	// Version is the version of the saved user, which is sent to overwrite it
+	Version string
+	Changes []UserFieldConflictView
+}
+
+// UserFieldConflictView shows a field of the user edit form whose saved value differs from the value entered
+type UserFieldConflictView struct {
+	Label  string
+	Saved  string
+	Edited string
+}
+
+// UserTableView holds one page of the admin user list
+type UserTableView struct {
+	Users      []UserView
+	Search     string
+	Deleted    bool
+	Sort       TableSort
+	Pagination Pagination
+
+	// ExportURL downloads all users matching the current search and sort as CSV
+	ExportURL string
+}
+
+// AdminUsersView holds the data for the admin user management page
+type AdminUsersView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+	Table         UserTableView
+
+	// Filters lists the custom attributes the list may be filtered by
+	Filters []AttributeFilterView
+}
+
+// UserImportView holds the data for the admin user import page
+type UserImportView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+}
+
+// UserImportPreviewView lists what an import file does to each user, before or after it is applied
+type UserImportPreviewView struct {
+	Rows      []UserImportRowView
+	Created   int
+	Updated   int
+	Unchanged int
+	Invalid   int
+	Applied   bool
+
+	// CSV is the content of the uploaded file, submitted again to apply the import after the preview
+	CSV string
+
+	// Error is set if the file could not be read
+	Error string
+}
+
+// UserImportRowView is the outcome of one row of an import file
+type UserImportRowView struct {
+	Line       int
+	Action     string
+	EmployeeID string
+	Username   string
+	Changes    []FieldChangeView
+	Errors     []string
+}
+
+// FieldChangeView is a change to one field of a user
+type FieldChangeView struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// AuditEventView is a display-ready representation of an audit log entry
+type AuditEventView struct {
+	Time         string
+	Actor        string
+	Impersonator string
+	Action       string
+	Target       string
+	Before       string
+	After        string
+	IP           string
+	RequestID    string
+}
+
+// AuditFilterView holds the values of the audit log filter form. From and To are dates in the form YYYY-MM-DD.
+type AuditFilterView struct {
+	Action     string
+	Actor      string
+	TargetType string
+	TargetID   string
+	From       string
+	To         string
+}
+
+// AuditTableView holds one page of the audit log
+type AuditTableView struct {
+	Events     []AuditEventView
+	Pagination Pagination
+
+	// ExportURL downloads all events matching the current filter as CSV
+	ExportURL string
+}
+
+// AdminAuditView holds the data for the admin audit log page
+type AdminAuditView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+	Filter        AuditFilterView
+	Actions       []string
+	TargetTypes   []string
+	Table         AuditTableView
+}
+
+// UserPickerView holds the state of a user type-ahead field. The field submits the username of the chosen user, or
+// whatever text was typed, under the name Field.
+type UserPickerView struct {
+	Field       string
+	Value       string
+	Placeholder string
+
+	// Results are the users matching the text typed so far. Searched is true once a search has been made, so that an
+	// empty result can be shown as such.
+	Results  []UserOptionView
+	Searched bool
+}
+
+// UserOptionView is one of the users offered by a user type-ahead field
+type UserOptionView struct {
+	Name       string
+	Username   string
+	Email      string
+	EmployeeID string
+
+	// SelectURL renders the type-ahead field with this user chosen
+	SelectURL string
+}
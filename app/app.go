@@ -3,6 +3,8 @@ package app
 import (
 	"database/sql"
 	"fmt"
+	"io/fs"
+	"os"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/briskt/go-htmx-app/email"
 	"github.com/briskt/go-htmx-app/log"
+	"github.com/briskt/go-htmx-app/public"
 )
 
 const (
@@ -36,6 +39,12 @@ func (c ContextKey) Get(ctx echo.Context) any {
 
 const AccessTokenLifetime = 30 * time.Minute
 
+// EmailChangeLifetime is the time a user has to confirm a change of email address
+const EmailChangeLifetime = 24 * time.Hour
+
+// DataExportLifetime is the time a personal data export is available for download
+const DataExportLifetime = 7 * 24 * time.Hour
+
 func init() {
 	readEnv()
 }
@@ -50,8 +59,18 @@ func OpenDatabase() (*sql.DB, error) {
 	return db, err
 }
 
+// EmailAssets returns the file system of the email images and attachment files: the EmailAssetsDir directory if it is
+// set, or else the embedded public assets
+func EmailAssets() fs.FS {
+	if Env.EmailAssetsDir != "" {
+		return os.DirFS(Env.EmailAssetsDir)
+	}
+	return public.EFS()
+}
+
 func NewEmailService() (email.Service, error) {
-	emailService := email.NewFake()
+	assets := EmailAssets()
+	emailService := email.NewFake(email.FakeConfig{Assets: assets})
 	switch Env.EmailService {
 	case "mailgun":
 		log.WithFields(log.Fields{"domain": Env.MailgunDomain}).Info("using Mailgun")
@@ -59,15 +78,33 @@ func NewEmailService() (email.Service, error) {
 			Domain:       Env.MailgunDomain,
 			PrivateKey:   Env.MailgunAPIKey,
 			SandboxEmail: Env.SandboxEmail,
+			Assets:       assets,
 		})
 	case "ses":
 		log.WithFields(log.Fields{"region": Env.AWSRegion, "accessKeyID": Env.AWSAccessKeyID}).
 			Infof("using AWS SES")
 		var err error
-		emailService, err = email.NewSES(Env.SandboxEmail)
+		emailService, err = email.NewSES(email.SESConfig{SandboxEmail: Env.SandboxEmail, Assets: assets})
 		if err != nil {
 			return nil, fmt.Errorf("error creating SES email service: %w", err)
 		}
+	case "smtp":
+		log.WithFields(log.Fields{"host": Env.SMTPHost, "port": Env.SMTPPort, "tls": Env.SMTPTLS}).Info("using SMTP")
+		var err error
+		emailService, err = email.NewSMTP(email.SMTPConfig{
+			Host:          Env.SMTPHost,
+			Port:          Env.SMTPPort,
+			TLSMode:       Env.SMTPTLS,
+			Username:      Env.SMTPUsername,
+			Password:      Env.SMTPPassword,
+			AuthMechanism: Env.SMTPAuth,
+			Timeout:       time.Duration(Env.SMTPTimeoutSeconds) * time.Second,
+			SandboxEmail:  Env.SandboxEmail,
+			Assets:        assets,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating SMTP email service: %w", err)
+		}
 	}
 	return emailService, nil
 }
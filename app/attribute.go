@@ -0,0 +1,219 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// AttributeType is the type of value of a custom user attribute
+type AttributeType string
+
+const (
+	AttributeText   AttributeType = "text"   // a string
+	AttributeNumber AttributeType = "number" // an integer
+	AttributeBool   AttributeType = "bool"   // true or false
+	AttributeDate   AttributeType = "date"   // a date without time, stored as YYYY-MM-DD
+)
+
+// AttributeVisibility controls who may see and change a custom user attribute. Admins may see all attributes.
+type AttributeVisibility string
+
+const (
+	AttributeAdminOnly AttributeVisibility = "admin"    // seen and changed only by admins
+	AttributeVisible   AttributeVisibility = "visible"  // shown on the user's profile, changed only by admins
+	AttributeEditable  AttributeVisibility = "editable" // changed by the user on their profile, or by admins
+)
+
+// UserAttribute declares a custom user attribute. The values are stored together in the attributes column of the users
+// table, keyed by Name, so adding an attribute does not need a migration.
+type UserAttribute struct {
+	// Name is the key of the stored value
+	Name       string
+	Label      string
+	Type       AttributeType
+	Visibility AttributeVisibility
+
+	// Required rejects an empty value when the attribute is changed in a form
+	Required bool
+
+	// MaxLength, if not zero, is the maximum number of characters of a text value
+	MaxLength int
+
+	// Options, if not empty, lists the allowed values of a text attribute
+	Options []string
+
+	// SAMLAttribute, if not empty, is the name of the SAML assertion attribute the value is copied from at each login.
+	// A SAML-sourced attribute cannot be changed in the app.
+	SAMLAttribute string
+}
+
+// UserAttributes is the registry of custom user attributes, in the order they are shown. Values of attributes that
+// are not listed here are kept, but not shown or changed.
+var UserAttributes = []UserAttribute{
+	{
+		Name:          "office",
+		Label:         "Office",
+		Type:          AttributeText,
+		Visibility:    AttributeVisible,
+		MaxLength:     100,
+		SAMLAttribute: "physicalDeliveryOfficeName",
+	},
+	{
+		Name:       "cost_center",
+		Label:      "Cost center",
+		Type:       AttributeText,
+		Visibility: AttributeAdminOnly,
+		MaxLength:  20,
+	},
+	{
+		Name:       "manager",
+		Label:      "Manager",
+		Type:       AttributeText,
+		Visibility: AttributeVisible,
+		MaxLength:  100,
+	},
+}
+
+// FindUserAttribute returns the registered custom user attribute with the given name
+func FindUserAttribute(name string) (UserAttribute, bool) {
+	i := slices.IndexFunc(UserAttributes, func(a UserAttribute) bool { return a.Name == name })
+	if i < 0 {
+		return UserAttribute{}, false
+	}
+	return UserAttributes[i], true
+}
+
+// FieldName returns the name of the attribute's form fields, which is prefixed to keep it apart from the fixed fields
+func (a UserAttribute) FieldName() string {
+	return "attribute_" + a.Name
+}
+
+// SAMLSourced returns true if the value is copied from the SAML assertion at login
+func (a UserAttribute) SAMLSourced() bool {
+	return a.SAMLAttribute != ""
+}
+
+// VisibleToUser returns true if the attribute is shown on the user's own profile
+func (a UserAttribute) VisibleToUser() bool {
+	return a.Visibility == AttributeVisible || a.Visibility == AttributeEditable
+}
+
+// EditableByUser returns true if the user may change the attribute on their own profile
+func (a UserAttribute) EditableByUser() bool {
+	return a.Visibility == AttributeEditable && !a.SAMLSourced()
+}
+
+// EditableByAdmin returns true if an admin may change the attribute
+func (a UserAttribute) EditableByAdmin() bool {
+	return !a.SAMLSourced()
+}
+
+// Parse converts a form value to a value of the attribute's type and checks it. An empty form value, or "false" for a
+// bool, is returned as nil, meaning no value. The error message is suitable for showing to the user.
+func (a UserAttribute) Parse(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || (a.Type == AttributeBool && s == "false") {
+		if a.Required {
+			return nil, fmt.Errorf("%s is required", a.Label)
+		}
+		return nil, nil
+	}
+
+	var value any
+	switch a.Type {
+	case AttributeText:
+		value = s
+	case AttributeNumber:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", a.Label)
+		}
+		value = n
+	case AttributeBool:
+		if s != "true" {
+			return nil, fmt.Errorf("%s must be true or false", a.Label)
+		}
+		value = true
+	case AttributeDate:
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a date, like 2006-01-02", a.Label)
+		}
+		value = t
+	default:
+		return nil, fmt.Errorf("%s has unknown type %q", a.Label, a.Type)
+	}
+	if err := a.Check(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Check returns an error if value is not a valid value of the attribute. The value must be a string, int, bool or
+// time.Time, according to the attribute's type.
+func (a UserAttribute) Check(value any) error {
+	ok := false
+	switch a.Type {
+	case AttributeText:
+		var s string
+		if s, ok = value.(string); ok {
+			if a.MaxLength > 0 && utf8.RuneCountInString(s) > a.MaxLength {
+				return fmt.Errorf("%s must be at most %d characters", a.Label, a.MaxLength)
+			}
+			if len(a.Options) > 0 && !slices.Contains(a.Options, s) {
+				return fmt.Errorf("%s must be one of: %s", a.Label, strings.Join(a.Options, ", "))
+			}
+		}
+	case AttributeNumber:
+		_, ok = value.(int)
+	case AttributeBool:
+		_, ok = value.(bool)
+	case AttributeDate:
+		_, ok = value.(time.Time)
+	}
+	if !ok {
+		return fmt.Errorf("%s must be a %s, not %T", a.Label, a.Type, value)
+	}
+	return nil
+}
+
+// Format converts a value of the attribute to its form value. A nil value is an empty string.
+func (a UserAttribute) Format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.DateOnly)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// UserAttributeView is a custom user attribute and its value, ready to be shown or edited in a form
+type UserAttributeView struct {
+	Name      string
+	FieldName string
+	Label     string
+	Type      AttributeType
+	Value     string
+	Options   []string
+
+	// Editable is true if the viewer may change the value
+	Editable bool
+
+	// SAMLSourced is true if the value is copied from the identity provider at login
+	SAMLSourced bool
+}
+
+// AttributeFilterView is a custom user attribute that the admin user list may be filtered by, with the value chosen
+type AttributeFilterView struct {
+	FieldName string
+	Label     string
+	Type      AttributeType
+	Value     string
+	Options   []string
+}
@@ -0,0 +1,42 @@
+package app
+
+import "github.com/a-h/templ"
+
+// DevMailView holds the data for the developer mail inbox, which shows the messages captured by the fake email service
+type DevMailView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+	Inbox         DevMailInboxView
+}
+
+// DevMailInboxView lists the captured messages, newest first, and shows the selected one
+type DevMailInboxView struct {
+	Messages []DevMailMessageView
+
+	// Selected is the message shown, or nil if the inbox is empty
+	Selected *DevMailMessageView
+}
+
+// DevMailMessageView is a message captured by the fake email service
+type DevMailMessageView struct {
+	ID      string
+	From    string
+	To      string
+	Subject string
+	SentAt  string
+	Text    string
+
+	// HTMLURL serves the HTML part, with the inline images linked to their URLs
+	HTMLURL string
+	RawURL  string
+
+	// Images lists the inline images by content ID
+	Images []DevMailImageView
+}
+
+// DevMailImageView is an inline image of a captured message
+type DevMailImageView struct {
+	ContentID string
+	URL       string
+}
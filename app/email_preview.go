@@ -0,0 +1,58 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/a-h/templ"
+)
+
+// EmailPreviewView holds the data for the email template preview page
+type EmailPreviewView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+	Templates     []string
+	Preview       EmailTemplatePreviewView
+}
+
+// EmailTemplatePreviewView is a message template rendered with its sample fields, as it would be sent to the viewer
+type EmailTemplatePreviewView struct {
+	Template string
+	To       string
+	Subject  string
+	Text     string
+
+	// HTMLURL serves the HTML part, for showing in a frame
+	HTMLURL string
+
+	// SendURL sends the rendered message to the viewer
+	SendURL string
+
+	Size MIMESizeView
+}
+
+// MIMESizeView summarizes the size of a message as it is sent
+type MIMESizeView struct {
+	Total  string
+	Text   string
+	HTML   string
+	Images []MIMEImageSizeView
+}
+
+// MIMEImageSizeView is the size of an inline image
+type MIMEImageSizeView struct {
+	ContentID string
+	Size      string
+}
+
+// FormatByteSize formats a number of bytes for display, like "1.5 kB"
+func FormatByteSize(n int) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%d B", n)
+	case n < 1000*1000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1000)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1000*1000))
+	}
+}
@@ -24,11 +24,44 @@ var Env struct {
 	HelpCenterURL  string   `split_words:"true" default:"https://example.com"`
 	LogLevel       string   `split_words:"true" default:"debug"`
 	SandboxEmail   string   `split_words:"true" default:""`
+	SCIMAccessKeys []string `split_words:"true"`
 	SupportEmail   string   `split_words:"true" default:"support@example.com"`
 	SupportName    string   `split_words:"true" default:"Help Desk"`
 
 	SessionSecret string `split_words:"true"`
 
+	// A user who has not logged in for InactiveWarnDays is sent a warning, and is deactivated InactiveDeactivateDays
+	// after the warning. An inactive user is purged InactiveRetentionDays after the last change to the account, either
+	// by removing personal data ("anonymize") or by deleting the record ("delete"). A value of 0 days disables a step,
+	// and disabling the warning also disables deactivation.
+	InactiveWarnDays       int    `split_words:"true" default:"180"`
+	InactiveDeactivateDays int    `split_words:"true" default:"30"`
+	InactiveRetentionDays  int    `split_words:"true" default:"365"`
+	InactivePurgeMode      string `split_words:"true" default:"anonymize"`
+
+	// HRFeedSource is the file path or http(s) URL of the HR extract read by the directory sync. The sync is skipped if
+	// it is empty. HRFeedFormat is "json" or "csv"; if empty, it is determined by the file extension.
+	HRFeedSource string `split_words:"true"`
+	HRFeedFormat string `split_words:"true"`
+
+	// HRFeedMaxDeactivatePercent aborts the sync if more than this percentage of active users would be deactivated
+	HRFeedMaxDeactivatePercent int `split_words:"true" default:"5"`
+
+	// DataExportIntervalSeconds is how often the server checks for pending personal data exports. 0 disables the
+	// check in the server, leaving the exports to the cron job.
+	DataExportIntervalSeconds int `split_words:"true" default:"60"`
+
+	// EmailOutboxIntervalSeconds is how often the server sends the messages waiting in the email outbox. 0 disables
+	// the worker in the server, leaving the outbox to the cron job.
+	EmailOutboxIntervalSeconds int `split_words:"true" default:"10"`
+
+	// EmailMaxAttempts is the number of times a message is tried before it is marked as dead
+	EmailMaxAttempts int `split_words:"true" default:"8"`
+
+	// EmailAssetsDir is a directory from which the email images and attachment files are read, such as "public" to
+	// try changes to the brand images without rebuilding. If empty, the assets embedded in the binary are used.
+	EmailAssetsDir string `split_words:"true"`
+
 	AWSAccessKeyID     string `split_words:"true"`
 	AWSRegion          string `split_words:"true"`
 	AWSSecretAccessKey string `split_words:"true"`
@@ -36,6 +69,16 @@ var Env struct {
 	MailgunDomain string `split_words:"true"`
 	MailgunAPIKey string `split_words:"true"`
 
+	// SMTPTLS is "starttls", "tls" (implicit TLS, usually on port 465) or "none". SMTPAuth is "plain" or "login"; the
+	// credentials are only sent if both SMTPUsername and SMTPPassword are set.
+	SMTPHost           string `split_words:"true"`
+	SMTPPort           int    `split_words:"true" default:"587"`
+	SMTPTLS            string `envconfig:"SMTP_TLS" default:"starttls"`
+	SMTPAuth           string `split_words:"true" default:"plain"`
+	SMTPUsername       string `split_words:"true"`
+	SMTPPassword       string `split_words:"true"`
+	SMTPTimeoutSeconds int    `split_words:"true" default:"30"`
+
 	PostgresUser     string `split_words:"true"`
 	PostgresPassword string `split_words:"true"`
 	PostgresHost     string `split_words:"true"`
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // embed the time zone database, so user time zones work in minimal containers
+)
+
+const (
+	DefaultLanguage = "en"
+	DefaultTimeZone = "UTC"
+)
+
+// Language is a language that users may choose for dates and messages
+type Language struct {
+	Code string
+	Name string
+}
+
+// Languages lists the supported languages, by ISO 639-1 code
+var Languages = []Language{
+	{Code: "en", Name: "English"},
+	{Code: "es", Name: "Español"},
+	{Code: "fr", Name: "Français"},
+}
+
+// IsSupportedLanguage returns true if code is one of the Languages
+func IsSupportedLanguage(code string) bool {
+	for _, l := range Languages {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+var monthNames = map[string][12]string{
+	"es": {"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre",
+		"noviembre", "diciembre"},
+	"fr": {"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre",
+		"novembre", "décembre"},
+}
+
+var weekdayNames = map[string][7]string{
+	"es": {"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	"fr": {"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+}
+
+// FormatDate returns a long-form, user-friendly date string in the given time zone and language. An unknown time zone
+// is treated as UTC, and an unsupported language as English.
+func FormatDate(t time.Time, timeZone, language string) string {
+	if loc, err := time.LoadLocation(timeZone); err == nil {
+		t = t.In(loc)
+	} else {
+		t = t.UTC()
+	}
+
+	weekday := weekdayNames[language][t.Weekday()]
+	month := monthNames[language][t.Month()-1]
+	switch language {
+	case "es":
+		return fmt.Sprintf("%s, %d de %s de %d", weekday, t.Day(), month, t.Year())
+	case "fr":
+		return fmt.Sprintf("%s %d %s %d", weekday, t.Day(), month, t.Year())
+	}
+	return t.Format("Monday, January 2, 2006")
+}
+
+// FormatDateTime returns a date and time, to the second, in the given time zone. An unknown time zone is treated as
+// UTC.
+func FormatDateTime(t time.Time, timeZone string) string {
+	if loc, err := time.LoadLocation(timeZone); err == nil {
+		t = t.In(loc)
+	} else {
+		t = t.UTC()
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
@@ -3,6 +3,7 @@ package app
 import "github.com/a-h/templ"
 
 type ProfileView struct {
+	Admin         bool
 	DisplayName   string
 	Enabled       bool
 	HelpCenterURL templ.SafeURL
@@ -11,3 +12,42 @@ type ProfileView struct {
 	UserID        string
 	Username      string
 }
+
+// ProfileEditView holds the data for the profile page
+type ProfileEditView struct {
+	AppName       string
+	DisplayName   string
+	HelpCenterURL templ.SafeURL
+	Form          ProfileFormView
+	EmailForm     EmailChangeFormView
+
+	// Notice is an optional message shown at the top of the page
+	Notice string
+}
+
+// ProfileFormView holds the values and validation errors of the profile form
+type ProfileFormView struct {
+	Username           string
+	Email              string
+	DisplayName        string
+	TimeZone           string
+	Language           string
+	EmailNotifications bool
+	Languages          []Language
+	Errors             map[string]string
+
+	// Attributes lists the custom attributes shown to the user, with their values
+	Attributes []UserAttributeView
+
+	// Saved is true if the form was just saved without errors
+	Saved bool
+}
+
+// EmailChangeFormView holds the values and validation errors of the email change form
+type EmailChangeFormView struct {
+	NewEmail string
+	Errors   map[string]string
+
+	// SentTo is the address a confirmation link was just sent to
+	SentTo string
+}
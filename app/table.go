@@ -1,6 +1,70 @@
 package app
 
+import "github.com/a-h/templ"
+
 type TableStructureItem[T any] struct {
 	Label      string
 	RenderCell func(data T) string
+
+	// RenderComponent, if not nil, is used in place of RenderCell to render the cell content
+	RenderComponent func(data T) templ.Component
+
+	// SortKey, if not empty, makes the column sortable using this key
+	SortKey string
+}
+
+// TableSort holds the current sort order of a table and builds the links used to change it
+type TableSort struct {
+	Key  string
+	Desc bool
+
+	// Target is the CSS selector of the element replaced by the re-sorted table
+	Target string
+
+	// URL returns the address of the table sorted by key, in descending order if desc is true
+	URL func(key string, desc bool) string
+}
+
+// Pagination holds the position of the current page in a list and builds the links to other pages
+type Pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+
+	// Target is the CSS selector of the element replaced by the requested page
+	Target string
+
+	// URL returns the address of the given page
+	URL func(page int) string
+}
+
+// NumPages returns the total number of pages, which is at least one
+func (p Pagination) NumPages() int {
+	if p.PageSize < 1 || p.Total <= p.PageSize {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+// HasPrev returns true if there is a page before the current page
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext returns true if there is a page after the current page
+func (p Pagination) HasNext() bool {
+	return p.Page < p.NumPages()
+}
+
+// First returns the 1-based position of the first item on the current page, or 0 if there are no items
+func (p Pagination) First() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return (p.Page-1)*p.PageSize + 1
+}
+
+// Last returns the 1-based position of the last item on the current page
+func (p Pagination) Last() int {
+	return min(p.Page*p.PageSize, p.Total)
 }
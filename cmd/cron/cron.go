@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
@@ -23,15 +25,51 @@ func main() {
 		log.Fatalf("Failed to create email service: %v", err)
 	}
 
+	failed := false
+	for _, job := range []struct {
+		name string
+		run  func(ctx context.Context, tx *sql.Tx) error
+	}{
+		{"HR feed sync", core.SyncHRFeed},
+		{"periodic messages", func(ctx context.Context, tx *sql.Tx) error {
+			core.SendPeriodicMessages(ctx, tx)
+			return nil
+		}},
+		{"account lifecycle", core.EnforceAccountLifecycle},
+		{"data exports", core.ProcessAndPurgeDataExports},
+	} {
+		if err = runJob(db, job.run); err != nil {
+			log.Errorf("%s failed: %v", job.name, err)
+			failed = true
+		}
+	}
+
+	// last, to send the messages queued by the other jobs. It manages its own transactions.
+	if _, err = core.ProcessEmailOutbox(context.Background(), db, emailSvc, time.Now()); err != nil {
+		log.Errorf("email outbox failed: %v", err)
+		failed = true
+	}
+	if failed {
+		log.Fatal("one or more cron jobs failed")
+	}
+}
+
+// runJob runs a job in its own database transaction, so a failed job doesn't undo the work of the others
+func runJob(db *sql.DB, job func(ctx context.Context, tx *sql.Tx) error) error {
 	tx, err := db.Begin()
 	if err != nil {
 		log.Fatalf("Failed to create database transaction: %v", err)
 	}
 
-	core.SendPeriodicMessages(context.Background(), tx, emailSvc)
+	if err = job(context.Background(), tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Errorf("Failed to roll back database transaction: %v", rbErr)
+		}
+		return err
+	}
 
-	err = tx.Commit()
-	if err != nil {
+	if err = tx.Commit(); err != nil {
 		log.Fatalf("Failed to commit database transaction: %v", err)
 	}
+	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/briskt/go-htmx-app/action"
 	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
 	"github.com/briskt/go-htmx-app/log"
 )
 
@@ -43,6 +45,16 @@ func main() {
 		log.Fatalf("error creating email service: %s", err)
 	}
 
+	if app.Env.DataExportIntervalSeconds > 0 {
+		interval := time.Duration(app.Env.DataExportIntervalSeconds) * time.Second
+		go core.RunDataExportWorker(context.Background(), db, interval)
+	}
+
+	if app.Env.EmailOutboxIntervalSeconds > 0 {
+		interval := time.Duration(app.Env.EmailOutboxIntervalSeconds) * time.Second
+		go core.RunEmailWorker(context.Background(), db, emailService, interval)
+	}
+
 	a := action.NewApp(&action.Config{
 		DB:           db,
 		EmailService: emailService,
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/core"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const usage = `Usage:
+  users import [-apply] FILE     preview, or with -apply save, the users in a CSV file
+  users export [flags]           write users to a CSV file
+  users duplicates               list usernames, emails and employee IDs shared by more than one user
+`
+
+func main() {
+	log.Init()
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = importCommand(os.Args[2:])
+	case "export":
+		err = exportCommand(os.Args[2:])
+	case "duplicates":
+		err = duplicatesCommand()
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importCommand previews the import of a CSV file. With -apply, the changes are saved if every row is valid.
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	apply := flags.Bool("apply", false, "save the changes; without this flag, only a preview is shown")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import requires one file name\n%s", usage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	return withTransaction(func(ctx context.Context, tx *sql.Tx) error {
+		result, err := core.ImportUsers(ctx, tx, file, *apply)
+		if err != nil {
+			return err
+		}
+		printImportResult(os.Stdout, result)
+
+		switch {
+		case result.Invalid > 0:
+			return fmt.Errorf("%d invalid rows, no changes were saved", result.Invalid)
+		case !*apply:
+			fmt.Println("Preview only. Run again with -apply to save the changes.")
+		}
+		return nil
+	})
+}
+
+// exportCommand writes the users matching the filter flags as CSV
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "output file; standard output if omitted")
+	search := flags.String("q", "", "search text matched against names, username, email and employee ID")
+	active := flags.String("active", "", "true or false to export only active or inactive users")
+	locked := flags.String("locked", "", "true or false to export only locked or unlocked users")
+	sortBy := flags.String("sort", data.UserSortName, "sort by name, username, email, employee_id or last_login")
+	desc := flags.Bool("desc", false, "sort in descending order")
+	_ = flags.Parse(args)
+
+	filter := data.UserFilter{Search: *search, SortBy: *sortBy, SortDesc: *desc}
+	var err error
+	if filter.Active, err = parseNullBool(*active); err != nil {
+		return fmt.Errorf("invalid -active flag: %w", err)
+	}
+	if filter.Locked, err = parseNullBool(*locked); err != nil {
+		return fmt.Errorf("invalid -locked flag: %w", err)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer w.Close()
+	}
+
+	return withTransaction(func(ctx context.Context, tx *sql.Tx) error {
+		return core.ExportUsers(ctx, tx, w, filter)
+	})
+}
+
+// duplicatesCommand lists the values that must be unique but are shared by more than one user, ignoring case. These
+// must be resolved before the migration that adds the unique indexes can run.
+func duplicatesCommand() error {
+	return withTransaction(func(ctx context.Context, tx *sql.Tx) error {
+		duplicates, err := data.FindDuplicateUsers(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(duplicates) == 0 {
+			fmt.Println("No duplicates found.")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "FIELD\tVALUE\tUSER IDS")
+		for _, d := range duplicates {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Field, d.Value, d.UserIDs)
+		}
+		_ = tw.Flush()
+		return fmt.Errorf("%d duplicate values found", len(duplicates))
+	})
+}
+
+// withTransaction calls fn in a database transaction, which is committed only if fn succeeds
+func withTransaction(fn func(ctx context.Context, tx *sql.Tx) error) error {
+	db, err := app.OpenDatabase()
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to create database transaction: %w", err)
+	}
+
+	if err = fn(context.Background(), tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database transaction: %w", err)
+	}
+	return nil
+}
+
+func printImportResult(w io.Writer, result core.ImportResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tACTION\tEMPLOYEE ID\tUSERNAME\tDETAILS")
+	for _, row := range result.Rows {
+		var details []string
+		for _, change := range row.Changes {
+			details = append(details, fmt.Sprintf("%s: %q -> %q", change.Field, change.Old, change.New))
+		}
+		if len(row.Errors) > 0 {
+			details = append(details, row.Errors.Error())
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", row.Line, row.Action, row.EmployeeID, row.Username,
+			strings.Join(details, "; "))
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\n%d new, %d changed, %d unchanged, %d invalid\n",
+		result.Created, result.Updated, result.Unchanged, result.Invalid)
+}
+
+func parseNullBool(v string) (sql.NullBool, error) {
+	if v == "" {
+		return sql.NullBool{}, nil
+	}
+	b, err := strconv.ParseBool(v)
+	return sql.NullBool{Bool: b, Valid: err == nil}, err
+}
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/briskt/go-htmx-app/data"
+)
+
+// Audit event actions
+const (
+	AuditLogin              = "auth.login"
+	AuditLogout             = "auth.logout"
+	AuditTokenCreate        = "token.create"
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserLock           = "user.lock"
+	AuditUserUnlock         = "user.unlock"
+	AuditUserActivate       = "user.activate"
+	AuditUserDeactivate     = "user.deactivate"
+	AuditUserDelete         = "user.delete"
+	AuditUserRestore        = "user.restore"
+	AuditUserPurge          = "user.purge"
+	AuditUserAnonymize      = "user.anonymize"
+	AuditEmailChange        = "user.email_change"
+	AuditProfileUpdate      = "profile.update"
+	AuditDataExportRequest  = "data_export.request"
+	AuditDataExportDownload = "data_export.download"
+)
+
+// AuditActions lists all audit event actions, for filtering the audit log
+var AuditActions = []string{
+	AuditLogin,
+	AuditLogout,
+	AuditTokenCreate,
+	AuditUserCreate,
+	AuditUserUpdate,
+	AuditUserLock,
+	AuditUserUnlock,
+	AuditUserActivate,
+	AuditUserDeactivate,
+	AuditUserDelete,
+	AuditUserRestore,
+	AuditUserPurge,
+	AuditUserAnonymize,
+	AuditEmailChange,
+	AuditProfileUpdate,
+	AuditDataExportRequest,
+	AuditDataExportDownload,
+}
+
+// Audit event target types
+const (
+	AuditTargetUser       = "user"
+	AuditTargetToken      = "token"
+	AuditTargetDataExport = "data_export"
+)
+
+// AuditInfo identifies who is acting, and from where, for the audit events recorded while handling a request. A zero
+// ActorID means the action was not taken by a signed-in user, for example by an API client or a scheduled job.
+// ImpersonatorID is the admin acting as the actor, or zero if the actor is acting as themself.
+type AuditInfo struct {
+	ActorID        int
+	ImpersonatorID int
+	IP             string
+	RequestID      string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns a copy of ctx that carries the audit info
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// AuditInfoFromContext returns the audit info carried by ctx, or an empty AuditInfo if there is none
+func AuditInfoFromContext(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	return info
+}
+
+// AuditEvent describes an action to record in the audit log. Before and After are encoded as JSON objects and should
+// hold only the values that changed.
+type AuditEvent struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+
+	// ActorID, if not zero, overrides the actor in the context, for actions such as a login that happen before the
+	// actor is known
+	ActorID int
+}
+
+// RecordAudit adds an event to the audit log, with the actor, IP address and request ID from the context. It is meant
+// to run in the same transaction as the action, so the event is kept only if the action is.
+func RecordAudit(ctx context.Context, tx *sql.Tx, event AuditEvent) error {
+	info := AuditInfoFromContext(ctx)
+	input := data.AuditEventInput{
+		ActorID:        info.ActorID,
+		ImpersonatorID: info.ImpersonatorID,
+		Action:         event.Action,
+		TargetType:     event.TargetType,
+		TargetID:       event.TargetID,
+		IP:             info.IP,
+		RequestID:      info.RequestID,
+	}
+	if event.ActorID != 0 {
+		input.ActorID = event.ActorID
+	}
+
+	var err error
+	if input.Before, err = marshalAuditValues(event.Before); err != nil {
+		return err
+	}
+	if input.After, err = marshalAuditValues(event.After); err != nil {
+		return err
+	}
+	return data.CreateAuditEvent(ctx, tx, input)
+}
+
+// ListAuditEvents returns a page of audit events matching the filter, newest first, along with the total number of
+// matching events
+func ListAuditEvents(ctx context.Context, tx *sql.Tx, filter data.AuditFilter) ([]data.AuditEvent, int, error) {
+	return data.ListAuditEvents(ctx, tx, filter)
+}
+
+// AuditCSVHeader is the header row of an audit log export file
+var AuditCSVHeader = []string{
+	"time",
+	"actor",
+	"impersonator",
+	"action",
+	"target_type",
+	"target_id",
+	"before",
+	"after",
+	"ip",
+	"request_id",
+}
+
+// ExportAuditEvents writes all audit events matching the filter, newest first, to w as CSV. The filter's Limit and
+// Offset are ignored.
+func ExportAuditEvents(ctx context.Context, tx *sql.Tx, w io.Writer, filter data.AuditFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(AuditCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	filter.Limit = exportPageSize
+	for filter.Offset = 0; ; filter.Offset += exportPageSize {
+		events, total, err := data.ListAuditEvents(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			err = writer.Write([]string{
+				event.CreatedAt.UTC().Format(time.RFC3339),
+				event.ActorUsername,
+				event.ImpersonatorUsername,
+				event.Action,
+				event.TargetType,
+				event.TargetID,
+				string(event.Before),
+				string(event.After),
+				event.Ip,
+				event.RequestID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to write CSV row for audit event %d: %w", event.ID, err)
+			}
+		}
+		if filter.Offset+len(events) >= total || len(events) == 0 {
+			break
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
+
+// createUser creates a user record and records the creation in the audit log
+func createUser(ctx context.Context, tx *sql.Tx, input data.UserCreateInput) (data.User, error) {
+	user, err := data.CreateUser(ctx, tx, input)
+	if err != nil {
+		return user, duplicateUserError(err)
+	}
+
+	err = RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditUserCreate,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		After:      auditUserValues(user),
+	})
+	return user, err
+}
+
+// saveUser saves a changed user record and records the changed fields in the audit log under the given action. If
+// nothing changed, no event is recorded. If the record was changed by someone else since it was read, nothing is saved
+// and the returned error is an ErrorUserChanged AppError.
+func saveUser(ctx context.Context, tx *sql.Tx, action string, user data.User) error {
+	saved, err := data.GetUserIncludingDeleted(ctx, tx, int(user.ID))
+	if err != nil {
+		return err
+	}
+	if err = user.Update(ctx, tx); err != nil {
+		return userUpdateError(err)
+	}
+
+	before, after := auditUserValues(saved), auditUserValues(user)
+	for field, value := range before {
+		if after[field] == value {
+			delete(before, field)
+			delete(after, field)
+		}
+	}
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+
+	return RecordAudit(ctx, tx, AuditEvent{
+		Action:     action,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// recordUserAudit records an action on a user that has no field values to show, such as a deletion
+func recordUserAudit(ctx context.Context, tx *sql.Tx, action string, user data.User) error {
+	return RecordAudit(ctx, tx, AuditEvent{
+		Action:     action,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+	})
+}
+
+// auditUserValues returns the audited fields of a user. Each custom attribute is a separate field, named with an
+// "attributes." prefix.
+func auditUserValues(user data.User) map[string]any {
+	values := map[string]any{
+		"employee_id":         user.EmployeeID,
+		"first_name":          user.FirstName,
+		"last_name":           user.LastName,
+		"display_name":        user.GetDisplayName(),
+		"username":            data.NormalizeUsername(user.Username),
+		"email":               data.NormalizeEmail(user.Email),
+		"active":              user.Active,
+		"locked":              user.Locked,
+		"admin":               user.Admin,
+		"time_zone":           user.TimeZone,
+		"language":            user.Language,
+		"email_notifications": user.EmailNotifications,
+	}
+	for name, value := range user.Attributes() {
+		values["attributes."+name] = value
+	}
+	return values
+}
+
+func marshalAuditValues(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit values: %w", err)
+	}
+	return j, nil
+}
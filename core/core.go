@@ -9,20 +9,10 @@ import (
 
 	"github.com/briskt/go-htmx-app/app"
 	"github.com/briskt/go-htmx-app/data"
-	"github.com/briskt/go-htmx-app/email"
 	"github.com/briskt/go-htmx-app/email/message"
 	"github.com/briskt/go-htmx-app/log"
 )
 
-func SendPeriodicMessages(ctx context.Context, tx *sql.Tx, svc email.Service) {
-}
-
-func commonEmailImages() map[string]string {
-	return map[string]string{
-		"logo": "assets/img/logo.png",
-	}
-}
-
 func commonEmailFields() message.Fields {
 	return message.Fields{
 		"BrandColor":     template.CSS(app.Env.BrandColor),
@@ -34,8 +24,9 @@ func commonEmailFields() message.Fields {
 	}
 }
 
-// sendBatch sends an identical message to a list of users, customized only by the user's email and DisplayName
-func sendBatch(ctx context.Context, tx *sql.Tx, svc email.Service, users []data.User, params message.Params) (int, error) {
+// sendBatch queues an identical message to a list of users, customized only by the user's email, DisplayName and
+// language
+func sendBatch(ctx context.Context, tx *sql.Tx, users []data.User, params message.Params) (int, error) {
 	if len(users) == 0 {
 		return 0, nil
 	}
@@ -43,8 +34,10 @@ func sendBatch(ctx context.Context, tx *sql.Tx, svc email.Service, users []data.
 	numSent := 0
 	for _, user := range users {
 		params.Fields["DisplayName"] = user.GetDisplayName()
-		params.To = message.NewAddress(user.GetEmail(), user.GetDisplayName())
-		err := sendMessage(ctx, tx, svc, int(user.ID), params)
+		params.Fields["Language"] = user.Language
+		params.Locale = user.Language
+		params.To = []message.Address{message.NewAddress(user.GetDisplayName(), user.GetEmail())}
+		err := sendMessage(ctx, tx, int(user.ID), params)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -52,7 +45,7 @@ func sendBatch(ctx context.Context, tx *sql.Tx, svc email.Service, users []data.
 		numSent++
 	}
 	if numSent == 0 {
-		return 0, fmt.Errorf("none of the %d emails in the '%s' batch were sent", len(users), params.Template)
+		return 0, fmt.Errorf("none of the %d emails in the '%s' batch were queued", len(users), params.Template)
 	}
 
 	logEntry := log.WithFields(log.Fields{"numSent": numSent, "numFailed": len(users) - numSent, "template": params.Template})
@@ -60,33 +53,62 @@ func sendBatch(ctx context.Context, tx *sql.Tx, svc email.Service, users []data.
 		logEntry.Error("errors in email batch")
 		return numSent, nil // only return error for a complete failure
 	}
-	logEntry.Info("sent email batch")
+	logEntry.Info("queued email batch")
 	return numSent, nil
 }
 
-// sendMessage sends a message described by params, using the email service, to a single user
-func sendMessage(ctx context.Context, tx *sql.Tx, svc email.Service, userID int, params message.Params) error {
-	params.From = message.NewAddress(app.Env.AppName, app.Env.FromEmail)
-
-	if params.Images == nil {
-		params.Images = commonEmailImages()
-	} else {
-		maps.Copy(params.Images, commonEmailImages())
+// sendMessage renders a message described by params and adds it to the email outbox, to be sent by the email worker
+// once the transaction is committed. The message is logged as sent to the user with ID userID.
+func sendMessage(ctx context.Context, tx *sql.Tx, userID int, params message.Params) error {
+	msg, err := newMessage(&params)
+	if err != nil {
+		return err
 	}
 
-	maps.Copy(params.Fields, commonEmailFields())
-
-	msg, err := message.New(params)
-	if err != nil {
-		return fmt.Errorf("failed to create %s message: %w", params.Template, err)
+	attachments := make([]data.OutboxAttachment, len(params.Attachments))
+	for i, a := range params.Attachments {
+		attachments[i] = data.OutboxAttachment{
+			Filename:    a.Filename(),
+			ContentType: a.ContentType(),
+			Data:        a.Data(),
+			Path:        a.Path(),
+		}
 	}
+	_, err = data.QueueEmail(ctx, tx, data.OutboxEmailInput{
+		UserID:      userID,
+		Template:    params.Template,
+		FromName:    params.From.Name(),
+		FromAddress: params.From.Addr(),
+		To:          toOutboxAddresses(params.To),
+		CC:          toOutboxAddresses(params.CC),
+		BCC:         toOutboxAddresses(params.BCC),
+		ReplyTo:     data.OutboxAddress{Name: params.ReplyTo.Name(), Address: params.ReplyTo.Addr()},
+		Subject:     msg.Subject(),
+		Body:        msg.Body(),
+		Images:      msg.Images(),
+		Attachments: attachments,
+	})
+	return err
+}
 
-	if err = svc.Send(ctx, msg); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+func toOutboxAddresses(addresses []message.Address) []data.OutboxAddress {
+	result := make([]data.OutboxAddress, len(addresses))
+	for i, a := range addresses {
+		result[i] = data.OutboxAddress{Name: a.Name(), Address: a.Addr()}
 	}
+	return result
+}
 
-	if err = data.CreateEmailLog(ctx, tx, userID, params.Template); err != nil {
-		log.Errorf("failed to create email log: %s", err.Error())
+// newMessage renders a message described by params, from the app, with the fields common to all messages. It sets
+// params.From.
+func newMessage(params *message.Params) (message.Message, error) {
+	params.From = message.NewAddress(app.Env.AppName, app.Env.FromEmail)
+
+	maps.Copy(params.Fields, commonEmailFields())
+
+	msg, err := message.New(*params)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("failed to create %s message: %w", params.Template, err)
 	}
-	return nil
+	return msg, nil
 }
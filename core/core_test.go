@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+func init() {
+	log.Init()
+}
+
+// Suite runs each test in a transaction, which is rolled back after the test
+type Suite struct {
+	suite.Suite
+	*require.Assertions
+	ctx context.Context
+	db  *sql.DB
+	tx  *sql.Tx
+}
+
+func (s *Suite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	data.DestroyTables(s.db)
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	s.NoError(err)
+	s.tx = tx
+}
+
+func (s *Suite) TearDownTest() {
+	_ = s.tx.Rollback()
+}
+
+// TestSuite runs the test suite
+func TestSuite(t *testing.T) {
+	dsn := fmt.Sprintf("postgresql://%s:%s@test_db:5432/%s?sslmode=disable",
+		app.Env.PostgresUser, app.Env.PostgresPassword, app.Env.PostgresDB)
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Suite{
+		ctx: context.Background(),
+		db:  db,
+	}
+	suite.Run(t, s)
+}
+
+// createUser creates an active user named "Test User <employeeID>", with the email "<username>@example.com"
+func (s *Suite) createUser(employeeID, username string) data.User {
+	user, err := data.CreateUser(s.ctx, s.tx, data.UserCreateInput{
+		EmployeeID:  employeeID,
+		FirstName:   "Test",
+		LastName:    "User " + employeeID,
+		DisplayName: "Test User " + employeeID,
+		Username:    username,
+		Email:       username + "@example.com",
+	})
+	s.NoError(err)
+	return user
+}
+
+// getUser reads a user, including a deleted user
+func (s *Suite) getUser(id int32) data.User {
+	user, err := data.GetUserIncludingDeleted(s.ctx, s.tx, int(id))
+	s.NoError(err)
+	return user
+}
@@ -0,0 +1,335 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const (
+	// DataExportDownloadPath is the path of the link that downloads a data export
+	DataExportDownloadPath = "/exports/download"
+
+	// dataExportBatchSize is the maximum number of exports built in one transaction
+	dataExportBatchSize = 10
+
+	// dataExportMaxAuditEvents is the maximum number of audit events included in a data export archive
+	dataExportMaxAuditEvents = 10000
+)
+
+// dataExportProfile is the profile section of a data export archive
+type dataExportProfile struct {
+	ID                 int            `json:"id"`
+	EmployeeID         string         `json:"employee_id"`
+	FirstName          string         `json:"first_name"`
+	LastName           string         `json:"last_name"`
+	DisplayName        string         `json:"display_name"`
+	Username           string         `json:"username"`
+	Email              string         `json:"email"`
+	Active             bool           `json:"active"`
+	Locked             bool           `json:"locked"`
+	Admin              bool           `json:"admin"`
+	TimeZone           string         `json:"time_zone"`
+	Language           string         `json:"language"`
+	EmailNotifications bool           `json:"email_notifications"`
+	LastLoginAt        time.Time      `json:"last_login_at"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	Attributes         map[string]any `json:"attributes"`
+}
+
+// dataExportSession is an entry in the sessions section of a data export archive. The token hash is not included.
+type dataExportSession struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// dataExportEmail is an entry in the email history section of a data export archive
+type dataExportEmail struct {
+	MessageType string    `json:"message_type"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+// dataExportAuditEvent is an entry in the account activity section of a data export archive
+type dataExportAuditEvent struct {
+	Action string          `json:"action"`
+	Actor  string          `json:"actor"`
+	IP     string          `json:"ip"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+	Time   time.Time       `json:"time"`
+}
+
+// RequestDataExport queues an export of the personal data of user. The requester must be the user or an admin, and is
+// the one who receives the download link when the export is ready.
+func RequestDataExport(ctx context.Context, tx *sql.Tx, requester, user data.User) (data.DataExport, error) {
+	if requester.ID != user.ID && !requester.Admin {
+		err := fmt.Errorf("user %d may not export the data of user %d", requester.ID, user.ID)
+		return data.DataExport{}, api.NewAppError(err, api.ErrorNotAuthorized, http.StatusForbidden)
+	}
+
+	export, err := data.CreateDataExport(ctx, tx, int(user.ID), int(requester.ID))
+	if err != nil {
+		return data.DataExport{}, err
+	}
+	err = RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditDataExportRequest,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		After:      map[string]any{"data_export_id": export.ID},
+	})
+	if err != nil {
+		return data.DataExport{}, err
+	}
+	log.WithFields(log.Fields{"userID": user.ID, "requestedBy": requester.ID}).Info("data export requested")
+	return export, nil
+}
+
+// ProcessDataExports builds the archives of pending exports and sends a download link to each requester. An export
+// that cannot be built is marked as failed. It returns the number of exports that are ready.
+func ProcessDataExports(ctx context.Context, tx *sql.Tx) (int, error) {
+	exports, err := data.FindPendingDataExports(ctx, tx, dataExportBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	numReady := 0
+	for i := range exports {
+		export := &exports[i]
+		if err = processDataExport(ctx, tx, export); err != nil {
+			log.Errorf("failed to build data export %d: %s", export.ID, err)
+			if err = export.MarkFailed(ctx, tx, time.Now().Add(app.DataExportLifetime)); err != nil {
+				return numReady, err
+			}
+			continue
+		}
+		numReady++
+	}
+	return numReady, nil
+}
+
+// ProcessAndPurgeDataExports processes pending exports and deletes the expired ones
+func ProcessAndPurgeDataExports(ctx context.Context, tx *sql.Tx) error {
+	if _, err := ProcessDataExports(ctx, tx); err != nil {
+		return err
+	}
+
+	n, err := data.DeleteExpiredDataExports(ctx, tx, time.Now())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Infof("deleted %d expired data exports", n)
+	}
+	return nil
+}
+
+// RunDataExportWorker processes pending exports every interval until ctx is cancelled. Each run uses its own
+// transaction, so exports are delivered soon after they are requested rather than on the next cron run.
+func RunDataExportWorker(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			log.Errorf("data export worker failed to create transaction: %s", err)
+			continue
+		}
+		if _, err = ProcessDataExports(ctx, tx); err != nil {
+			log.Errorf("data export worker failed: %s", err)
+			_ = tx.Rollback()
+			continue
+		}
+		if err = tx.Commit(); err != nil {
+			log.Errorf("data export worker failed to commit transaction: %s", err)
+		}
+	}
+}
+
+// DownloadDataExport returns the ready export identified by a download token, and records the download in the audit
+// log. Only the requester of the export may download it, and only until it expires.
+func DownloadDataExport(ctx context.Context, tx *sql.Tx, requester data.User, token string,
+	now time.Time) (data.DataExport, error) {
+	export, err := data.FindDataExportByHash(ctx, tx, HashAccessToken(token))
+	if err != nil {
+		return data.DataExport{}, api.NewAppError(err, api.ErrorInvalidDownloadToken, http.StatusNotFound)
+	}
+	if export.RequestedBy != requester.ID {
+		err = fmt.Errorf("data export %d was not requested by user %d", export.ID, requester.ID)
+		return data.DataExport{}, api.NewAppError(err, api.ErrorInvalidDownloadToken, http.StatusNotFound)
+	}
+	if export.Status != data.DataExportReady || export.ExpiresAt.Time.Before(now) {
+		err = errors.New("data export is expired")
+		return data.DataExport{}, api.NewAppError(err, api.ErrorInvalidDownloadToken, http.StatusNotFound)
+	}
+
+	err = RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditDataExportDownload,
+		TargetType: AuditTargetDataExport,
+		TargetID:   strconv.Itoa(int(export.ID)),
+	})
+	return export, err
+}
+
+// BuildDataArchive returns a zip archive of JSON files holding everything stored about a user
+func BuildDataArchive(ctx context.Context, tx *sql.Tx, user data.User) ([]byte, error) {
+	tokens, err := data.ListAccessTokens(ctx, tx, int(user.ID))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]dataExportSession, len(tokens))
+	for i, t := range tokens {
+		sessions[i] = dataExportSession{CreatedAt: t.CreatedUTC, ExpiresAt: t.ExpiresAt}
+		if t.LastUsedAt.Valid {
+			sessions[i].LastUsedAt = &t.LastUsedAt.Time
+		}
+	}
+
+	emailLogs, err := data.ListEmailLogs(ctx, tx, int(user.ID))
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]dataExportEmail, len(emailLogs))
+	for i, l := range emailLogs {
+		emails[i] = dataExportEmail{MessageType: l.MessageType, SentAt: l.CreatedAt}
+	}
+
+	auditEvents, _, err := data.ListAuditEvents(ctx, tx, data.AuditFilter{
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		Limit:      dataExportMaxAuditEvents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	activity := make([]dataExportAuditEvent, len(auditEvents))
+	for i, e := range auditEvents {
+		activity[i] = dataExportAuditEvent{
+			Action: e.Action,
+			Actor:  e.ActorUsername,
+			IP:     e.Ip,
+			Before: e.Before,
+			After:  e.After,
+			Time:   e.CreatedAt,
+		}
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", newDataExportProfile(user)},
+		{"sessions.json", sessions},
+		{"email_history.json", emails},
+		{"account_activity.json", activity},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to archive: %w", f.name, err)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(f.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s to archive: %w", f.name, err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DataExportFilename returns the file name of the archive of an export of the given user's data
+func DataExportFilename(user data.User, export data.DataExport) string {
+	return fmt.Sprintf("%s-data-%s.zip", user.Username, export.CompletedAt.Time.Format(time.DateOnly))
+}
+
+// processDataExport builds the archive of an export and sends the download link to the requester
+func processDataExport(ctx context.Context, tx *sql.Tx, export *data.DataExport) error {
+	user, err := data.GetUserIncludingDeleted(ctx, tx, int(export.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", export.UserID, err)
+	}
+	requester, err := data.GetUser(ctx, tx, int(export.RequestedBy))
+	if err != nil {
+		return fmt.Errorf("failed to get requester %d: %w", export.RequestedBy, err)
+	}
+
+	archive, err := BuildDataArchive(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	rawToken, err := getRandomToken()
+	if err != nil {
+		return fmt.Errorf("error generating random token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(app.DataExportLifetime)
+	if err = export.MarkReady(ctx, tx, archive, HashAccessToken(rawToken), expiresAt); err != nil {
+		return err
+	}
+
+	params := message.Params{
+		Template: message.DataExportReady,
+		Locale:   requester.Language,
+		To:       []message.Address{message.NewAddress(requester.GetDisplayName(), requester.GetEmail())},
+		Fields: message.Fields{
+			"DisplayName": requester.GetDisplayName(),
+			"Language":    requester.Language,
+			"Self":        requester.ID == user.ID,
+			"SubjectName": user.GetDisplayName(),
+			"DownloadURL": app.Env.AppURL + DataExportDownloadPath + "?token=" + url.QueryEscape(rawToken),
+			"ExpiresAt":   app.FormatDate(expiresAt, requester.TimeZone, requester.Language),
+		},
+	}
+	return sendMessage(ctx, tx, int(requester.ID), params)
+}
+
+func newDataExportProfile(user data.User) dataExportProfile {
+	return dataExportProfile{
+		ID:                 int(user.ID),
+		EmployeeID:         user.EmployeeID,
+		FirstName:          user.FirstName,
+		LastName:           user.LastName,
+		DisplayName:        user.DisplayName,
+		Username:           user.Username,
+		Email:              user.Email,
+		Active:             user.Active,
+		Locked:             user.Locked,
+		Admin:              user.Admin,
+		TimeZone:           user.TimeZone,
+		Language:           user.Language,
+		EmailNotifications: user.EmailNotifications,
+		LastLoginAt:        user.LastLoginAt,
+		CreatedAt:          user.CreatedAt,
+		UpdatedAt:          user.UpdatedAt,
+		Attributes:         user.Attributes(),
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+)
+
+// EmailChangeConfirmPath is the path of the link that confirms a change of email address
+const EmailChangeConfirmPath = "/profile/email/confirm"
+
+// RequestEmailChange starts a change of the user's email address by sending a confirmation link to the new address.
+// The address is not changed until the link is followed, see ConfirmEmailChange. Any earlier pending change is
+// cancelled. If the new address is invalid or in use by another user, the returned error is a FieldErrors.
+func RequestEmailChange(ctx context.Context, tx *sql.Tx, user data.User, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		return FieldErrors{"new_email": "Email must be a valid email address"}
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return FieldErrors{"new_email": "This is already your email address"}
+	}
+	if _, err := data.FindUserByEmailIncludingDeleted(ctx, tx, newEmail); err == nil {
+		return FieldErrors{"new_email": inUseMessage("email")}
+	}
+
+	if err := data.DeleteEmailChanges(ctx, tx, int(user.ID)); err != nil {
+		return err
+	}
+
+	rawToken, err := getRandomToken()
+	if err != nil {
+		err = fmt.Errorf("error generating random token: %w", err)
+		return api.NewAppError(err, api.ErrorGeneratingRandomToken, http.StatusInternalServerError)
+	}
+
+	change, err := data.CreateEmailChange(ctx, tx, int(user.ID), newEmail, HashAccessToken(rawToken))
+	if err != nil {
+		return err
+	}
+
+	params := message.Params{
+		Template: message.EmailChangeConfirm,
+		Locale:   user.Language,
+		To:       []message.Address{message.NewAddress(user.GetDisplayName(), newEmail)},
+		Fields: message.Fields{
+			"DisplayName": user.GetDisplayName(),
+			"Language":    user.Language,
+			"NewEmail":    newEmail,
+			"ConfirmURL":  app.Env.AppURL + EmailChangeConfirmPath + "?token=" + url.QueryEscape(rawToken),
+			"ExpiresAt":   app.FormatDate(change.ExpiresAt, user.TimeZone, user.Language),
+		},
+	}
+	return sendMessage(ctx, tx, int(user.ID), params)
+}
+
+// ConfirmEmailChange applies the pending email change identified by token, which must belong to the given user and
+// must not be expired. A token can be used only once. A notice is sent to the previous address.
+func ConfirmEmailChange(ctx context.Context, tx *sql.Tx, user data.User, token string,
+	now time.Time) (data.User, error) {
+	change, err := data.FindEmailChangeByHash(ctx, tx, HashAccessToken(token))
+	if err != nil {
+		return user, api.NewAppError(err, api.ErrorInvalidEmailToken, http.StatusBadRequest)
+	}
+	if change.UserID != user.ID {
+		err = fmt.Errorf("email change %d does not belong to user %d", change.ID, user.ID)
+		return user, api.NewAppError(err, api.ErrorInvalidEmailToken, http.StatusBadRequest)
+	}
+
+	if change.ExpiresAt.Before(now) {
+		err = errors.New("expired email change token")
+		return user, api.NewAppError(err, api.ErrorInvalidEmailToken, http.StatusBadRequest)
+	}
+	if err = data.DeleteEmailChanges(ctx, tx, int(user.ID)); err != nil {
+		return user, err
+	}
+
+	oldEmail := user.GetEmail()
+	user.Email = change.NewEmail
+	if err = saveUser(ctx, tx, AuditEmailChange, user); err != nil {
+		return user, fmt.Errorf("failed to change email of user %d: %w", user.ID, err)
+	}
+
+	params := message.Params{
+		Template: message.EmailChanged,
+		Locale:   user.Language,
+		To:       []message.Address{message.NewAddress(user.GetDisplayName(), oldEmail)},
+		Fields: message.Fields{
+			"DisplayName": user.GetDisplayName(),
+			"Language":    user.Language,
+			"NewEmail":    change.NewEmail,
+		},
+	}
+	if err = sendMessage(ctx, tx, int(user.ID), params); err != nil {
+		return user, fmt.Errorf("failed to send email change notice to user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email"
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const (
+	emailOutboxBatchSize = 50
+
+	// emailSendLease is how long a claimed message is left to its worker, which must cover sending a whole batch
+	emailSendLease = 15 * time.Minute
+
+	// emailRetryBaseDelay is the wait after the first failed attempt to send a message. It doubles with each attempt,
+	// up to emailRetryMaxDelay.
+	emailRetryBaseDelay = time.Minute
+	emailRetryMaxDelay  = 6 * time.Hour
+)
+
+// ProcessEmailOutbox sends the messages in the email outbox that are due. A message that fails is tried again later,
+// with exponential backoff, until it has been tried app.Env.EmailMaxAttempts times, after which it is marked as dead.
+// It returns the number of messages sent.
+//
+// The messages are claimed in a short transaction that leases them for emailSendLease, so no locks are held while the
+// email service is called. The outcome of each message is then recorded in its own transaction, so a failure to record
+// one doesn't undo the others. A message whose outcome is not recorded is sent again when its lease expires.
+func ProcessEmailOutbox(ctx context.Context, db *sql.DB, svc email.Service, now time.Time) (int, error) {
+	var emails []data.OutboxEmail
+	err := inTransaction(ctx, db, func(tx *sql.Tx) (err error) {
+		emails, err = data.ClaimDueEmails(ctx, tx, now, now.Add(emailSendLease), emailOutboxBatchSize)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	numSent := 0
+	var errs []error
+	for i := range emails {
+		outboxEmail := &emails[i]
+		messageID, sendErr := sendOutboxEmail(ctx, svc, *outboxEmail)
+		err = inTransaction(ctx, db, func(tx *sql.Tx) error {
+			if sendErr == nil {
+				return outboxEmail.MarkSent(ctx, tx, messageID)
+			}
+			return markOutboxFailure(ctx, tx, outboxEmail, sendErr, now)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if sendErr == nil {
+			numSent++
+		}
+	}
+	return numSent, errors.Join(errs...)
+}
+
+// markOutboxFailure records a failed attempt to send a message, which is tried again later unless it has been tried
+// app.Env.EmailMaxAttempts times
+func markOutboxFailure(ctx context.Context, tx *sql.Tx, outboxEmail *data.OutboxEmail, sendErr error,
+	now time.Time) error {
+	logEntry := log.WithFields(log.Fields{
+		"outboxID": outboxEmail.ID,
+		"template": outboxEmail.MessageType,
+		"attempts": outboxEmail.Attempts + 1,
+	})
+	if int(outboxEmail.Attempts)+1 >= app.Env.EmailMaxAttempts {
+		logEntry.Errorf("giving up on email: %s", sendErr)
+		return outboxEmail.MarkDead(ctx, tx, sendErr)
+	}
+	logEntry.Warningf("failed to send email, will retry: %s", sendErr)
+	return outboxEmail.MarkRetry(ctx, tx, sendErr, now.Add(emailRetryDelay(int(outboxEmail.Attempts)+1)))
+}
+
+// RunEmailWorker sends the messages in the email outbox every interval until ctx is cancelled. Since the messages are
+// leased, more than one worker may run at the same time.
+func RunEmailWorker(ctx context.Context, db *sql.DB, svc email.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := ProcessEmailOutbox(ctx, db, svc, time.Now()); err != nil {
+			log.Errorf("email worker failed: %s", err)
+		}
+	}
+}
+
+// inTransaction runs fn in a new transaction, which is committed if fn succeeds and rolled back otherwise
+func inTransaction(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// emailRetryDelay returns the wait before the next attempt to send a message that failed the given number of times
+func emailRetryDelay(attempts int) time.Duration {
+	delay := emailRetryBaseDelay
+	for i := 1; i < attempts && delay < emailRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, emailRetryMaxDelay)
+}
+
+func sendOutboxEmail(ctx context.Context, svc email.Service, outboxEmail data.OutboxEmail) (string, error) {
+	msg, err := newOutboxMessage(outboxEmail)
+	if err != nil {
+		return "", err
+	}
+	messageID, err := svc.Send(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to send %s message %d: %w", outboxEmail.MessageType, outboxEmail.ID, err)
+	}
+	return messageID, nil
+}
+
+// newOutboxMessage rebuilds the rendered message held in the outbox
+func newOutboxMessage(outboxEmail data.OutboxEmail) (message.Message, error) {
+	params := message.Params{
+		Template: outboxEmail.MessageType,
+		From:     message.NewAddress(outboxEmail.FromName, outboxEmail.FromAddress),
+		ReplyTo:  fromOutboxAddress(outboxEmail.GetReplyTo()),
+	}
+
+	var err error
+	if params.Images, err = outboxEmail.GetImages(); err != nil {
+		return message.Message{}, err
+	}
+	lists := []struct {
+		get       func() ([]data.OutboxAddress, error)
+		addresses *[]message.Address
+	}{
+		{outboxEmail.GetTo, &params.To},
+		{outboxEmail.GetCC, &params.CC},
+		{outboxEmail.GetBCC, &params.BCC},
+	}
+	for _, list := range lists {
+		addresses, err := list.get()
+		if err != nil {
+			return message.Message{}, err
+		}
+		for _, a := range addresses {
+			*list.addresses = append(*list.addresses, fromOutboxAddress(a))
+		}
+	}
+
+	attachments, err := outboxEmail.GetAttachments()
+	if err != nil {
+		return message.Message{}, err
+	}
+	for _, a := range attachments {
+		if a.Path != "" {
+			params.Attachments = append(params.Attachments, message.NewFileAttachment(a.Path, a.ContentType))
+		} else {
+			params.Attachments = append(params.Attachments, message.NewAttachment(a.Filename, a.ContentType, a.Data))
+		}
+	}
+
+	return message.NewRenderedFromParams(params, outboxEmail.Subject, outboxEmail.Body), nil
+}
+
+func fromOutboxAddress(a data.OutboxAddress) message.Address {
+	return message.NewAddress(a.Name, a.Address)
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"time"
+
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+)
+
+// TestSendMessage_Outbox checks that all recipients and attachments of a message survive the email outbox
+func (s *Suite) TestSendMessage_Outbox() {
+	user := s.createUser("10001", "jane")
+	params := message.Params{
+		Template: message.Welcome,
+		Locale:   user.Language,
+		To: []message.Address{
+			message.NewAddress(user.GetDisplayName(), user.GetEmail()),
+			message.NewAddress("", "second@example.com"),
+		},
+		CC:      []message.Address{message.NewAddress("Manager", "manager@example.com")},
+		BCC:     []message.Address{message.NewAddress("", "archive@example.com")},
+		ReplyTo: message.NewAddress("Support", "support@example.com"),
+		Fields: message.Fields{
+			"DisplayName": user.GetDisplayName(),
+			"Username":    user.Username,
+			"Language":    user.Language,
+		},
+		Attachments: []message.Attachment{
+			message.NewAttachment("notes.txt", "", []byte("notes")),
+			message.NewFileAttachment("assets/img/logo.png", ""),
+		},
+	}
+	s.NoError(sendMessage(s.ctx, s.tx, int(user.ID), params))
+
+	// a lease that ends now leaves the message due for sendQueuedEmails
+	now := time.Now()
+	queued, err := data.ClaimDueEmails(s.ctx, s.tx, now, now, 10)
+	s.NoError(err)
+	s.Len(queued, 1)
+	msg, err := newOutboxMessage(queued[0])
+	s.NoError(err)
+
+	s.Equal("Test User 10001 <jane@example.com>, second@example.com", msg.To())
+	s.Equal("Manager <manager@example.com>", msg.CC())
+	s.Equal("Support <support@example.com>", msg.ReplyTo())
+	s.Len(msg.Recipients(), 4, "the BCC address should be kept")
+	s.Equal("archive@example.com", msg.Recipients()[3].Addr())
+
+	attachments := msg.Attachments()
+	s.Len(attachments, 2)
+	s.Equal("notes.txt", attachments[0].Filename())
+	s.Equal("text/plain; charset=utf-8", attachments[0].ContentType())
+	s.Equal([]byte("notes"), attachments[0].Data())
+	s.Equal("logo.png", attachments[1].Filename())
+	s.Equal("assets/img/logo.png", attachments[1].Path())
+
+	fake := s.sendQueuedEmails()
+	s.Equal(1, fake.GetNumberOfMessagesSent())
+	s.Contains(fake.GetLastBody(), "Cc: Manager <manager@example.com>")
+	s.Contains(fake.GetLastBody(), "filename=notes.txt")
+}
+
+// TestProcessEmailOutbox checks that a failed message is retried on its own, without sending the others again
+func (s *Suite) TestProcessEmailOutbox() {
+	user := s.createUser("10001", "jane")
+	for _, body := range []string{"<p>Hello</p>", "ERROR"} {
+		_, err := data.QueueEmail(s.ctx, s.tx, data.OutboxEmailInput{
+			UserID:      int(user.ID),
+			Template:    message.Welcome,
+			FromAddress: "no_reply@example.com",
+			To:          []data.OutboxAddress{{Address: user.Email}},
+			Subject:     "Welcome",
+			Body:        body,
+		})
+		s.NoError(err)
+	}
+
+	s.Equal(1, s.sendQueuedEmails().GetNumberOfMessagesSent())
+	s.Equal(0, s.sendQueuedEmails().GetNumberOfMessagesSent(), "nothing should be sent before the retry is due")
+
+	later := time.Now().Add(time.Hour)
+	due, err := data.ClaimDueEmails(s.ctx, s.tx, later, later, 10)
+	s.NoError(err)
+	s.Len(due, 1, "only the failed message should be left in the outbox")
+	s.Equal("ERROR", due[0].Body)
+	s.Equal(int32(1), due[0].Attempts)
+}
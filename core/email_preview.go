@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+)
+
+// PreviewEmail renders a message template with its sample fields, as it would be sent to user
+func PreviewEmail(user data.User, templateName string) (message.Message, error) {
+	params, err := emailPreviewParams(user, templateName)
+	if err != nil {
+		return message.Message{}, err
+	}
+	return newMessage(&params)
+}
+
+// SendEmailPreview sends a message template rendered with its sample fields to user
+func SendEmailPreview(ctx context.Context, tx *sql.Tx, user data.User, templateName string) error {
+	params, err := emailPreviewParams(user, templateName)
+	if err != nil {
+		return err
+	}
+	return sendMessage(ctx, tx, int(user.ID), params)
+}
+
+func emailPreviewParams(user data.User, templateName string) (message.Params, error) {
+	fields, err := message.SampleFields(templateName)
+	if err != nil {
+		return message.Params{}, err
+	}
+	fields["DisplayName"] = user.GetDisplayName()
+	fields["Language"] = user.Language
+
+	return message.Params{
+		Template: templateName,
+		Locale:   user.Language,
+		To:       []message.Address{message.NewAddress(user.GetDisplayName(), user.GetEmail())},
+		Fields:   fields,
+	}, nil
+}
@@ -0,0 +1,418 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const hrFeedTimeout = 5 * time.Minute
+
+// ErrHRSyncAborted is returned by SyncUsers if the sync would deactivate too many users
+var ErrHRSyncAborted = errors.New("HR feed sync aborted")
+
+// HRFeedRecord is one employee in the HR feed. The columns of a CSV feed have the same names as the JSON fields.
+type HRFeedRecord struct {
+	EmployeeID  string `json:"employee_id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+}
+
+// HRSyncChange describes a user created, updated or deactivated by the HR feed sync
+type HRSyncChange struct {
+	EmployeeID string
+	Name       string
+	Changes    []FieldChange
+}
+
+// HRSyncReport summarizes the outcome of an HR feed sync
+type HRSyncReport struct {
+	Source      string
+	FeedRecords int
+	Created     []HRSyncChange
+	Updated     []HRSyncChange
+	Deactivated []HRSyncChange
+	Unchanged   int
+
+	// Errors lists the feed records that were skipped because they are not valid
+	Errors []string
+
+	// Aborted is true if no changes were made because too many users would have been deactivated
+	Aborted bool
+}
+
+// SyncHRFeed reads the HR feed configured by app.Env.HRFeedSource and reconciles it with the users table. The report is
+// written to the log and emailed to all admins. An aborted sync is logged as an error but returns nil, so the report
+// queued in tx is committed and sent.
+func SyncHRFeed(ctx context.Context, tx *sql.Tx) error {
+	if app.Env.HRFeedSource == "" {
+		log.Info("HR feed sync skipped, no HR feed source is configured")
+		return nil
+	}
+
+	records, err := ReadHRFeed(ctx, app.Env.HRFeedSource, app.Env.HRFeedFormat)
+	if err != nil {
+		return err
+	}
+
+	report, err := SyncUsers(ctx, tx, records, app.Env.HRFeedMaxDeactivatePercent)
+	if err != nil && !errors.Is(err, ErrHRSyncAborted) {
+		return err
+	}
+	report.Source = app.Env.HRFeedSource
+	report.log()
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	if err = sendHRSyncReport(ctx, tx, report); err != nil {
+		log.Errorf("failed to send HR feed sync report: %s", err)
+	}
+	return nil
+}
+
+// ReadHRFeed reads an HR feed from a file path or an http(s) URL. The format is "json" or "csv". If format is empty,
+// the feed is read as CSV if the source ends in ".csv", otherwise as JSON.
+func ReadHRFeed(ctx context.Context, source, format string) ([]HRFeedRecord, error) {
+	var r io.ReadCloser
+	u, err := url.Parse(source)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		r, err = fetchHRFeed(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		source = u.Path
+	} else {
+		r, err = os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open HR feed: %w", err)
+		}
+	}
+	defer r.Close()
+
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(path.Ext(source), ".csv") {
+			format = "csv"
+		}
+	}
+	return parseHRFeed(r, format)
+}
+
+func fetchHRFeed(ctx context.Context, feedURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HR feed URL: %w", err)
+	}
+
+	client := http.Client{Timeout: hrFeedTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download HR feed: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("failed to download HR feed: status %s", res.Status)
+	}
+	return res.Body, nil
+}
+
+func parseHRFeed(r io.Reader, format string) ([]HRFeedRecord, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		var records []HRFeedRecord
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON HR feed: %w", err)
+		}
+		return records, nil
+	case "csv":
+		return parseHRFeedCSV(r)
+	}
+	return nil, fmt.Errorf("unsupported HR feed format %q", format)
+}
+
+func parseHRFeedCSV(r io.Reader) ([]HRFeedRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV HR feed: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV HR feed has no header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["employee_id"]; !ok {
+		return nil, errors.New(`CSV HR feed is missing the "employee_id" column`)
+	}
+
+	records := make([]HRFeedRecord, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return row[i]
+			}
+			return ""
+		}
+		records = append(records, HRFeedRecord{
+			EmployeeID:  value("employee_id"),
+			FirstName:   value("first_name"),
+			LastName:    value("last_name"),
+			DisplayName: value("display_name"),
+			Username:    value("username"),
+			Email:       value("email"),
+		})
+	}
+	return records, nil
+}
+
+// SyncUsers reconciles the users table with the HR feed records. Employees not yet in the table are created, and the
+// names and email of existing users are updated. Active users missing from the feed are deactivated, unless that
+// would be more than maxDeactivatePercent of the active users, in which case no changes are made and
+// ErrHRSyncAborted is returned along with a report of what would have been done. A record that is invalid, or whose
+// username or email belongs to another user or to an earlier record, or whose create is rejected by the database, is
+// skipped and listed in the report's errors.
+func SyncUsers(ctx context.Context, tx *sql.Tx, records []HRFeedRecord, maxDeactivatePercent int) (HRSyncReport, error) {
+	report := HRSyncReport{FeedRecords: len(records)}
+
+	activeUsers, err := data.ListActiveUsers(ctx, tx)
+	if err != nil {
+		return report, err
+	}
+
+	var creates []UserInput
+	var updates []data.User
+	inFeed := map[string]bool{}
+	claimed := feedClaims{}
+	for i, record := range records {
+		input := UserInput{
+			EmployeeID:  record.EmployeeID,
+			FirstName:   record.FirstName,
+			LastName:    record.LastName,
+			DisplayName: record.DisplayName,
+			Username:    record.Username,
+			Email:       record.Email,
+		}.trim()
+		if input.EmployeeID == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("record %d: employee ID is missing", i+1))
+			continue
+		}
+		if inFeed[input.EmployeeID] {
+			report.Errors = append(report.Errors, fmt.Sprintf("employee %s: repeated in the feed", input.EmployeeID))
+			continue
+		}
+		inFeed[input.EmployeeID] = true
+
+		user, err := data.FindUserByEmployeeID(ctx, tx, input.EmployeeID)
+		if errors.Is(err, sql.ErrNoRows) {
+			if err = input.Validate(); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("employee %s: %s", input.EmployeeID, err))
+				continue
+			}
+			conflict, err := claimed.check(ctx, tx, input, 0)
+			if err != nil {
+				return report, err
+			}
+			if conflict != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("employee %s: %s", input.EmployeeID, conflict))
+				continue
+			}
+			creates = append(creates, input)
+			report.Created = append(report.Created, HRSyncChange{
+				EmployeeID: input.EmployeeID,
+				Name:       strings.TrimSpace(input.FirstName + " " + input.LastName),
+			})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		// the feed is authoritative for names and email, but the username is left alone
+		input.Username = user.Username
+		if err = input.Validate(); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("employee %s: %s", input.EmployeeID, err))
+			continue
+		}
+		conflict, err := claimed.check(ctx, tx, input, int(user.ID))
+		if err != nil {
+			return report, err
+		}
+		if conflict != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("employee %s: %s", input.EmployeeID, conflict))
+			continue
+		}
+		updated := user
+		updated.FirstName = input.FirstName
+		updated.LastName = input.LastName
+		updated.DisplayName = input.DisplayName
+		updated.Email = input.Email
+		updated.DisplayName = updated.GetDisplayName()
+		changes := diffUsers(user, updated)
+		if len(changes) == 0 {
+			report.Unchanged++
+			continue
+		}
+		updates = append(updates, updated)
+		report.Updated = append(report.Updated, HRSyncChange{
+			EmployeeID: user.EmployeeID,
+			Name:       updated.GetDisplayName(),
+			Changes:    changes,
+		})
+	}
+
+	var deactivations []data.User
+	for _, user := range activeUsers {
+		if !inFeed[user.EmployeeID] {
+			deactivations = append(deactivations, user)
+			report.Deactivated = append(report.Deactivated, HRSyncChange{
+				EmployeeID: user.EmployeeID,
+				Name:       user.GetDisplayName(),
+			})
+		}
+	}
+
+	if len(deactivations) > 0 && len(deactivations)*100 > len(activeUsers)*maxDeactivatePercent {
+		report.Aborted = true
+		return report, fmt.Errorf("%w: %d of %d active users would be deactivated, the limit is %d%%",
+			ErrHRSyncAborted, len(deactivations), len(activeUsers), maxDeactivatePercent)
+	}
+
+	var created []HRSyncChange
+	for i, input := range creates {
+		// a failed create aborts the transaction, so it is undone to a savepoint to let the rest of the sync go on
+		savepoint, err := data.NewSavepoint(ctx, tx, "hr_sync_create")
+		if err != nil {
+			return report, err
+		}
+		if _, createErr := CreateUser(ctx, tx, input); createErr != nil {
+			if err = savepoint.Rollback(ctx); err != nil {
+				return report, err
+			}
+			report.Errors = append(report.Errors, fmt.Sprintf("employee %s: %s", input.EmployeeID, createErr))
+			continue
+		}
+		if err = savepoint.Release(ctx); err != nil {
+			return report, err
+		}
+		created = append(created, report.Created[i])
+	}
+	report.Created = created
+
+	for _, user := range updates {
+		if err = saveUser(ctx, tx, AuditUserUpdate, user); err != nil {
+			return report, fmt.Errorf("failed to update user %d: %w", user.ID, err)
+		}
+	}
+	for _, user := range deactivations {
+		user.Active = false
+		if err = saveUser(ctx, tx, AuditUserDeactivate, user); err != nil {
+			return report, fmt.Errorf("failed to deactivate user %d: %w", user.ID, err)
+		}
+	}
+	return report, nil
+}
+
+// feedClaims holds the lowercase usernames and emails of the HR feed records already accepted by a sync, mapped to
+// their employee IDs
+type feedClaims map[string]string
+
+// check returns a conflict if the username or email of the input is used by a user other than the one with ID userID,
+// or by an earlier record of the feed. Otherwise, it claims them for the input's employee. Checking each record before
+// anything is saved keeps a single conflict from failing the whole sync on a unique index. A failed lookup is returned
+// as err.
+func (c feedClaims) check(ctx context.Context, tx *sql.Tx, input UserInput, userID int) (conflict, err error) {
+	keys := []string{"username:" + strings.ToLower(input.Username), "email:" + strings.ToLower(input.Email)}
+	for _, key := range keys {
+		if other, ok := c[key]; ok {
+			field, value, _ := strings.Cut(key, ":")
+			return fmt.Errorf("%s %q is repeated from employee %s", field, value, other), nil
+		}
+	}
+	if err = checkUserUnique(ctx, tx, input, userID); err != nil {
+		var appErr *api.AppError
+		if errors.As(err, &appErr) {
+			return err, nil
+		}
+		return nil, err
+	}
+	for _, key := range keys {
+		c[key] = input.EmployeeID
+	}
+	return nil, nil
+}
+
+func (r HRSyncReport) log() {
+	entry := log.WithFields(log.Fields{
+		"source":      r.Source,
+		"feedRecords": r.FeedRecords,
+		"created":     len(r.Created),
+		"updated":     len(r.Updated),
+		"deactivated": len(r.Deactivated),
+		"unchanged":   r.Unchanged,
+		"errors":      len(r.Errors),
+		"aborted":     r.Aborted,
+	})
+	if r.Aborted {
+		entry.Error("HR feed sync aborted, too many users would be deactivated")
+		return
+	}
+
+	for _, c := range r.Created {
+		log.Infof("HR feed sync created employee %s (%s)", c.EmployeeID, c.Name)
+	}
+	for _, c := range r.Updated {
+		log.Infof("HR feed sync updated employee %s (%s): %v", c.EmployeeID, c.Name, c.Changes)
+	}
+	for _, c := range r.Deactivated {
+		log.Infof("HR feed sync deactivated employee %s (%s)", c.EmployeeID, c.Name)
+	}
+	for _, e := range r.Errors {
+		log.Warningf("HR feed sync skipped %s", e)
+	}
+	entry.Info("HR feed sync complete")
+}
+
+func sendHRSyncReport(ctx context.Context, tx *sql.Tx, report HRSyncReport) error {
+	admins, err := data.ListAdminUsers(ctx, tx)
+	if err != nil {
+		return err
+	}
+	admins = slices.DeleteFunc(admins, func(admin data.User) bool { return !admin.EmailNotifications })
+	if len(admins) == 0 {
+		log.Warning("HR feed sync report not sent, there are no admins with email notifications enabled")
+		return nil
+	}
+
+	params := message.Params{
+		Template: message.HRSyncReport,
+		Fields:   message.Fields{"Report": report},
+	}
+	_, err = sendBatch(ctx, tx, admins, params)
+	return err
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+func Test_parseHRFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		format  string
+		want    []HRFeedRecord
+		wantErr string
+	}{
+		{
+			name:   "json",
+			feed:   `[{"employee_id": "10001", "first_name": "John", "username": "john_doe", "email": "john@example.com"}]`,
+			format: "json",
+			want:   []HRFeedRecord{{EmployeeID: "10001", FirstName: "John", Username: "john_doe", Email: "john@example.com"}},
+		},
+		{
+			name:   "csv with byte order mark and columns in any order",
+			feed:   "\ufeffEmail, employee_id,last_name\njohn@example.com,10001,Doe\n",
+			format: "CSV",
+			want:   []HRFeedRecord{{EmployeeID: "10001", LastName: "Doe", Email: "john@example.com"}},
+		},
+		{
+			name:    "invalid json",
+			feed:    `{"employee_id": "10001"}`,
+			format:  "json",
+			wantErr: "failed to parse JSON HR feed",
+		},
+		{
+			name:    "csv without employee_id",
+			feed:    "username,email\njohn_doe,john@example.com\n",
+			format:  "csv",
+			wantErr: `missing the "employee_id" column`,
+		},
+		{
+			name:    "csv with a short row",
+			feed:    "employee_id,email\n10001\n",
+			format:  "csv",
+			wantErr: "failed to parse CSV HR feed",
+		},
+		{
+			name:    "empty csv",
+			feed:    "",
+			format:  "csv",
+			wantErr: "has no header",
+		},
+		{
+			name:    "unsupported format",
+			feed:    "",
+			format:  "xml",
+			wantErr: "unsupported HR feed format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHRFeed(strings.NewReader(tt.feed), tt.format)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadHRFeed(t *testing.T) {
+	ctx := context.Background()
+	want := []HRFeedRecord{{EmployeeID: "10001", Email: "john@example.com"}}
+
+	filename := filepath.Join(t.TempDir(), "feed.csv")
+	require.NoError(t, os.WriteFile(filename, []byte("employee_id,email\n10001,john@example.com\n"), 0o600))
+	records, err := ReadHRFeed(ctx, filename, "")
+	require.NoError(t, err)
+	require.Equal(t, want, records)
+
+	_, err = ReadHRFeed(ctx, filepath.Join(t.TempDir(), "missing.json"), "")
+	require.ErrorContains(t, err, "failed to open HR feed")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"employee_id": "10001", "email": "john@example.com"}]`))
+	}))
+	defer server.Close()
+
+	records, err = ReadHRFeed(ctx, server.URL+"/feed.json?token=abc", "")
+	require.NoError(t, err)
+	require.Equal(t, want, records)
+
+	_, err = ReadHRFeed(ctx, server.URL+"/missing.json", "")
+	require.ErrorContains(t, err, "status 404")
+}
+
+// hrFeedRecord returns a feed record that matches a user created by Suite.createUser
+func hrFeedRecord(employeeID, username string) HRFeedRecord {
+	return HRFeedRecord{
+		EmployeeID:  employeeID,
+		FirstName:   "Test",
+		LastName:    "User " + employeeID,
+		DisplayName: "Test User " + employeeID,
+		Username:    username,
+		Email:       username + "@example.com",
+	}
+}
+
+func (s *Suite) TestSyncUsers() {
+	changed := s.createUser("10001", "user1")
+	s.createUser("10002", "user2")
+	s.createUser("10003", "user3")
+	missing := s.createUser("10004", "user4")
+
+	renamed := hrFeedRecord("10001", "ignored_username")
+	renamed.LastName = "Renamed"
+	renamed.DisplayName = "Test Renamed"
+	records := []HRFeedRecord{
+		renamed,
+		hrFeedRecord("10002", "user2"),
+		hrFeedRecord("10003", "user3"),
+		hrFeedRecord("10005", "user5"),
+		{FirstName: "No", LastName: "ID"},
+		hrFeedRecord("10002", "user2"),
+		hrFeedRecord("10006", "user6"),
+	}
+	records[6].Email = "not an email"
+
+	report, err := SyncUsers(s.ctx, s.tx, records, 25)
+	s.NoError(err)
+	s.False(report.Aborted)
+	s.Equal(len(records), report.FeedRecords)
+	s.Equal(2, report.Unchanged)
+
+	s.Len(report.Created, 1)
+	s.Equal("10005", report.Created[0].EmployeeID)
+	created, err := data.FindUserByEmployeeID(s.ctx, s.tx, "10005")
+	s.NoError(err)
+	s.Equal("user5", created.Username)
+
+	s.Len(report.Updated, 1)
+	s.Equal("10001", report.Updated[0].EmployeeID)
+	updated := s.getUser(changed.ID)
+	s.Equal("Renamed", updated.LastName)
+	s.Equal("Test Renamed", updated.DisplayName)
+	s.Equal("user1", updated.Username, "the username should not be changed by the feed")
+
+	s.Len(report.Deactivated, 1)
+	s.Equal("10004", report.Deactivated[0].EmployeeID)
+	s.False(s.getUser(missing.ID).Active)
+
+	s.Len(report.Errors, 3)
+	s.Contains(report.Errors[0], "record 5: employee ID is missing")
+	s.Contains(report.Errors[1], "employee 10002: repeated in the feed")
+	s.Contains(report.Errors[2], "employee 10006:")
+}
+
+func (s *Suite) TestSyncUsers_Aborted() {
+	s.createUser("10001", "user1")
+	s.createUser("10002", "user2")
+	s.createUser("10003", "user3")
+	missing := s.createUser("10004", "user4")
+
+	records := []HRFeedRecord{
+		hrFeedRecord("10001", "user1"),
+		hrFeedRecord("10002", "user2"),
+		hrFeedRecord("10005", "user5"),
+	}
+	report, err := SyncUsers(s.ctx, s.tx, records, 25)
+	s.ErrorIs(err, ErrHRSyncAborted)
+	s.True(report.Aborted)
+	s.Len(report.Deactivated, 2, "the report should show what would have been done")
+	s.Len(report.Created, 1)
+
+	s.True(s.getUser(missing.ID).Active, "no user should be deactivated by an aborted sync")
+	_, err = data.FindUserByEmployeeID(s.ctx, s.tx, "10005")
+	s.Error(err, "no user should be created by an aborted sync")
+}
+
+// TestSyncHRFeed_Aborted checks that an aborted sync returns no error, so the cron job commits the queued report
+func (s *Suite) TestSyncHRFeed_Aborted() {
+	admin := s.createUser("10001", "admin")
+	_, err := s.tx.ExecContext(s.ctx, "UPDATE users SET admin = true WHERE id = $1", admin.ID)
+	s.NoError(err)
+	missing := s.createUser("10002", "user2")
+
+	filename := filepath.Join(s.T().TempDir(), "feed.csv")
+	s.NoError(os.WriteFile(filename, []byte("employee_id,username,email\n10001,admin,admin@example.com\n"), 0o600))
+	defer func(source string, percent int) {
+		app.Env.HRFeedSource, app.Env.HRFeedMaxDeactivatePercent = source, percent
+	}(app.Env.HRFeedSource, app.Env.HRFeedMaxDeactivatePercent)
+	app.Env.HRFeedSource, app.Env.HRFeedMaxDeactivatePercent = filename, 5
+
+	s.NoError(SyncHRFeed(s.ctx, s.tx))
+	s.True(s.getUser(missing.ID).Active, "no user should be deactivated by an aborted sync")
+
+	fake := s.sendQueuedEmails()
+	s.Equal(1, fake.GetNumberOfMessagesSent(), "the report should be queued")
+	s.Contains(fake.GetLastToEmail(), "admin@example.com")
+}
+
+func (s *Suite) TestSyncUsers_Conflicts() {
+	user1 := s.createUser("10001", "user1")
+	user2 := s.createUser("10002", "user2")
+	deleted := s.createUser("10003", "user3")
+	s.NoError(deleted.Delete(s.ctx, s.tx))
+
+	takesEmail := hrFeedRecord("10002", "user2")
+	takesEmail.Email = "USER1@example.com"
+	takesUsername := hrFeedRecord("10004", "user1")
+	takesUsername.Email = "user4@example.com"
+	takesDeletedEmail := hrFeedRecord("10005", "user5")
+	takesDeletedEmail.Email = "user3@example.com"
+	repeatsEmail := hrFeedRecord("10007", "user7")
+	repeatsEmail.Email = "user6@example.com"
+	records := []HRFeedRecord{
+		hrFeedRecord("10001", "user1"),
+		takesEmail,
+		takesUsername,
+		takesDeletedEmail,
+		hrFeedRecord("10006", "user6"),
+		repeatsEmail,
+	}
+
+	report, err := SyncUsers(s.ctx, s.tx, records, 100)
+	s.NoError(err, "a conflict should not fail the whole sync")
+	s.Len(report.Errors, 4, report.Errors)
+	s.Contains(report.Errors[0], "employee 10002:")
+	s.Contains(report.Errors[0], "email")
+	s.Contains(report.Errors[1], "employee 10004:")
+	s.Contains(report.Errors[1], "username")
+	s.Contains(report.Errors[2], "employee 10005:")
+	s.Contains(report.Errors[2], "deleted user")
+	s.Contains(report.Errors[3], `employee 10007: email "user6@example.com" is repeated from employee 10006`)
+
+	s.Len(report.Created, 1)
+	s.Equal("10006", report.Created[0].EmployeeID)
+	s.Equal("user1@example.com", s.getUser(user1.ID).Email)
+	s.Equal("user2@example.com", s.getUser(user2.ID).Email)
+	s.True(s.getUser(user2.ID).Active, "a user whose record was skipped is still in the feed")
+}
+
+// TestSyncUsers_CreateFailed checks that a create rejected by the database is skipped without failing the later changes
+func (s *Suite) TestSyncUsers_CreateFailed() {
+	user1 := s.createUser("10001", "user1")
+
+	tooLong := hrFeedRecord("10002", "user2")
+	tooLong.FirstName = strings.Repeat("x", 300)
+	updated := hrFeedRecord("10001", "user1")
+	updated.LastName = "Renamed"
+	records := []HRFeedRecord{tooLong, hrFeedRecord("10003", "user3"), updated}
+
+	report, err := SyncUsers(s.ctx, s.tx, records, 100)
+	s.NoError(err, "a failed create should not fail the whole sync")
+	s.Len(report.Errors, 1, report.Errors)
+	s.Contains(report.Errors[0], "employee 10002:")
+	s.Len(report.Created, 1)
+	s.Equal("10003", report.Created[0].EmployeeID)
+	s.Equal("Renamed", s.getUser(user1.ID).LastName)
+
+	_, err = data.FindUserByEmployeeID(s.ctx, s.tx, "10003")
+	s.NoError(err)
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const (
+	PurgeModeAnonymize = "anonymize"
+	PurgeModeDelete    = "delete"
+
+	// anonymizedPrefix replaces the identifying fields of an anonymized user
+	anonymizedPrefix = "purged-"
+
+	day = 24 * time.Hour
+)
+
+// LifecyclePolicy holds the thresholds of the inactive-account lifecycle. A zero duration disables the step.
+type LifecyclePolicy struct {
+	// WarnAfter is the time since the last login after which a user is sent an inactivity warning
+	WarnAfter time.Duration
+
+	// DeactivateAfter is the time after the warning at which a user who still has not logged in is deactivated
+	DeactivateAfter time.Duration
+
+	// PurgeAfter is the time after the last change to an inactive user at which the user is purged
+	PurgeAfter time.Duration
+
+	// PurgeMode is PurgeModeAnonymize or PurgeModeDelete
+	PurgeMode string
+}
+
+// LifecyclePolicyFromEnv returns the lifecycle policy configured in app.Env
+func LifecyclePolicyFromEnv() LifecyclePolicy {
+	return LifecyclePolicy{
+		WarnAfter:       time.Duration(app.Env.InactiveWarnDays) * day,
+		DeactivateAfter: time.Duration(app.Env.InactiveDeactivateDays) * day,
+		PurgeAfter:      time.Duration(app.Env.InactiveRetentionDays) * day,
+		PurgeMode:       app.Env.InactivePurgeMode,
+	}
+}
+
+// SendPeriodicMessages sends the messages that are due on a schedule, currently the inactivity warnings
+func SendPeriodicMessages(ctx context.Context, tx *sql.Tx) {
+	if _, err := SendInactivityWarnings(ctx, tx, LifecyclePolicyFromEnv(), time.Now()); err != nil {
+		log.Errorf("failed to send inactivity warnings: %s", err)
+	}
+}
+
+// EnforceAccountLifecycle deactivates and purges inactive users according to the policy configured in app.Env
+func EnforceAccountLifecycle(ctx context.Context, tx *sql.Tx) error {
+	policy := LifecyclePolicyFromEnv()
+	now := time.Now()
+
+	deactivated, err := DeactivateInactiveUsers(ctx, tx, policy, now)
+	if err != nil {
+		return err
+	}
+
+	purged, err := PurgeInactiveUsers(ctx, tx, policy, now)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"deactivated": deactivated,
+		"purged":      purged,
+		"purgeMode":   policy.PurgeMode,
+	}).Info("account lifecycle complete")
+	return nil
+}
+
+// SendInactivityWarnings warns each active user who has not logged in for policy.WarnAfter that the account will be
+// deactivated. A user who was warned recently is not warned again. It returns the number of warnings sent.
+func SendInactivityWarnings(ctx context.Context, tx *sql.Tx, policy LifecyclePolicy, now time.Time) (int, error) {
+	if policy.WarnAfter <= 0 {
+		return 0, nil
+	}
+
+	users, err := data.FindUsersToWarn(ctx, tx, now.Add(-policy.WarnAfter))
+	if err != nil {
+		return 0, err
+	}
+
+	numSent := 0
+	for _, user := range users {
+		if user.HasReceivedMessageRecently(ctx, tx, message.InactivityWarning) {
+			continue
+		}
+
+		params := message.Params{
+			Template: message.InactivityWarning,
+			Locale:   user.Language,
+			To:       []message.Address{message.NewAddress(user.GetDisplayName(), user.GetEmail())},
+			Fields: message.Fields{
+				"DisplayName":      user.GetDisplayName(),
+				"LastLogin":        app.FormatDate(user.LastLoginAt, user.TimeZone, user.Language),
+				"DeactivationDate": app.FormatDate(now.Add(policy.DeactivateAfter), user.TimeZone, user.Language),
+				"Language":         user.Language,
+				"AppURL":           app.Env.AppURL,
+			},
+		}
+		if err = sendMessage(ctx, tx, int(user.ID), params); err != nil {
+			log.Errorf("failed to send inactivity warning to user %d: %s", user.ID, err)
+			continue
+		}
+		numSent++
+	}
+
+	log.WithFields(log.Fields{"numSent": numSent, "numInactive": len(users)}).Info("sent inactivity warnings")
+	return numSent, nil
+}
+
+// DeactivateInactiveUsers deactivates each user who was warned at least policy.DeactivateAfter ago and has not logged
+// in since. It returns the number of users deactivated.
+func DeactivateInactiveUsers(ctx context.Context, tx *sql.Tx, policy LifecyclePolicy, now time.Time) (int, error) {
+	if policy.WarnAfter <= 0 || policy.DeactivateAfter <= 0 {
+		return 0, nil
+	}
+
+	inactiveSince := now.Add(-policy.WarnAfter - policy.DeactivateAfter)
+	warnedBefore := now.Add(-policy.DeactivateAfter)
+	users, err := data.FindUsersToDeactivate(ctx, tx, inactiveSince, warnedBefore, message.InactivityWarning)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		user.Active = false
+		if err = saveUser(ctx, tx, AuditUserDeactivate, user); err != nil {
+			return 0, fmt.Errorf("failed to deactivate user %d: %w", user.ID, err)
+		}
+		log.Infof("deactivated inactive user %d, last login %s", user.ID, user.LastLoginAt.Format(time.DateOnly))
+	}
+	return len(users), nil
+}
+
+// PurgeInactiveUsers anonymizes or permanently deletes, according to policy.PurgeMode, each inactive or deleted user
+// that has not been changed for policy.PurgeAfter. It returns the number of users purged.
+func PurgeInactiveUsers(ctx context.Context, tx *sql.Tx, policy LifecyclePolicy, now time.Time) (int, error) {
+	if policy.PurgeAfter <= 0 {
+		return 0, nil
+	}
+	if policy.PurgeMode != PurgeModeAnonymize && policy.PurgeMode != PurgeModeDelete {
+		return 0, fmt.Errorf("invalid purge mode %q", policy.PurgeMode)
+	}
+
+	users, err := data.FindUsersToPurge(ctx, tx, now.Add(-policy.PurgeAfter))
+	if err != nil {
+		return 0, err
+	}
+
+	numPurged := 0
+	for _, user := range users {
+		if policy.PurgeMode == PurgeModeDelete {
+			err = purgeUser(ctx, tx, user)
+		} else if !isAnonymized(user) {
+			err = anonymizeUser(ctx, tx, user)
+		} else {
+			continue
+		}
+		if err != nil {
+			return numPurged, fmt.Errorf("failed to purge user %d: %w", user.ID, err)
+		}
+		numPurged++
+	}
+	return numPurged, nil
+}
+
+// anonymizeUser replaces the personal data of a user, keeping the record so that references to it remain valid
+func anonymizeUser(ctx context.Context, tx *sql.Tx, user data.User) error {
+	placeholder := anonymizedPrefix + strconv.Itoa(int(user.ID))
+	user.EmployeeID = placeholder
+	user.Username = placeholder
+	user.Email = placeholder + "@invalid"
+	user.FirstName = ""
+	user.LastName = ""
+	user.DisplayName = ""
+	user.Active = false
+	user.Locked = true
+	user.Admin = false
+	user.User.Attributes = nil
+	if err := user.Update(ctx, tx); err != nil {
+		return err
+	}
+	// the personal data is not copied into the audit log, since the point is to remove it
+	return recordUserAudit(ctx, tx, AuditUserAnonymize, user)
+}
+
+// purgeUser permanently deletes a user and records the deletion in the audit log
+func purgeUser(ctx context.Context, tx *sql.Tx, user data.User) error {
+	if err := user.Purge(ctx, tx); err != nil {
+		return err
+	}
+	return recordUserAudit(ctx, tx, AuditUserPurge, user)
+}
+
+func isAnonymized(user data.User) bool {
+	return strings.HasPrefix(user.Username, anonymizedPrefix)
+}
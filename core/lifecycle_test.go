@@ -0,0 +1,119 @@
+package core
+
+import (
+	"net/mail"
+	"time"
+
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/email"
+)
+
+var testLifecyclePolicy = LifecyclePolicy{
+	WarnAfter:       180 * day,
+	DeactivateAfter: 30 * day,
+	PurgeAfter:      365 * day,
+	PurgeMode:       PurgeModeAnonymize,
+}
+
+// setLastLogin changes the last login time of a user
+func (s *Suite) setLastLogin(user data.User, lastLogin time.Time) {
+	_, err := s.tx.ExecContext(s.ctx, "UPDATE users SET last_login_at = $1 WHERE id = $2", lastLogin, user.ID)
+	s.NoError(err)
+}
+
+// sendQueuedEmails sends the messages waiting in the email outbox to a fake email service, as the email worker would.
+// Since the worker uses its own transactions, the test transaction is committed first and a new one is started.
+func (s *Suite) sendQueuedEmails() *email.FakeEmailService {
+	s.NoError(s.tx.Commit())
+	fake := email.NewFake(email.FakeConfig{}).(*email.FakeEmailService)
+	_, err := ProcessEmailOutbox(s.ctx, s.db, fake, time.Now())
+	s.NoError(err)
+	s.tx, err = s.db.BeginTx(s.ctx, nil)
+	s.NoError(err)
+	return fake
+}
+
+func (s *Suite) TestAccountLifecycle() {
+	now := time.Now()
+	inactive := s.createUser("10001", "inactive")
+	s.setLastLogin(inactive, now.Add(-200*day))
+	s.createUser("10002", "active")
+
+	n, err := SendInactivityWarnings(s.ctx, s.tx, testLifecyclePolicy, now)
+	s.NoError(err)
+	s.Equal(1, n)
+
+	n, err = SendInactivityWarnings(s.ctx, s.tx, testLifecyclePolicy, now)
+	s.NoError(err)
+	s.Equal(0, n, "a warning waiting in the outbox should not be queued again")
+
+	fake := s.sendQueuedEmails()
+	s.Equal(1, fake.GetNumberOfMessagesSent())
+	to, err := mail.ParseAddress(fake.GetLastToEmail())
+	s.NoError(err)
+	s.Equal(&mail.Address{Name: "Test User 10001", Address: "inactive@example.com"}, to)
+
+	n, err = SendInactivityWarnings(s.ctx, s.tx, testLifecyclePolicy, now)
+	s.NoError(err)
+	s.Equal(0, n, "a user who was warned recently should not be warned again")
+
+	n, err = DeactivateInactiveUsers(s.ctx, s.tx, testLifecyclePolicy, now)
+	s.NoError(err)
+	s.Equal(0, n, "a user should not be deactivated until DeactivateAfter has passed since the warning")
+
+	later := now.Add(testLifecyclePolicy.DeactivateAfter + day)
+	n, err = DeactivateInactiveUsers(s.ctx, s.tx, testLifecyclePolicy, later)
+	s.NoError(err)
+	s.Equal(1, n)
+	s.False(s.getUser(inactive.ID).Active)
+
+	n, err = PurgeInactiveUsers(s.ctx, s.tx, testLifecyclePolicy, later)
+	s.NoError(err)
+	s.Equal(0, n, "a user should not be purged until PurgeAfter has passed since the last change")
+
+	muchLater := now.Add(testLifecyclePolicy.PurgeAfter + day)
+	n, err = PurgeInactiveUsers(s.ctx, s.tx, testLifecyclePolicy, muchLater)
+	s.NoError(err)
+	s.Equal(1, n)
+	anonymized := s.getUser(inactive.ID)
+	s.True(isAnonymized(anonymized))
+	s.Equal("", anonymized.FirstName)
+	s.NotContains(anonymized.Email, "inactive")
+
+	n, err = PurgeInactiveUsers(s.ctx, s.tx, testLifecyclePolicy, muchLater)
+	s.NoError(err)
+	s.Equal(0, n, "an anonymized user should not be anonymized again")
+
+	deletePolicy := testLifecyclePolicy
+	deletePolicy.PurgeMode = PurgeModeDelete
+	n, err = PurgeInactiveUsers(s.ctx, s.tx, deletePolicy, muchLater)
+	s.NoError(err)
+	s.Equal(1, n)
+	_, err = data.GetUserIncludingDeleted(s.ctx, s.tx, int(inactive.ID))
+	s.Error(err, "a purged user should be deleted")
+}
+
+func (s *Suite) TestAccountLifecycle_Disabled() {
+	inactive := s.createUser("10001", "inactive")
+	s.setLastLogin(inactive, time.Now().Add(-1000*day))
+
+	n, err := SendInactivityWarnings(s.ctx, s.tx, LifecyclePolicy{}, time.Now())
+	s.NoError(err)
+	s.Equal(0, n)
+
+	n, err = DeactivateInactiveUsers(s.ctx, s.tx, LifecyclePolicy{WarnAfter: 180 * day}, time.Now())
+	s.NoError(err)
+	s.Equal(0, n)
+
+	_, err = PurgeInactiveUsers(s.ctx, s.tx, LifecyclePolicy{PurgeAfter: day, PurgeMode: "shred"}, time.Now())
+	s.ErrorContains(err, "invalid purge mode")
+}
+
+func (s *Suite) TestSendWelcomeMessage() {
+	user := s.createUser("10001", "new_user")
+	s.NoError(sendWelcomeMessage(s.ctx, s.tx, user))
+
+	to, err := mail.ParseAddress(s.sendQueuedEmails().GetLastToEmail())
+	s.NoError(err)
+	s.Equal("new_user@example.com", to.Address)
+}
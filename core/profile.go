@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+const maxDisplayNameLength = 100
+
+// ProfileInput holds the fields a user may change on their own profile
+type ProfileInput struct {
+	DisplayName        string
+	TimeZone           string
+	Language           string
+	EmailNotifications bool
+
+	// Attributes holds the form values of the custom attributes the user may change, keyed by name. Only the
+	// attributes included are changed.
+	Attributes map[string]string
+}
+
+// Validate checks the input and returns FieldErrors if any field is invalid
+func (i ProfileInput) Validate() error {
+	errs := FieldErrors{}
+	if utf8.RuneCountInString(i.DisplayName) > maxDisplayNameLength {
+		errs["display_name"] = fmt.Sprintf("Display name must be at most %d characters", maxDisplayNameLength)
+	}
+	if _, err := time.LoadLocation(i.TimeZone); err != nil || i.TimeZone == "" || i.TimeZone == "Local" {
+		errs["time_zone"] = "Time zone must be a valid IANA time zone, like America/New_York"
+	}
+	if !app.IsSupportedLanguage(i.Language) {
+		errs["language"] = "Language is not supported"
+	}
+	parseAttributes(i.Attributes, app.UserAttribute.EditableByUser, errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// UpdateProfile validates the input and saves it to the user record. If the input is invalid, the returned error is a
+// FieldErrors.
+func UpdateProfile(ctx context.Context, tx *sql.Tx, user data.User, input ProfileInput) (data.User, error) {
+	input.DisplayName = strings.TrimSpace(input.DisplayName)
+	input.TimeZone = strings.TrimSpace(input.TimeZone)
+	if err := input.Validate(); err != nil {
+		return user, err
+	}
+
+	user.DisplayName = input.DisplayName
+	user.TimeZone = input.TimeZone
+	user.Language = input.Language
+	user.EmailNotifications = input.EmailNotifications
+	attributes := parseAttributes(input.Attributes, app.UserAttribute.EditableByUser, FieldErrors{})
+	if err := setAttributes(&user, attributes); err != nil {
+		return user, err
+	}
+	if err := saveUser(ctx, tx, AuditProfileUpdate, user); err != nil {
+		return user, fmt.Errorf("failed to update profile of user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
@@ -9,19 +9,21 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/briskt/go-htmx-app/api"
 	"github.com/briskt/go-htmx-app/data"
 )
 
-func FindUserByToken(ctx context.Context, tx *sql.Tx, token string) (data.User, error) {
+// FindUserByToken returns the user holding an access token, if the token has not expired at the time now
+func FindUserByToken(ctx context.Context, tx *sql.Tx, token string, now time.Time) (data.User, error) {
 	accessToken, err := data.FindAccessTokenByHash(ctx, tx, HashAccessToken(token))
 	if err != nil {
 		return data.User{}, errors.New("invalid access token")
 	}
 
-	if accessToken.ExpiresAt.Before(time.Now()) {
+	if accessToken.ExpiresAt.Before(now) {
 		return data.User{}, errors.New("expired access token")
 	}
 
@@ -47,15 +49,50 @@ func NewToken(ctx context.Context, tx *sql.Tx, staffID string) (string, error) {
 		return "", api.NewAppError(err, api.ErrorGeneratingRandomToken, http.StatusInternalServerError)
 	}
 
-	_, err = data.CreateAccessToken(ctx, tx, int(user.ID), HashAccessToken(rawToken))
+	accessToken, err := data.CreateAccessToken(ctx, tx, int(user.ID), HashAccessToken(rawToken))
 	if err != nil {
 		err = fmt.Errorf("error creating access token: %w", err)
 		return "", api.NewAppError(err, api.ErrorCreatingAccessToken, http.StatusInternalServerError)
 	}
 
+	err = RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditTokenCreate,
+		TargetType: AuditTargetToken,
+		TargetID:   strconv.Itoa(int(accessToken.ID)),
+		ActorID:    int(user.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+
 	return rawToken, nil
 }
 
+// RecordLogin adds a login of the user to the audit log
+func RecordLogin(ctx context.Context, tx *sql.Tx, user data.User) error {
+	return RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditLogin,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		ActorID:    int(user.ID),
+	})
+}
+
+// RecordLogout adds a logout to the audit log for the user holding the token. Nothing is recorded if the token is not
+// valid at the time now.
+func RecordLogout(ctx context.Context, tx *sql.Tx, token string, now time.Time) error {
+	user, err := FindUserByToken(ctx, tx, token, now)
+	if err != nil {
+		return nil
+	}
+	return RecordAudit(ctx, tx, AuditEvent{
+		Action:     AuditLogout,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.Itoa(int(user.ID)),
+		ActorID:    int(user.ID),
+	})
+}
+
 func getRandomToken() (string, error) {
 	rb := make([]byte, 32)
 
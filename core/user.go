@@ -3,21 +3,306 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
 
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/app"
 	"github.com/briskt/go-htmx-app/data"
-	"github.com/briskt/go-htmx-app/email"
 	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
 )
 
-func sendWelcomeMessage(ctx context.Context, tx *sql.Tx, svc email.Service, user data.User) error {
+// FieldErrors maps the names of invalid input fields to a user-friendly message for each
+type FieldErrors map[string]string
+
+func (f FieldErrors) Error() string {
+	fields := make([]string, 0, len(f))
+	for field, msg := range f {
+		fields = append(fields, field+": "+msg)
+	}
+	sort.Strings(fields)
+	return "invalid input: " + strings.Join(fields, "; ")
+}
+
+// uniqueUserFieldLabels maps the user fields that must be unique to their user-facing labels
+var uniqueUserFieldLabels = map[string]string{
+	"employee_id": "employee ID",
+	"username":    "username",
+	"email":       "email",
+}
+
+// UserInput holds the editable fields of a user
+type UserInput struct {
+	EmployeeID  string
+	FirstName   string
+	LastName    string
+	DisplayName string
+	Username    string
+	Email       string
+
+	// Attributes holds the form values of custom attributes, keyed by name. UpdateUser changes only the attributes
+	// included, and ignores those that cannot be changed by an admin.
+	Attributes map[string]string
+}
+
+// Validate checks the input and returns FieldErrors if any field is invalid
+func (i UserInput) Validate() error {
+	errs := FieldErrors{}
+	if i.Username == "" {
+		errs["username"] = "Username is required"
+	}
+	if i.EmployeeID == "" {
+		errs["employee_id"] = "Employee ID is required"
+	}
+	if addr, err := mail.ParseAddress(i.Email); err != nil || addr.Address != i.Email {
+		errs["email"] = "Email must be a valid email address"
+	}
+	parseAttributes(i.Attributes, app.UserAttribute.EditableByAdmin, errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// trim removes leading and trailing whitespace from all fields
+func (i UserInput) trim() UserInput {
+	return UserInput{
+		EmployeeID:  strings.TrimSpace(i.EmployeeID),
+		FirstName:   strings.TrimSpace(i.FirstName),
+		LastName:    strings.TrimSpace(i.LastName),
+		DisplayName: strings.TrimSpace(i.DisplayName),
+		Username:    strings.TrimSpace(i.Username),
+		Email:       strings.TrimSpace(i.Email),
+		Attributes:  i.Attributes,
+	}
+}
+
+// CreateUser validates the input and creates a new user record. If the input is invalid, the returned error is a
+// FieldErrors. If the employee ID, username or email is already in use, the returned error is an
+// ErrorUserAlreadyExists AppError.
+func CreateUser(ctx context.Context, tx *sql.Tx, input UserInput) (data.User, error) {
+	input = input.trim()
+	if err := input.Validate(); err != nil {
+		return data.User{}, err
+	}
+
+	if err := checkUserUnique(ctx, tx, input, 0); err != nil {
+		return data.User{}, err
+	}
+
+	return createUser(ctx, tx, data.UserCreateInput{
+		EmployeeID:  input.EmployeeID,
+		FirstName:   input.FirstName,
+		LastName:    input.LastName,
+		DisplayName: input.DisplayName,
+		Username:    input.Username,
+		Email:       input.Email,
+	})
+}
+
+// UpdateUser validates the input and saves it to the user record. If the input is invalid, the returned error is a
+// FieldErrors. If the employee ID, username or email is in use by another user, the returned error is an
+// ErrorUserAlreadyExists AppError. If the record was changed since user was read, as shown by its version, nothing is
+// saved and the returned error is an ErrorUserChanged AppError.
+func UpdateUser(ctx context.Context, tx *sql.Tx, user data.User, input UserInput) (data.User, error) {
+	input = input.trim()
+	if err := input.Validate(); err != nil {
+		return user, err
+	}
+	if err := checkUserUnique(ctx, tx, input, int(user.ID)); err != nil {
+		return user, err
+	}
+
+	user.EmployeeID = input.EmployeeID
+	user.FirstName = input.FirstName
+	user.LastName = input.LastName
+	user.DisplayName = input.DisplayName
+	user.Username = input.Username
+	user.Email = input.Email
+	attributes := parseAttributes(input.Attributes, app.UserAttribute.EditableByAdmin, FieldErrors{})
+	if err := setAttributes(&user, attributes); err != nil {
+		return user, err
+	}
+	if err := saveUser(ctx, tx, AuditUserUpdate, user); err != nil {
+		return user, fmt.Errorf("failed to update user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
+
+// SetUserLocked locks or unlocks a user account. An admin cannot change their own account.
+func SetUserLocked(ctx context.Context, tx *sql.Tx, admin, user data.User, locked bool) (data.User, error) {
+	if admin.ID == user.ID {
+		err := fmt.Errorf("admin %q attempted to change own locked status", admin.EmployeeID)
+		return user, api.NewAppError(err, api.ErrorModifyingSelf, http.StatusBadRequest)
+	}
+
+	user.Locked = locked
+	action := AuditUserUnlock
+	if locked {
+		action = AuditUserLock
+	}
+	if err := saveUser(ctx, tx, action, user); err != nil {
+		return user, fmt.Errorf("failed to update user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
+
+// SetUserActive activates or deactivates a user account. An admin cannot change their own account.
+func SetUserActive(ctx context.Context, tx *sql.Tx, admin, user data.User, active bool) (data.User, error) {
+	if admin.ID == user.ID {
+		err := fmt.Errorf("admin %q attempted to change own active status", admin.EmployeeID)
+		return user, api.NewAppError(err, api.ErrorModifyingSelf, http.StatusBadRequest)
+	}
+
+	user.Active = active
+	action := AuditUserDeactivate
+	if active {
+		action = AuditUserActivate
+	}
+	if err := saveUser(ctx, tx, action, user); err != nil {
+		return user, fmt.Errorf("failed to update user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
+
+// DeleteUser marks a user as deleted, which hides the user from lists and lookups and ends the user's sessions. An
+// admin cannot delete their own account.
+func DeleteUser(ctx context.Context, tx *sql.Tx, admin, user data.User) error {
+	if admin.ID == user.ID {
+		err := fmt.Errorf("admin %q attempted to delete own account", admin.EmployeeID)
+		return api.NewAppError(err, api.ErrorModifyingSelf, http.StatusBadRequest)
+	}
+
+	if err := user.Delete(ctx, tx); err != nil {
+		return err
+	}
+	if err := recordUserAudit(ctx, tx, AuditUserDelete, user); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"userID": user.ID, "admin": admin.EmployeeID}).Info("user deleted")
+	return nil
+}
+
+// RestoreUser clears the deleted mark of a user
+func RestoreUser(ctx context.Context, tx *sql.Tx, admin, user data.User) (data.User, error) {
+	if !user.IsDeleted() {
+		err := fmt.Errorf("user %d is not deleted", user.ID)
+		return user, api.NewAppError(err, api.ErrorUserNotDeleted, http.StatusBadRequest)
+	}
+
+	if err := user.Restore(ctx, tx); err != nil {
+		return user, err
+	}
+	if err := recordUserAudit(ctx, tx, AuditUserRestore, user); err != nil {
+		return user, err
+	}
+	log.WithFields(log.Fields{"userID": user.ID, "admin": admin.EmployeeID}).Info("user restored")
+	return data.GetUser(ctx, tx, int(user.ID))
+}
+
+// PurgeUser permanently removes a deleted user and all records related to the user. A user must be deleted before it
+// can be purged.
+func PurgeUser(ctx context.Context, tx *sql.Tx, admin, user data.User) error {
+	if !user.IsDeleted() {
+		err := fmt.Errorf("user %d must be deleted before it is purged", user.ID)
+		return api.NewAppError(err, api.ErrorUserNotDeleted, http.StatusBadRequest)
+	}
+
+	if err := purgeUser(ctx, tx, user); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"userID": user.ID, "admin": admin.EmployeeID}).Info("user purged")
+	return nil
+}
+
+// checkUserUnique returns an ErrorUserAlreadyExists AppError if a user other than the one with ID userID, including
+// a deleted user, has the same employee ID, username or email as the input. Usernames and emails are compared
+// without regard to case. Any other error of the lookups is returned.
+func checkUserUnique(ctx context.Context, tx *sql.Tx, input UserInput, userID int) error {
+	checks := []struct {
+		field, value string
+		find         func() (data.User, error)
+	}{
+		{"employee_id", input.EmployeeID, func() (data.User, error) {
+			return data.FindUserByEmployeeIDIncludingDeleted(ctx, tx, input.EmployeeID)
+		}},
+		{"username", input.Username, func() (data.User, error) {
+			return data.FindUserByUsernameIncludingDeleted(ctx, tx, input.Username)
+		}},
+		{"email", input.Email, func() (data.User, error) {
+			return data.FindUserByEmailIncludingDeleted(ctx, tx, input.Email)
+		}},
+	}
+	for _, check := range checks {
+		existing, err := check.find()
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %s %q: %w", uniqueUserFieldLabels[check.field], check.value, err)
+		}
+		if int(existing.ID) == userID {
+			continue
+		}
+		label := uniqueUserFieldLabels[check.field]
+		err = fmt.Errorf("a %suser with %s %q already exists", deletedLabel(existing), label, check.value)
+		appErr := api.NewAppError(err, api.ErrorUserAlreadyExists, http.StatusConflict)
+		appErr.Fields = map[string]string{check.field: inUseMessage(label)}
+		return appErr
+	}
+	return nil
+}
+
+// duplicateUserError converts a data.DuplicateUserError, from a unique index on users, to an ErrorUserAlreadyExists
+// AppError. Any other error is returned unchanged.
+func duplicateUserError(err error) error {
+	var dupErr *data.DuplicateUserError
+	if !errors.As(err, &dupErr) {
+		return err
+	}
+	appErr := api.NewAppError(err, api.ErrorUserAlreadyExists, http.StatusConflict)
+	appErr.Fields = map[string]string{dupErr.Field: inUseMessage(uniqueUserFieldLabels[dupErr.Field])}
+	return appErr
+}
+
+// userUpdateError converts the errors of data.User.Update to AppErrors: ErrorUserAlreadyExists for a duplicate value,
+// or ErrorUserChanged if the user was changed since it was read. Any other error is returned unchanged.
+func userUpdateError(err error) error {
+	if errors.Is(err, data.ErrorRowNotUpdated) {
+		return api.NewAppError(err, api.ErrorUserChanged, http.StatusConflict)
+	}
+	return duplicateUserError(err)
+}
+
+// inUseMessage returns the user-facing message for a field whose value belongs to another user
+func inUseMessage(label string) string {
+	return fmt.Sprintf("This %s is already in use by another user", label)
+}
+
+// deletedLabel returns "deleted " for a deleted user, to clarify error messages
+func deletedLabel(user data.User) string {
+	if user.IsDeleted() {
+		return "deleted "
+	}
+	return ""
+}
+
+func sendWelcomeMessage(ctx context.Context, tx *sql.Tx, user data.User) error {
 	fields := map[string]any{
 		"DisplayName": user.GetDisplayName(),
 		"Username":    user.Username,
+		"Language":    user.Language,
 	}
 	params := message.Params{
 		Template: message.Welcome,
-		To:       message.NewAddress(user.GetEmail(), user.GetDisplayName()),
+		Locale:   user.Language,
+		To:       []message.Address{message.NewAddress(user.GetDisplayName(), user.GetEmail())},
 		Fields:   fields,
 	}
-	return sendMessage(ctx, tx, svc, int(user.ID), params)
+	return sendMessage(ctx, tx, int(user.ID), params)
 }
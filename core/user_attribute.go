@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+// parseAttributes converts the form values of custom user attributes, keyed by attribute name, to typed values. Only
+// the registered attributes allowed by editable are read. An invalid value is added to errs under the attribute's
+// form field name.
+func parseAttributes(values map[string]string, editable func(app.UserAttribute) bool, errs FieldErrors) map[string]any {
+	parsed := map[string]any{}
+	for _, a := range app.UserAttributes {
+		value, ok := values[a.Name]
+		if !ok || !editable(a) {
+			continue
+		}
+		v, err := a.Parse(value)
+		if err != nil {
+			errs[a.FieldName()] = err.Error()
+			continue
+		}
+		parsed[a.Name] = v
+	}
+	return parsed
+}
+
+// setAttributes changes the custom attributes of user to the parsed values
+func setAttributes(user *data.User, values map[string]any) error {
+	for name, value := range values {
+		if err := user.SetAttribute(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncSAMLAttributes copies the values of the SAML-sourced custom attributes from the attributes of a SAML assertion
+// to the user record. An attribute missing from the assertion is cleared, and an invalid value is logged and ignored.
+func SyncSAMLAttributes(ctx context.Context, tx *sql.Tx, user data.User, samlValues map[string]string) (data.User, error) {
+	changed := false
+	for _, a := range app.UserAttributes {
+		if !a.SAMLSourced() {
+			continue
+		}
+		value, err := a.Parse(samlValues[a.SAMLAttribute])
+		if err != nil {
+			log.WithFields(log.Fields{"userID": user.ID, "attribute": a.Name}).
+				Warningf("invalid SAML attribute %q: %s", a.SAMLAttribute, err)
+			continue
+		}
+		if a.Format(value) == a.Format(user.Attribute(a.Name)) {
+			continue
+		}
+		if err = user.SetAttribute(a.Name, value); err != nil {
+			return user, err
+		}
+		changed = true
+	}
+	if !changed {
+		return user, nil
+	}
+
+	if err := saveUser(ctx, tx, AuditUserUpdate, user); err != nil {
+		return user, fmt.Errorf("failed to save SAML attributes of user %d: %w", user.ID, err)
+	}
+	return data.GetUser(ctx, tx, int(user.ID))
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/briskt/go-htmx-app/api"
+	"github.com/briskt/go-htmx-app/data"
+)
+
+// UserCSVHeader lists the columns written by ExportUsers. ImportUsers reads the same columns, in any order, except
+// last_login_at, and ignores any others. Only employee_id, username and email are required, so a file exported from
+// the app can be edited and imported again.
+var UserCSVHeader = []string{
+	"employee_id", "first_name", "last_name", "display_name", "username", "email", "active", "locked", "last_login_at",
+}
+
+var requiredImportColumns = []string{"employee_id", "username", "email"}
+
+const exportPageSize = 500
+
+// ImportAction describes what an import does with one row of the file
+type ImportAction string
+
+const (
+	ImportCreate    ImportAction = "create"
+	ImportUpdate    ImportAction = "update"
+	ImportUnchanged ImportAction = "unchanged"
+	ImportInvalid   ImportAction = "invalid"
+)
+
+// FieldChange is a difference between a user record and a row of an import file
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ImportRow is the outcome of one row of an import file
+type ImportRow struct {
+	// Line is the line number in the file, counting the header as line 1
+	Line       int
+	Action     ImportAction
+	EmployeeID string
+	Username   string
+	Changes    []FieldChange
+	Errors     FieldErrors
+}
+
+// ImportResult lists the outcome of each row of an import file. Applied is true only if the changes were saved.
+type ImportResult struct {
+	Rows      []ImportRow
+	Created   int
+	Updated   int
+	Unchanged int
+	Invalid   int
+	Applied   bool
+}
+
+// HasChanges returns true if the import creates or updates at least one user
+func (r ImportResult) HasChanges() bool {
+	return r.Created+r.Updated > 0
+}
+
+// importRecord is a parsed and validated row of an import file, ready to be saved
+type importRecord struct {
+	existing *data.User
+	user     data.User
+}
+
+// ImportUsers reads a CSV file of users and matches each row to an existing user by employee_id. Every row is
+// validated before anything is saved. If apply is false, or if any row is invalid, no changes are made and the result
+// is a preview of what the import would do. Otherwise, new users are created and changed users are updated within tx.
+// A file that can't be read as CSV returns an ErrorImportInvalidFile AppError.
+func ImportUsers(ctx context.Context, tx *sql.Tx, r io.Reader, apply bool) (ImportResult, error) {
+	var result ImportResult
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		err = fmt.Errorf("failed to read CSV header: %w", err)
+		return result, api.NewAppError(err, api.ErrorImportInvalidFile, http.StatusBadRequest)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			err = fmt.Errorf("CSV file is missing the %q column", name)
+			return result, api.NewAppError(err, api.ErrorImportInvalidFile, http.StatusBadRequest)
+		}
+	}
+
+	var records []importRecord
+	employeeIDs := map[string]int{}
+	usernames := map[string]int{}
+	emails := map[string]int{}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read CSV file: %w", err)
+			return result, api.NewAppError(err, api.ErrorImportInvalidFile, http.StatusBadRequest)
+		}
+		line, _ := reader.FieldPos(0)
+
+		importRow, record, err := parseImportRow(ctx, tx, columns, row)
+		if err != nil {
+			return result, err
+		}
+		importRow.Line = line
+
+		if prev, ok := employeeIDs[strings.ToLower(importRow.EmployeeID)]; ok && importRow.EmployeeID != "" {
+			addImportError(&importRow, "employee_id", fmt.Sprintf("Employee ID is repeated from line %d", prev))
+		}
+		if prev, ok := usernames[strings.ToLower(importRow.Username)]; ok && importRow.Username != "" {
+			addImportError(&importRow, "username", fmt.Sprintf("Username is repeated from line %d", prev))
+		}
+		if prev, ok := emails[strings.ToLower(record.user.Email)]; ok && record.user.Email != "" {
+			addImportError(&importRow, "email", fmt.Sprintf("Email is repeated from line %d", prev))
+		}
+		employeeIDs[strings.ToLower(importRow.EmployeeID)] = line
+		usernames[strings.ToLower(importRow.Username)] = line
+		emails[strings.ToLower(record.user.Email)] = line
+
+		switch importRow.Action {
+		case ImportCreate:
+			result.Created++
+		case ImportUpdate:
+			result.Updated++
+		case ImportUnchanged:
+			result.Unchanged++
+		case ImportInvalid:
+			result.Invalid++
+		}
+		result.Rows = append(result.Rows, importRow)
+		records = append(records, record)
+	}
+
+	if !apply || result.Invalid > 0 {
+		return result, nil
+	}
+
+	for i, record := range records {
+		if err := saveImportRecord(ctx, tx, record, result.Rows[i].Action); err != nil {
+			return result, fmt.Errorf("failed to import line %d: %w", result.Rows[i].Line, err)
+		}
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// parseImportRow validates one row of an import file and compares it to the existing user, if any. Columns missing
+// from the file keep their existing values.
+func parseImportRow(ctx context.Context, tx *sql.Tx, columns map[string]int, row []string) (ImportRow, importRecord, error) {
+	value := func(name string) (string, bool) {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return "", false
+		}
+		return strings.TrimSpace(row[i]), true
+	}
+
+	employeeID, _ := value("employee_id")
+	var record importRecord
+	user := data.User{}
+	user.Active = true
+	if existing, err := data.FindUserByEmployeeID(ctx, tx, employeeID); err == nil {
+		record.existing = &existing
+		user = existing
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return ImportRow{}, record, err
+	}
+	var deletedEmployee bool
+	if record.existing == nil {
+		if _, err := data.FindUserByEmployeeIDIncludingDeleted(ctx, tx, employeeID); err == nil {
+			deletedEmployee = true
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return ImportRow{}, record, err
+		}
+	}
+
+	input := UserInput{
+		EmployeeID:  employeeID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DisplayName: user.DisplayName,
+		Username:    user.Username,
+		Email:       user.Email,
+	}
+	for name, field := range map[string]*string{
+		"first_name":   &input.FirstName,
+		"last_name":    &input.LastName,
+		"display_name": &input.DisplayName,
+		"username":     &input.Username,
+		"email":        &input.Email,
+	} {
+		if v, ok := value(name); ok {
+			*field = v
+		}
+	}
+
+	importRow := ImportRow{EmployeeID: input.EmployeeID, Username: input.Username}
+	if err := input.Validate(); err != nil {
+		importRow.Errors = err.(FieldErrors)
+	}
+
+	if deletedEmployee {
+		addImportError(&importRow, "employee_id", "Employee ID belongs to a deleted user, who must be restored first")
+	}
+
+	if v, ok := value("active"); ok && v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			addImportError(&importRow, "active", "Active must be true or false")
+		}
+		user.Active = active
+	}
+	if v, ok := value("locked"); ok && v != "" {
+		locked, err := strconv.ParseBool(v)
+		if err != nil {
+			addImportError(&importRow, "locked", "Locked must be true or false")
+		}
+		user.Locked = locked
+	}
+
+	// the unique indexes include deleted users, so a value of a deleted user can't be reused
+	if other, err := data.FindUserByUsernameIncludingDeleted(ctx, tx, input.Username); err == nil &&
+		other.EmployeeID != input.EmployeeID {
+		addImportError(&importRow, "username", "Username is already in use by "+deletedLabel(other)+"employee "+
+			other.EmployeeID)
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ImportRow{}, record, err
+	}
+	if other, err := data.FindUserByEmailIncludingDeleted(ctx, tx, input.Email); err == nil &&
+		other.EmployeeID != input.EmployeeID {
+		addImportError(&importRow, "email", "Email is already in use by "+deletedLabel(other)+"employee "+
+			other.EmployeeID)
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ImportRow{}, record, err
+	}
+
+	user.EmployeeID = input.EmployeeID
+	user.FirstName = input.FirstName
+	user.LastName = input.LastName
+	user.DisplayName = input.DisplayName
+	user.Username = input.Username
+	user.Email = input.Email
+	user.DisplayName = user.GetDisplayName()
+	record.user = user
+
+	switch {
+	case len(importRow.Errors) > 0:
+		importRow.Action = ImportInvalid
+	case record.existing == nil:
+		importRow.Action = ImportCreate
+	default:
+		importRow.Changes = diffUsers(*record.existing, user)
+		importRow.Action = ImportUnchanged
+		if len(importRow.Changes) > 0 {
+			importRow.Action = ImportUpdate
+		}
+	}
+	return importRow, record, nil
+}
+
+// saveImportRecord creates or updates the user for one row of an import file
+func saveImportRecord(ctx context.Context, tx *sql.Tx, record importRecord, action ImportAction) error {
+	switch action {
+	case ImportCreate:
+		created, err := createUser(ctx, tx, data.UserCreateInput{
+			EmployeeID:  record.user.EmployeeID,
+			FirstName:   record.user.FirstName,
+			LastName:    record.user.LastName,
+			DisplayName: record.user.DisplayName,
+			Username:    record.user.Username,
+			Email:       record.user.Email,
+		})
+		if err != nil || (record.user.Active && !record.user.Locked) {
+			return err
+		}
+		created.Active = record.user.Active
+		created.Locked = record.user.Locked
+		action := AuditUserDeactivate
+		if created.Active {
+			action = AuditUserLock
+		}
+		return saveUser(ctx, tx, action, created)
+	case ImportUpdate:
+		return saveUser(ctx, tx, AuditUserUpdate, record.user)
+	}
+	return nil
+}
+
+// diffUsers lists the imported fields that differ between two versions of a user
+func diffUsers(old, new data.User) []FieldChange {
+	var changes []FieldChange
+	compare := func(field, o, n string) {
+		if o != n {
+			changes = append(changes, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+	compare("first_name", old.FirstName, new.FirstName)
+	compare("last_name", old.LastName, new.LastName)
+	compare("display_name", old.DisplayName, new.DisplayName)
+	compare("username", old.Username, new.Username)
+	compare("email", old.Email, new.Email)
+	compare("active", strconv.FormatBool(old.Active), strconv.FormatBool(new.Active))
+	compare("locked", strconv.FormatBool(old.Locked), strconv.FormatBool(new.Locked))
+	return changes
+}
+
+func addImportError(row *ImportRow, field, msg string) {
+	if row.Errors == nil {
+		row.Errors = FieldErrors{}
+	}
+	if _, ok := row.Errors[field]; !ok {
+		row.Errors[field] = msg
+	}
+	row.Action = ImportInvalid
+}
+
+// ExportUsers writes all users matching the filter to w as CSV, with the columns in UserCSVHeader. The filter's Limit
+// and Offset are ignored.
+func ExportUsers(ctx context.Context, tx *sql.Tx, w io.Writer, filter data.UserFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(UserCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	filter.Limit = exportPageSize
+	for filter.Offset = 0; ; filter.Offset += exportPageSize {
+		users, total, err := data.ListUsers(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			lastLogin := ""
+			if !user.LastLoginAt.IsZero() {
+				lastLogin = user.LastLoginAt.UTC().Format(time.RFC3339)
+			}
+			err = writer.Write([]string{
+				user.EmployeeID,
+				user.FirstName,
+				user.LastName,
+				user.DisplayName,
+				user.Username,
+				user.Email,
+				strconv.FormatBool(user.Active),
+				strconv.FormatBool(user.Locked),
+				lastLogin,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to write CSV row for user %d: %w", user.ID, err)
+			}
+		}
+		if filter.Offset+len(users) >= total || len(users) == 0 {
+			break
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/briskt/go-htmx-app/api"
+)
+
+// TestSetUserLocked checks that the returned user matches the saved record, so it can be saved again
+func (s *Suite) TestSetUserLocked() {
+	admin := s.createUser("10001", "admin")
+	user := s.createUser("10002", "jane")
+
+	locked, err := SetUserLocked(s.ctx, s.tx, admin, user, true)
+	s.NoError(err)
+	s.True(locked.Locked)
+	s.Equal(s.getUser(user.ID).Version, locked.Version)
+	s.Greater(locked.Version, user.Version)
+
+	unlocked, err := SetUserLocked(s.ctx, s.tx, admin, locked, false)
+	s.NoError(err)
+	s.False(unlocked.Locked)
+	s.Equal(s.getUser(user.ID).Version, unlocked.Version)
+
+	_, err = SetUserLocked(s.ctx, s.tx, admin, user, true)
+	s.Error(err, "a stale user should not be saved")
+
+	_, err = SetUserLocked(s.ctx, s.tx, admin, admin, true)
+	s.Error(err, "an admin should not lock their own account")
+}
+
+// TestSetUserActive checks that the returned user matches the saved record, so it can be saved again
+func (s *Suite) TestSetUserActive() {
+	admin := s.createUser("10001", "admin")
+	user := s.createUser("10002", "jane")
+
+	inactive, err := SetUserActive(s.ctx, s.tx, admin, user, false)
+	s.NoError(err)
+	s.False(inactive.Active)
+	s.Equal(s.getUser(user.ID).Version, inactive.Version)
+	s.Greater(inactive.Version, user.Version)
+
+	active, err := SetUserActive(s.ctx, s.tx, admin, inactive, true)
+	s.NoError(err)
+	s.True(active.Active)
+	s.Equal(s.getUser(user.ID).Version, active.Version)
+
+	_, err = SetUserActive(s.ctx, s.tx, admin, user, false)
+	s.Error(err, "a stale user should not be saved")
+
+	_, err = SetUserActive(s.ctx, s.tx, admin, admin, false)
+	s.Error(err, "an admin should not deactivate their own account")
+}
+
+// TestCheckUserUnique checks that only a missing user counts as unique, and that a failed lookup is returned
+func (s *Suite) TestCheckUserUnique() {
+	user := s.createUser("10001", "jane")
+	input := UserInput{EmployeeID: "10002", Username: "john", Email: "john@example.com"}
+
+	s.NoError(checkUserUnique(s.ctx, s.tx, input, 0))
+	input.Email = "JANE@example.com"
+	var appErr *api.AppError
+	s.ErrorAs(checkUserUnique(s.ctx, s.tx, input, 0), &appErr)
+	s.Equal(api.ErrorUserAlreadyExists, appErr.Key)
+	s.NoError(checkUserUnique(s.ctx, s.tx, input, int(user.ID)), "a user's own email is not a conflict")
+
+	closed, err := s.db.BeginTx(s.ctx, nil)
+	s.NoError(err)
+	s.NoError(closed.Rollback())
+	err = checkUserUnique(s.ctx, closed, input, 0)
+	s.Error(err, "a failed lookup should not be taken as unique")
+	s.False(errors.As(err, &appErr), "a failed lookup is not a conflict")
+}
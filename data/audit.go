@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/briskt/go-htmx-app/data/sqlc"
+)
+
+// AuditEvent is an entry in the audit log, with the usernames of the actor and impersonator, if any
+type AuditEvent struct {
+	sqlc.AuditEvent
+	ActorUsername        string
+	ImpersonatorUsername string
+}
+
+// AuditEventInput holds the fields of a new audit event. A zero ActorID or ImpersonatorID is stored as null. Before
+// and After must be JSON objects; if empty, an empty object is stored.
+type AuditEventInput struct {
+	ActorID        int
+	ImpersonatorID int
+	Action         string
+	TargetType     string
+	TargetID       string
+	Before         json.RawMessage
+	After          json.RawMessage
+	IP             string
+	RequestID      string
+}
+
+// AuditFilter selects and paginates audit events. Empty strings and null times match all events. Since is inclusive
+// and Until is exclusive.
+type AuditFilter struct {
+	Action     string
+	Actor      string
+	TargetType string
+	TargetID   string
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Limit      int
+	Offset     int
+}
+
+// CreateAuditEvent adds an event to the audit log
+func CreateAuditEvent(ctx context.Context, tx sqlc.DBTX, input AuditEventInput) error {
+	params := sqlc.CreateAuditEventParams{
+		Action:     input.Action,
+		TargetType: input.TargetType,
+		TargetID:   input.TargetID,
+		Before:     jsonObject(input.Before),
+		After:      jsonObject(input.After),
+		Ip:         input.IP,
+		RequestID:  input.RequestID,
+	}
+	if input.ActorID != 0 {
+		params.ActorID = newNullInt32(int32(input.ActorID))
+	}
+	if input.ImpersonatorID != 0 {
+		params.ImpersonatorID = newNullInt32(int32(input.ImpersonatorID))
+	}
+	if err := q(tx).CreateAuditEvent(ctx, params); err != nil {
+		return fmt.Errorf("failed to create audit event %q: %w", input.Action, err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns a page of audit events matching the filter, newest first, along with the total number of
+// matching events
+func ListAuditEvents(ctx context.Context, tx sqlc.DBTX, filter AuditFilter) ([]AuditEvent, int, error) {
+	rows, err := q(tx).ListAuditEvents(ctx, sqlc.ListAuditEventsParams{
+		Action:     filter.Action,
+		Actor:      filter.Actor,
+		TargetType: filter.TargetType,
+		TargetID:   filter.TargetID,
+		Since:      filter.Since,
+		Until:      filter.Until,
+		RowLimit:   int32(filter.Limit),
+		RowOffset:  int32(filter.Offset),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	total, err := q(tx).CountAuditEvents(ctx, sqlc.CountAuditEventsParams{
+		Action:     filter.Action,
+		Actor:      filter.Actor,
+		TargetType: filter.TargetType,
+		TargetID:   filter.TargetID,
+		Since:      filter.Since,
+		Until:      filter.Until,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	events := make([]AuditEvent, len(rows))
+	for i, row := range rows {
+		events[i] = AuditEvent{
+			AuditEvent:           row.AuditEvent,
+			ActorUsername:        row.ActorUsername,
+			ImpersonatorUsername: row.ImpersonatorUsername,
+		}
+	}
+	return events, int(total), nil
+}
+
+func jsonObject(j json.RawMessage) json.RawMessage {
+	if len(j) == 0 {
+		return json.RawMessage("{}")
+	}
+	return j
+}
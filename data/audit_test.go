@@ -0,0 +1,71 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+func (s *Suite) TestAuditEvents() {
+	user := insertUser(s.db)
+	userID := strconv.Itoa(int(user.ID))
+
+	s.NoError(CreateAuditEvent(s.ctx, s.db, AuditEventInput{
+		Action:     "user.create",
+		TargetType: "user",
+		TargetID:   userID,
+		After:      json.RawMessage(`{"username":"john_doe"}`),
+	}))
+	s.NoError(CreateAuditEvent(s.ctx, s.db, AuditEventInput{
+		ActorID:    int(user.ID),
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   userID,
+		IP:         "192.0.2.1",
+		RequestID:  "abc",
+	}))
+
+	events, total, err := ListAuditEvents(s.ctx, s.db, AuditFilter{Limit: 10})
+	s.NoError(err)
+	s.Equal(2, total)
+	s.Len(events, 2)
+	s.Equal("auth.login", events[0].Action, "newest should be first")
+	s.Equal(user.Username, events[0].ActorUsername)
+	s.Equal("192.0.2.1", events[0].Ip)
+	s.Equal("", events[1].ActorUsername)
+	s.JSONEq(`{}`, string(events[1].Before))
+	s.JSONEq(`{"username":"john_doe"}`, string(events[1].After))
+
+	events, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Action: "user.create", Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+	s.Equal("user.create", events[0].Action)
+
+	_, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Actor: user.Username, Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+
+	_, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{TargetType: "user", TargetID: "0", Limit: 10})
+	s.NoError(err)
+	s.Equal(0, total)
+
+	hourAgo := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	_, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Since: hourAgo, Limit: 10})
+	s.NoError(err)
+	s.Equal(2, total)
+	_, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Until: hourAgo, Limit: 10})
+	s.NoError(err)
+	s.Equal(0, total)
+
+	events, total, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Limit: 1, Offset: 1})
+	s.NoError(err)
+	s.Equal(2, total)
+	s.Len(events, 1)
+	s.Equal("user.create", events[0].Action)
+
+	s.NoError(User{User: user}.Purge(s.ctx, s.db))
+	events, _, err = ListAuditEvents(s.ctx, s.db, AuditFilter{Limit: 10})
+	s.NoError(err)
+	s.Len(events, 2, "events should be kept when the actor is removed")
+}
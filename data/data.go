@@ -1,12 +1,15 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
 	"github.com/briskt/go-htmx-app/data/sqlc"
 )
 
+// ErrorRowNotUpdated is returned when an update finds no row to change, because the row was changed or removed since
+// it was read
 var ErrorRowNotUpdated = errors.New("row not updated")
 
 func q(db sqlc.DBTX) *sqlc.Queries {
@@ -17,8 +20,37 @@ func newNullInt32(i int32) sql.NullInt32 {
 	return sql.NullInt32{Int32: i, Valid: true}
 }
 
+// Savepoint marks a point in a transaction that it can be rolled back to, undoing only the statements since. Once a
+// statement fails, Postgres refuses every further statement of the transaction until it is rolled back to a savepoint.
+type Savepoint struct {
+	tx   *sql.Tx
+	name string
+}
+
+// NewSavepoint sets a savepoint with the given name, which must be a valid SQL identifier
+func NewSavepoint(ctx context.Context, tx *sql.Tx, name string) (Savepoint, error) {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+name)
+	return Savepoint{tx: tx, name: name}, err
+}
+
+// Rollback undoes the statements since the savepoint, leaving the transaction usable
+func (s Savepoint) Rollback(ctx context.Context) error {
+	_, err := s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+s.name)
+	return err
+}
+
+// Release keeps the statements since the savepoint as part of the transaction
+func (s Savepoint) Release(ctx context.Context) error {
+	_, err := s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
 func DestroyTables(db *sql.DB) {
+	resultMust(db.Exec("DELETE FROM email_outbox"))
 	resultMust(db.Exec("DELETE FROM email_logs"))
+	resultMust(db.Exec("DELETE FROM audit_events"))
+	resultMust(db.Exec("DELETE FROM data_exports"))
+	resultMust(db.Exec("DELETE FROM email_changes"))
 	resultMust(db.Exec("DELETE FROM tokens"))
 	resultMust(db.Exec("DELETE FROM users"))
 }
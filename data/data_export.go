@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/briskt/go-htmx-app/data/sqlc"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a request for an archive of the personal data of a user, and the archive once it is built
+type DataExport struct {
+	sqlc.DataExport
+}
+
+// CreateDataExport queues a pending export of the data of a user
+func CreateDataExport(ctx context.Context, tx sqlc.DBTX, userID, requestedBy int) (DataExport, error) {
+	export, err := q(tx).CreateDataExport(ctx, int32(userID), int32(requestedBy))
+	if err != nil {
+		return DataExport{}, fmt.Errorf("error creating data export: %w", err)
+	}
+	return DataExport{export}, nil
+}
+
+// FindPendingDataExports returns up to limit pending exports, locking them so that concurrent workers skip them
+func FindPendingDataExports(ctx context.Context, tx sqlc.DBTX, limit int) ([]DataExport, error) {
+	exports, err := q(tx).FindPendingDataExports(ctx, int32(limit))
+	if err != nil {
+		return nil, fmt.Errorf("error finding pending data exports: %w", err)
+	}
+	result := make([]DataExport, len(exports))
+	for i := range exports {
+		result[i] = DataExport{exports[i]}
+	}
+	return result, nil
+}
+
+func FindDataExportByHash(ctx context.Context, tx sqlc.DBTX, hash string) (DataExport, error) {
+	export, err := q(tx).FindDataExportByHash(ctx, sql.NullString{String: hash, Valid: true})
+	if err != nil {
+		return DataExport{}, fmt.Errorf("error finding data export: %w", err)
+	}
+	return DataExport{export}, nil
+}
+
+// MarkReady saves the archive of the export and the hash of its download token
+func (e *DataExport) MarkReady(ctx context.Context, tx sqlc.DBTX, archive []byte, hash string, expiresAt time.Time) error {
+	return e.complete(ctx, tx, sqlc.CompleteDataExportParams{
+		ID:        e.ID,
+		Status:    DataExportReady,
+		Hash:      sql.NullString{String: hash, Valid: true},
+		Archive:   archive,
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+}
+
+// MarkFailed records that the archive of the export could not be built. The record is kept until expiresAt.
+func (e *DataExport) MarkFailed(ctx context.Context, tx sqlc.DBTX, expiresAt time.Time) error {
+	return e.complete(ctx, tx, sqlc.CompleteDataExportParams{
+		ID:        e.ID,
+		Status:    DataExportFailed,
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+}
+
+func (e *DataExport) complete(ctx context.Context, tx sqlc.DBTX, params sqlc.CompleteDataExportParams) error {
+	if err := q(tx).CompleteDataExport(ctx, params); err != nil {
+		return fmt.Errorf("error completing data export %d: %w", e.ID, err)
+	}
+	e.Status = params.Status
+	e.Hash = params.Hash
+	e.Archive = params.Archive
+	e.ExpiresAt = params.ExpiresAt
+	return nil
+}
+
+// DeleteExpiredDataExports deletes the exports that expired before the given time, and returns the number deleted
+func DeleteExpiredDataExports(ctx context.Context, tx sqlc.DBTX, before time.Time) (int, error) {
+	n, err := q(tx).DeleteExpiredDataExports(ctx, sql.NullTime{Time: before, Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired data exports: %w", err)
+	}
+	return int(n), nil
+}
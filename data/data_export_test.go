@@ -0,0 +1,38 @@
+package data
+
+import (
+	"time"
+)
+
+func (s *Suite) TestDataExport() {
+	user := insertUser(s.db)
+	export, err := CreateDataExport(s.ctx, s.db, int(user.ID), int(user.ID))
+	s.NoError(err)
+	s.Equal(DataExportPending, export.Status)
+
+	pending, err := FindPendingDataExports(s.ctx, s.db, 10)
+	s.NoError(err)
+	s.Len(pending, 1)
+	s.Equal(export.ID, pending[0].ID)
+
+	expiresAt := time.Now().Add(time.Hour)
+	s.NoError(export.MarkReady(s.ctx, s.db, []byte("archive"), "fakehash", expiresAt))
+
+	pending, err = FindPendingDataExports(s.ctx, s.db, 10)
+	s.NoError(err)
+	s.Len(pending, 0)
+
+	got, err := FindDataExportByHash(s.ctx, s.db, "fakehash")
+	s.NoError(err)
+	s.Equal(DataExportReady, got.Status)
+	s.Equal([]byte("archive"), got.Archive)
+	s.True(got.CompletedAt.Valid)
+
+	n, err := DeleteExpiredDataExports(s.ctx, s.db, time.Now())
+	s.NoError(err)
+	s.Equal(0, n)
+
+	n, err = DeleteExpiredDataExports(s.ctx, s.db, expiresAt.Add(time.Minute))
+	s.NoError(err)
+	s.Equal(1, n)
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/briskt/go-htmx-app/app"
+	"github.com/briskt/go-htmx-app/data/sqlc"
+)
+
+// EmailChange is a pending change of a user's email address, awaiting confirmation from the new address
+type EmailChange struct {
+	sqlc.EmailChange
+}
+
+// CreateEmailChange stores a pending email change, identified by the hash of its confirmation token
+func CreateEmailChange(ctx context.Context, tx sqlc.DBTX, userID int, newEmail, tokenHash string) (EmailChange, error) {
+	change, err := q(tx).CreateEmailChange(ctx, sqlc.CreateEmailChangeParams{
+		UserID:    int32(userID),
+		NewEmail:  newEmail,
+		Hash:      tokenHash,
+		ExpiresAt: time.Now().Add(app.EmailChangeLifetime),
+	})
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("error creating email change: %w", err)
+	}
+	return EmailChange{change}, nil
+}
+
+func FindEmailChangeByHash(ctx context.Context, tx sqlc.DBTX, hash string) (EmailChange, error) {
+	change, err := q(tx).FindEmailChangeByHash(ctx, hash)
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("error finding email change: %w", err)
+	}
+	return EmailChange{change}, nil
+}
+
+// DeleteEmailChanges deletes all pending email changes of a user
+func DeleteEmailChanges(ctx context.Context, tx sqlc.DBTX, userID int) error {
+	if err := q(tx).DeleteEmailChangesByUser(ctx, int32(userID)); err != nil {
+		return fmt.Errorf("error deleting email changes of user %d: %w", userID, err)
+	}
+	return nil
+}
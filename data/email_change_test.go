@@ -0,0 +1,24 @@
+package data
+
+import (
+	"time"
+
+	"github.com/briskt/go-htmx-app/app"
+)
+
+func (s *Suite) TestEmailChange() {
+	user := insertUser(s.db)
+	change, err := CreateEmailChange(s.ctx, s.db, int(user.ID), "new@example.org", "fakehash")
+	s.NoError(err)
+	s.Equal(user.ID, change.UserID)
+	s.Equal("new@example.org", change.NewEmail)
+	s.WithinDuration(time.Now().Add(app.EmailChangeLifetime), change.ExpiresAt, time.Second)
+
+	got, err := FindEmailChangeByHash(s.ctx, s.db, "fakehash")
+	s.NoError(err)
+	s.Equal(change, got)
+
+	s.NoError(DeleteEmailChanges(s.ctx, s.db, int(user.ID)))
+	_, err = FindEmailChangeByHash(s.ctx, s.db, "fakehash")
+	s.Error(err)
+}
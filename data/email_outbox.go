@@ -0,0 +1,227 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/briskt/go-htmx-app/data/sqlc"
+)
+
+const (
+	OutboxEmailPending = "pending"
+	OutboxEmailSending = "sending"
+	OutboxEmailDead    = "dead"
+)
+
+// OutboxEmail is a rendered message waiting in the email outbox to be sent. A message that cannot be sent after
+// several attempts is marked as dead and kept for investigation.
+type OutboxEmail struct {
+	sqlc.EmailOutbox
+}
+
+// OutboxAddress is an email address of a message in the outbox, with an optional display name
+type OutboxAddress struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// OutboxAttachment is a file attached to a message in the outbox. Its content is either Data, or read from Path in the
+// assets file system of the email service when the message is sent.
+type OutboxAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+	Path        string `json:"path,omitempty"`
+}
+
+// OutboxEmailInput holds the fields of a message to add to the email outbox. ReplyTo is optional.
+type OutboxEmailInput struct {
+	UserID      int
+	Template    string
+	FromName    string
+	FromAddress string
+	To          []OutboxAddress
+	CC          []OutboxAddress
+	BCC         []OutboxAddress
+	ReplyTo     OutboxAddress
+	Subject     string
+	Body        string
+	Images      map[string]string
+	Attachments []OutboxAttachment
+}
+
+// QueueEmail adds a message to the email outbox, to be sent as soon as a worker picks it up. Since the outbox is written
+// in the caller's transaction, the message is not sent if the transaction is rolled back.
+func QueueEmail(ctx context.Context, tx sqlc.DBTX, input OutboxEmailInput) (OutboxEmail, error) {
+	if len(input.To) == 0 {
+		return OutboxEmail{}, fmt.Errorf("cannot queue %s message without a To address", input.Template)
+	}
+	images, err := json.Marshal(input.Images)
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to encode images of %s message: %w", input.Template, err)
+	}
+	attachments, err := jsonArray(input.Attachments)
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to encode attachments of %s message: %w", input.Template, err)
+	}
+	to, err := jsonArray(input.To)
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to encode recipients of %s message: %w", input.Template, err)
+	}
+	cc, err := jsonArray(input.CC)
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to encode recipients of %s message: %w", input.Template, err)
+	}
+	bcc, err := jsonArray(input.BCC)
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to encode recipients of %s message: %w", input.Template, err)
+	}
+	email, err := q(tx).CreateOutboxEmail(ctx, sqlc.CreateOutboxEmailParams{
+		UserID:         int32(input.UserID),
+		MessageType:    input.Template,
+		FromName:       input.FromName,
+		FromAddress:    input.FromAddress,
+		ToAddresses:    to,
+		Cc:             cc,
+		Bcc:            bcc,
+		ReplyToName:    input.ReplyTo.Name,
+		ReplyToAddress: input.ReplyTo.Address,
+		Subject:        input.Subject,
+		Body:           input.Body,
+		Images:         jsonObject(images),
+		Attachments:    attachments,
+	})
+	if err != nil {
+		return OutboxEmail{}, fmt.Errorf("failed to queue %s message: %w", input.Template, err)
+	}
+	return OutboxEmail{email}, nil
+}
+
+// ClaimDueEmails returns up to limit messages that are due to be sent by the given time, in the order they were queued.
+// They are marked as being sent until leaseUntil, so that concurrent workers skip them. If the outcome of a message is
+// not recorded by then, it is due again.
+func ClaimDueEmails(ctx context.Context, tx sqlc.DBTX, now, leaseUntil time.Time, limit int) ([]OutboxEmail, error) {
+	emails, err := q(tx).ClaimDueOutboxEmails(ctx, sqlc.ClaimDueOutboxEmailsParams{
+		LeaseUntil: leaseUntil,
+		Now:        now,
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim email outbox messages: %w", err)
+	}
+	slices.SortFunc(emails, func(a, b sqlc.EmailOutbox) int { return cmp.Compare(a.ID, b.ID) })
+	return toOutboxEmails(emails), nil
+}
+
+// ListDeadEmails returns the messages that were given up on, oldest first
+func ListDeadEmails(ctx context.Context, tx sqlc.DBTX) ([]OutboxEmail, error) {
+	emails, err := q(tx).ListDeadOutboxEmails(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead email outbox messages: %w", err)
+	}
+	return toOutboxEmails(emails), nil
+}
+
+// GetImages returns the inline images of the message, keyed by content ID
+func (e OutboxEmail) GetImages() (map[string]string, error) {
+	images := map[string]string{}
+	if err := json.Unmarshal(e.Images, &images); err != nil {
+		return nil, fmt.Errorf("invalid images of outbox message %d: %w", e.ID, err)
+	}
+	return images, nil
+}
+
+// GetTo returns the To addresses of the message
+func (e OutboxEmail) GetTo() ([]OutboxAddress, error) {
+	return decodeOutboxList[OutboxAddress](e.ID, "To addresses", e.ToAddresses)
+}
+
+// GetCC returns the CC addresses of the message
+func (e OutboxEmail) GetCC() ([]OutboxAddress, error) {
+	return decodeOutboxList[OutboxAddress](e.ID, "CC addresses", e.Cc)
+}
+
+// GetBCC returns the BCC addresses of the message
+func (e OutboxEmail) GetBCC() ([]OutboxAddress, error) {
+	return decodeOutboxList[OutboxAddress](e.ID, "BCC addresses", e.Bcc)
+}
+
+// GetReplyTo returns the Reply-To address of the message, which is empty if replies go to the sender
+func (e OutboxEmail) GetReplyTo() OutboxAddress {
+	return OutboxAddress{Name: e.ReplyToName, Address: e.ReplyToAddress}
+}
+
+// GetAttachments returns the files attached to the message
+func (e OutboxEmail) GetAttachments() ([]OutboxAttachment, error) {
+	return decodeOutboxList[OutboxAttachment](e.ID, "attachments", e.Attachments)
+}
+
+// MarkSent removes a sent message from the outbox and records it in the email log, with the provider's message ID
+func (e *OutboxEmail) MarkSent(ctx context.Context, tx sqlc.DBTX, providerMessageID string) error {
+	if err := q(tx).DeleteOutboxEmail(ctx, e.ID); err != nil {
+		return fmt.Errorf("failed to delete outbox message %d: %w", e.ID, err)
+	}
+	return CreateEmailLog(ctx, tx, int(e.UserID), e.MessageType, providerMessageID)
+}
+
+// MarkRetry records a failed attempt to send the message, to be tried again at nextAttemptAt
+func (e *OutboxEmail) MarkRetry(ctx context.Context, tx sqlc.DBTX, sendErr error, nextAttemptAt time.Time) error {
+	params := sqlc.RetryOutboxEmailParams{
+		ID:            e.ID,
+		Attempts:      e.Attempts + 1,
+		LastError:     sendErr.Error(),
+		NextAttemptAt: nextAttemptAt,
+	}
+	if err := q(tx).RetryOutboxEmail(ctx, params); err != nil {
+		return fmt.Errorf("failed to update outbox message %d: %w", e.ID, err)
+	}
+	e.Status = OutboxEmailPending
+	e.Attempts = params.Attempts
+	e.LastError = params.LastError
+	e.NextAttemptAt = params.NextAttemptAt
+	return nil
+}
+
+// MarkDead records the last failed attempt to send the message. It is kept in the outbox, but not tried again.
+func (e *OutboxEmail) MarkDead(ctx context.Context, tx sqlc.DBTX, sendErr error) error {
+	params := sqlc.KillOutboxEmailParams{
+		ID:        e.ID,
+		Attempts:  e.Attempts + 1,
+		LastError: sendErr.Error(),
+	}
+	if err := q(tx).KillOutboxEmail(ctx, params); err != nil {
+		return fmt.Errorf("failed to update outbox message %d: %w", e.ID, err)
+	}
+	e.Status = OutboxEmailDead
+	e.Attempts = params.Attempts
+	e.LastError = params.LastError
+	return nil
+}
+
+func decodeOutboxList[T any](id int32, label string, j json.RawMessage) ([]T, error) {
+	var list []T
+	if err := json.Unmarshal(j, &list); err != nil {
+		return nil, fmt.Errorf("invalid %s of outbox message %d: %w", label, id, err)
+	}
+	return list, nil
+}
+
+// jsonArray encodes a list for a jsonb column, storing an empty array rather than null for a nil list
+func jsonArray[T any](list []T) (json.RawMessage, error) {
+	if list == nil {
+		list = []T{}
+	}
+	return json.Marshal(list)
+}
+
+func toOutboxEmails(emails []sqlc.EmailOutbox) []OutboxEmail {
+	result := make([]OutboxEmail, len(emails))
+	for i := range emails {
+		result[i] = OutboxEmail{emails[i]}
+	}
+	return result
+}
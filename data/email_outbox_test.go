@@ -0,0 +1,95 @@
+package data
+
+import (
+	"errors"
+	"time"
+)
+
+func (s *Suite) TestEmailOutbox() {
+	user := insertUser(s.db)
+	input := OutboxEmailInput{
+		UserID:      int(user.ID),
+		Template:    "welcome",
+		FromName:    "App",
+		FromAddress: "no_reply@example.com",
+		To:          []OutboxAddress{{Name: "John Doe", Address: "john_doe@example.com"}},
+		CC:          []OutboxAddress{{Address: "manager@example.com"}},
+		ReplyTo:     OutboxAddress{Name: "Support", Address: "support@example.com"},
+		Subject:     "Welcome",
+		Body:        "<p>Hello</p>",
+		Images:      map[string]string{"logo.png": "aW1hZ2U="},
+		Attachments: []OutboxAttachment{
+			{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("notes")},
+			{Filename: "terms.pdf", ContentType: "application/pdf", Path: "assets/doc/terms.pdf"},
+		},
+	}
+	queued, err := QueueEmail(s.ctx, s.db, input)
+	s.NoError(err)
+	s.Equal(OutboxEmailPending, queued.Status)
+
+	to, err := queued.GetTo()
+	s.NoError(err)
+	s.Equal(input.To, to)
+	cc, err := queued.GetCC()
+	s.NoError(err)
+	s.Equal(input.CC, cc)
+	bcc, err := queued.GetBCC()
+	s.NoError(err)
+	s.Empty(bcc)
+	s.Equal(input.ReplyTo, queued.GetReplyTo())
+	attachments, err := queued.GetAttachments()
+	s.NoError(err)
+	s.Equal(input.Attachments, attachments)
+
+	_, err = QueueEmail(s.ctx, s.db, OutboxEmailInput{UserID: int(user.ID), Template: "welcome"})
+	s.Error(err, "a message without a To address should not be queued")
+
+	now := time.Now()
+	lease := now.Add(10 * time.Minute)
+	due, err := ClaimDueEmails(s.ctx, s.db, now, lease, 10)
+	s.NoError(err)
+	s.Len(due, 1)
+	s.Equal(OutboxEmailSending, due[0].Status)
+	images, err := due[0].GetImages()
+	s.NoError(err)
+	s.Equal(input.Images, images)
+
+	again, err := ClaimDueEmails(s.ctx, s.db, now, lease, 10)
+	s.NoError(err)
+	s.Empty(again, "a leased message should not be claimed by another worker")
+	again, err = ClaimDueEmails(s.ctx, s.db, lease, lease.Add(10*time.Minute), 10)
+	s.NoError(err)
+	s.Len(again, 1, "a message should be claimed again when its lease expires")
+
+	s.NoError(due[0].MarkRetry(s.ctx, s.db, errors.New("timeout"), now.Add(time.Minute)))
+	s.Equal(OutboxEmailPending, due[0].Status)
+	due, err = ClaimDueEmails(s.ctx, s.db, now, lease, 10)
+	s.NoError(err)
+	s.Empty(due, "a message should not be claimed before its next attempt")
+
+	due, err = ClaimDueEmails(s.ctx, s.db, now.Add(time.Minute), lease, 10)
+	s.NoError(err)
+	s.Len(due, 1)
+	s.Equal(int32(1), due[0].Attempts)
+	s.Equal("timeout", due[0].LastError)
+
+	s.NoError(due[0].MarkDead(s.ctx, s.db, errors.New("rejected")))
+	due, err = ClaimDueEmails(s.ctx, s.db, now.Add(time.Hour), now.Add(time.Hour), 10)
+	s.NoError(err)
+	s.Empty(due, "a dead message should not be claimed")
+	dead, err := ListDeadEmails(s.ctx, s.db)
+	s.NoError(err)
+	s.Len(dead, 1)
+	s.Equal(int32(2), dead[0].Attempts)
+
+	queued, err = QueueEmail(s.ctx, s.db, input)
+	s.NoError(err)
+	s.NoError(queued.MarkSent(s.ctx, s.db, "provider-id-1"))
+	due, err = ClaimDueEmails(s.ctx, s.db, now.Add(time.Hour), now.Add(time.Hour), 10)
+	s.NoError(err)
+	s.Empty(due)
+	logs, err := ListEmailLogs(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Len(logs, 1)
+	s.Equal("provider-id-1", logs[0].ProviderMessageID)
+}
@@ -2,20 +2,44 @@ package data
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/briskt/go-htmx-app/data/sqlc"
 	"github.com/briskt/go-htmx-app/log"
 )
 
-func CreateEmailLog(ctx context.Context, tx sqlc.DBTX, userID int, template string) error {
+// CreateEmailLog records that a message was sent to a user, along with the ID the email provider assigned to it
+func CreateEmailLog(ctx context.Context, tx sqlc.DBTX, userID int, template, providerMessageID string) error {
 	template = strings.ReplaceAll(template, "_", "-")
 	log.WithFields(log.Fields{"userID": userID, "template": template}).Debug("creating email log")
-	return q(tx).CreateEmailLog(ctx, int32(userID), template)
+	return q(tx).CreateEmailLog(ctx, sqlc.CreateEmailLogParams{
+		UserID:            int32(userID),
+		MessageType:       template,
+		ProviderMessageID: providerMessageID,
+	})
+}
+
+type EmailLog struct {
+	sqlc.EmailLog
+}
+
+// ListEmailLogs returns the email history of a user, oldest first
+func ListEmailLogs(ctx context.Context, tx sqlc.DBTX, userID int) ([]EmailLog, error) {
+	logs, err := q(tx).ListEmailLogsByUser(ctx, int32(userID))
+	if err != nil {
+		return nil, fmt.Errorf("error listing email logs of user %d: %w", userID, err)
+	}
+	result := make([]EmailLog, len(logs))
+	for i := range logs {
+		result[i] = EmailLog{logs[i]}
+	}
+	return result, nil
 }
 
 // HasReceivedMessageRecently searches the email log for the given template and returns true if at least one such
-// message has been sent to the user recently
+// message has been sent to the user recently, or is still waiting in the email outbox to be sent. A message that was
+// given up on does not count.
 func (u User) HasReceivedMessageRecently(ctx context.Context, tx sqlc.DBTX, template string) bool {
 	template = strings.ReplaceAll(template, "_", "-")
 	n, err := q(tx).CountRecentEmails(ctx, u.ID, template)
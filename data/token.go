@@ -41,3 +41,16 @@ func FindAccessTokenByHash(ctx context.Context, tx sqlc.DBTX, hash string) (Acce
 	}
 	return AccessToken{token}, nil
 }
+
+// ListAccessTokens returns the access tokens, or sessions, of a user
+func ListAccessTokens(ctx context.Context, tx sqlc.DBTX, userID int) ([]AccessToken, error) {
+	tokens, err := q(tx).ListAccessTokensByUser(ctx, int32(userID))
+	if err != nil {
+		return nil, fmt.Errorf("error listing access tokens of user %d: %w", userID, err)
+	}
+	result := make([]AccessToken, len(tokens))
+	for i := range tokens {
+		result[i] = AccessToken{tokens[i]}
+	}
+	return result, nil
+}
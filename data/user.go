@@ -2,16 +2,77 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 
 	"github.com/briskt/go-htmx-app/data/sqlc"
 )
 
+// pgUniqueViolation is the Postgres error code for a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// uniqueUserIndexes maps the unique indexes of the users table to the field each covers
+var uniqueUserIndexes = map[string]string{
+	"users_username_unique":    "username",
+	"users_email_unique":       "email",
+	"users_employee_id_unique": "employee_id",
+}
+
+// DuplicateUserError is returned when a user would have the same username, email or employee ID as another user
+type DuplicateUserError struct {
+	// Field is "username", "email" or "employee_id"
+	Field string
+	Err   error
+}
+
+func (e *DuplicateUserError) Error() string {
+	return fmt.Sprintf("another user has the same %s: %s", e.Field, e.Err)
+}
+
+func (e *DuplicateUserError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateUsers is a value of a unique user field that is shared by more than one user
+type DuplicateUsers struct {
+	Field   string
+	Value   string
+	UserIDs string
+}
+
 type User struct {
 	sqlc.User
 }
 
+// UserFilter selects, orders, and paginates a list of users. An empty Search matches all users, and a null Active or
+// Locked matches either state. Deleted selects only deleted users instead of only users that are not deleted. SortBy
+// may be one of the UserSort* constants; any other value orders by ID. Attributes selects users having all of the given
+// custom attribute values, which are typed as for User.SetAttribute.
+type UserFilter struct {
+	Active     sql.NullBool
+	Locked     sql.NullBool
+	Deleted    bool
+	Search     string
+	Attributes map[string]any
+	SortBy     string
+	SortDesc   bool
+	Limit      int
+	Offset     int
+}
+
+const (
+	UserSortName       = "name"
+	UserSortUsername   = "username"
+	UserSortEmail      = "email"
+	UserSortEmployeeID = "employee_id"
+	UserSortLastLogin  = "last_login"
+)
+
 type UserCreateInput struct {
 	EmployeeID  string
 	FirstName   string
@@ -25,9 +86,37 @@ func (u User) GetEmail() string {
 	return u.Email
 }
 
-// Delete a user
+// Delete marks a user as deleted and removes the user's access tokens. The record and its history are kept, so the
+// user can be restored. Use Purge to remove the record.
 func (u User) Delete(ctx context.Context, tx sqlc.DBTX) error {
-	return q(tx).DeleteUser(ctx, u.ID)
+	if err := q(tx).SoftDeleteUser(ctx, u.ID); err != nil {
+		return fmt.Errorf("failed to delete user %d: %w", u.ID, err)
+	}
+	if err := q(tx).DeleteAccessTokensByUser(ctx, u.ID); err != nil {
+		return fmt.Errorf("failed to delete access tokens of user %d: %w", u.ID, err)
+	}
+	return nil
+}
+
+// Restore clears the deleted mark of a user
+func (u User) Restore(ctx context.Context, tx sqlc.DBTX) error {
+	if err := q(tx).RestoreUser(ctx, u.ID); err != nil {
+		return fmt.Errorf("failed to restore user %d: %w", u.ID, err)
+	}
+	return nil
+}
+
+// Purge permanently removes a user record, along with the user's tokens, email history and other related records
+func (u User) Purge(ctx context.Context, tx sqlc.DBTX) error {
+	if err := q(tx).DeleteUser(ctx, u.ID); err != nil {
+		return fmt.Errorf("failed to purge user %d: %w", u.ID, err)
+	}
+	return nil
+}
+
+// IsDeleted returns true if the user is marked as deleted
+func (u User) IsDeleted() bool {
+	return u.DeletedAt.Valid
 }
 
 // GetDisplayName returns the DisplayName field if it is non-empty, otherwise the FirstName and LastName concatenated.
@@ -53,6 +142,31 @@ func FindUserByUsernameOrEmail(ctx context.Context, tx sqlc.DBTX, v string) (Use
 	return dataUser, nil
 }
 
+func FindUserByUsername(ctx context.Context, tx sqlc.DBTX, username string) (User, error) {
+	user, err := q(tx).FindUserByUsername(ctx, username)
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with username %q: %w", username, err)
+	}
+	dataUser, err := loadUserRelations(ctx, tx, User{User: user})
+	if err != nil {
+		return User{}, fmt.Errorf("failed to load user relations %q: %w", user.ID, err)
+	}
+	return dataUser, nil
+}
+
+// FindUserByEmail finds a user by email address, ignoring case
+func FindUserByEmail(ctx context.Context, tx sqlc.DBTX, email string) (User, error) {
+	user, err := q(tx).FindUserByEmail(ctx, email)
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with email %q: %w", email, err)
+	}
+	dataUser, err := loadUserRelations(ctx, tx, User{User: user})
+	if err != nil {
+		return User{}, fmt.Errorf("failed to load user relations %q: %w", user.ID, err)
+	}
+	return dataUser, nil
+}
+
 func FindUserByEmployeeID(ctx context.Context, tx sqlc.DBTX, employeeID string) (User, error) {
 	user, err := q(tx).FindUserByEmployeeID(ctx, employeeID)
 	if err != nil {
@@ -65,6 +179,33 @@ func FindUserByEmployeeID(ctx context.Context, tx sqlc.DBTX, employeeID string)
 	return dataUser, nil
 }
 
+// FindUserByEmployeeIDIncludingDeleted is like FindUserByEmployeeID, but also finds a deleted user
+func FindUserByEmployeeIDIncludingDeleted(ctx context.Context, tx sqlc.DBTX, employeeID string) (User, error) {
+	user, err := q(tx).FindUserByEmployeeIDIncludingDeleted(ctx, employeeID)
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with employeeID %q: %w", employeeID, err)
+	}
+	return User{User: user}, nil
+}
+
+// FindUserByUsernameIncludingDeleted is like FindUserByUsername, but also finds a deleted user
+func FindUserByUsernameIncludingDeleted(ctx context.Context, tx sqlc.DBTX, username string) (User, error) {
+	user, err := q(tx).FindUserByUsernameIncludingDeleted(ctx, username)
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with username %q: %w", username, err)
+	}
+	return User{User: user}, nil
+}
+
+// FindUserByEmailIncludingDeleted finds a user by email address, ignoring case, including a deleted user
+func FindUserByEmailIncludingDeleted(ctx context.Context, tx sqlc.DBTX, email string) (User, error) {
+	user, err := q(tx).FindUserByEmailIncludingDeleted(ctx, email)
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with email %q: %w", email, err)
+	}
+	return User{User: user}, nil
+}
+
 func GetUser(ctx context.Context, tx sqlc.DBTX, id int) (User, error) {
 	user, err := q(tx).GetUser(ctx, int32(id))
 	if err != nil {
@@ -77,6 +218,19 @@ func GetUser(ctx context.Context, tx sqlc.DBTX, id int) (User, error) {
 	return dataUser, nil
 }
 
+// GetUserIncludingDeleted is like GetUser, but also finds a deleted user
+func GetUserIncludingDeleted(ctx context.Context, tx sqlc.DBTX, id int) (User, error) {
+	user, err := q(tx).GetUserIncludingDeleted(ctx, int32(id))
+	if err != nil {
+		return User{}, fmt.Errorf("no user found with id %q: %w", id, err)
+	}
+	dataUser, err := loadUserRelations(ctx, tx, User{User: user})
+	if err != nil {
+		return User{}, fmt.Errorf("failed to load user relations %q: %w", id, err)
+	}
+	return dataUser, nil
+}
+
 // ListActiveUnlockedUsers returns a list of users that are active but not locked
 func ListActiveUnlockedUsers(ctx context.Context, tx sqlc.DBTX) ([]User, error) {
 	users, err := q(tx).ListActiveUnlockedUsers(ctx)
@@ -86,6 +240,123 @@ func ListActiveUnlockedUsers(ctx context.Context, tx sqlc.DBTX) ([]User, error)
 	return toDataUsers(ctx, tx, users, true)
 }
 
+// ListActiveUsers returns all active users, locked or not
+func ListActiveUsers(ctx context.Context, tx sqlc.DBTX) ([]User, error) {
+	users, err := q(tx).ListActiveUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active users: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, true)
+}
+
+// ListAdminUsers returns the admins that are active and not locked
+func ListAdminUsers(ctx context.Context, tx sqlc.DBTX) ([]User, error) {
+	users, err := q(tx).ListAdminUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin users: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, true)
+}
+
+// FindUsersToWarn returns the active, unlocked users who have not logged in since the given time
+func FindUsersToWarn(ctx context.Context, tx sqlc.DBTX, lastLoginBefore time.Time) ([]User, error) {
+	users, err := q(tx).FindUsersToWarn(ctx, lastLoginBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users to warn: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, true)
+}
+
+// FindUsersToDeactivate returns the active users who have not logged in since inactiveSince and who were sent the
+// given warning message after their last login but before warnedBefore
+func FindUsersToDeactivate(ctx context.Context, tx sqlc.DBTX, inactiveSince, warnedBefore time.Time, template string) ([]User, error) {
+	users, err := q(tx).FindUsersToDeactivate(ctx, sqlc.FindUsersToDeactivateParams{
+		InactiveSince: inactiveSince,
+		MessageType:   strings.ReplaceAll(template, "_", "-"),
+		WarnedBefore:  warnedBefore,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users to deactivate: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, true)
+}
+
+// FindUsersToPurge returns the inactive or deleted users that have not been changed since the given time
+func FindUsersToPurge(ctx context.Context, tx sqlc.DBTX, updatedBefore time.Time) ([]User, error) {
+	users, err := q(tx).FindUsersToPurge(ctx, updatedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users to purge: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, true)
+}
+
+// ListUsers returns a page of users matching the filter, along with the total number of matching users
+func ListUsers(ctx context.Context, tx sqlc.DBTX, filter UserFilter) ([]User, int, error) {
+	search := escapeLike(strings.TrimSpace(filter.Search))
+	attributes, err := attributeFilter(filter.Attributes)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, err := q(tx).ListUsers(ctx, sqlc.ListUsersParams{
+		Active:     filter.Active,
+		Locked:     filter.Locked,
+		Deleted:    filter.Deleted,
+		Search:     search,
+		SortBy:     filter.SortBy,
+		SortDesc:   filter.SortDesc,
+		RowLimit:   int32(filter.Limit),
+		RowOffset:  int32(filter.Offset),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	total, err := q(tx).CountUsers(ctx, sqlc.CountUsersParams{
+		Active:     filter.Active,
+		Locked:     filter.Locked,
+		Deleted:    filter.Deleted,
+		Search:     search,
+		Attributes: attributes,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	dataUsers, err := toDataUsers(ctx, tx, users, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return dataUsers, int(total), nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, using the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike returns s for use in a LIKE pattern, matching only the literal text
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// userSearchThreshold is the least word similarity of a user found by SearchUsers. The pg_trgm default of 0.6 misses
+// most misspellings.
+const userSearchThreshold = 0.4
+
+// SearchUsers returns a page of the users most similar to the search text, best match first. It finds partial and
+// misspelled names, usernames, email addresses and employee IDs. Deleted users are not included.
+func SearchUsers(ctx context.Context, tx sqlc.DBTX, search string, limit, offset int) ([]User, error) {
+	users, err := q(tx).SearchUsers(ctx, sqlc.SearchUsersParams{
+		Search:    strings.TrimSpace(search),
+		Threshold: userSearchThreshold,
+		RowLimit:  int32(limit),
+		RowOffset: int32(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return toDataUsers(ctx, tx, users, false)
+}
+
 // UpdateUserLastLoggedIn sets the user's last_login_utc timestamp to the current time
 func UpdateUserLastLoggedIn(ctx context.Context, tx sqlc.DBTX, u User) (User, error) {
 	if err := q(tx).UpdateUserLastLoggedIn(ctx, u.ID); err != nil {
@@ -94,36 +365,86 @@ func UpdateUserLastLoggedIn(ctx context.Context, tx sqlc.DBTX, u User) (User, er
 	return GetUser(ctx, tx, int(u.ID))
 }
 
+// Update saves the user, unless it was changed by someone else since it was read. In that case, nothing is saved and
+// the returned error is ErrorRowNotUpdated.
 func (u User) Update(ctx context.Context, tx sqlc.DBTX) error {
-	return q(tx).UpdateUser(ctx, sqlc.UpdateUserParams{
-		EmployeeID:  u.EmployeeID,
-		FirstName:   u.FirstName,
-		LastName:    u.LastName,
-		DisplayName: u.GetDisplayName(),
-		Username:    u.Username,
-		Email:       u.Email,
-		Active:      u.Active,
-		Locked:      u.Locked,
-		ID:          u.ID,
+	n, err := q(tx).UpdateUser(ctx, sqlc.UpdateUserParams{
+		EmployeeID:         strings.TrimSpace(u.EmployeeID),
+		FirstName:          u.FirstName,
+		LastName:           u.LastName,
+		DisplayName:        u.GetDisplayName(),
+		Username:           NormalizeUsername(u.Username),
+		Email:              NormalizeEmail(u.Email),
+		Active:             u.Active,
+		Locked:             u.Locked,
+		Admin:              u.Admin,
+		TimeZone:           u.TimeZone,
+		Language:           u.Language,
+		EmailNotifications: u.EmailNotifications,
+		ID:                 u.ID,
+		Version:            u.Version,
+		Attributes:         jsonObject(u.User.Attributes),
 	})
+	if err != nil {
+		return checkUniqueUser(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("user %d version %d: %w", u.ID, u.Version, ErrorRowNotUpdated)
+	}
+	return nil
 }
 
 func CreateUser(ctx context.Context, tx sqlc.DBTX, input UserCreateInput) (User, error) {
 	user, err := q(tx).CreateUser(ctx, sqlc.CreateUserParams{
-		EmployeeID:  input.EmployeeID,
+		EmployeeID:  strings.TrimSpace(input.EmployeeID),
 		FirstName:   input.FirstName,
 		LastName:    input.LastName,
 		DisplayName: input.DisplayName,
-		Username:    input.Username,
-		Email:       input.Email,
+		Username:    NormalizeUsername(input.Username),
+		Email:       NormalizeEmail(input.Email),
 	})
 	if err != nil {
-		return User{}, fmt.Errorf("failed to create user: %w", err)
+		return User{}, fmt.Errorf("failed to create user: %w", checkUniqueUser(err))
 	}
 
 	return User{user}, nil
 }
 
+// FindDuplicateUsers lists the values of username, email and employee ID that are shared by more than one user,
+// ignoring case and surrounding spaces. These must be resolved before the unique indexes can be added.
+func FindDuplicateUsers(ctx context.Context, tx sqlc.DBTX) ([]DuplicateUsers, error) {
+	rows, err := q(tx).FindDuplicateUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate users: %w", err)
+	}
+	duplicates := make([]DuplicateUsers, len(rows))
+	for i, row := range rows {
+		duplicates[i] = DuplicateUsers{Field: row.Field, Value: row.Value, UserIDs: row.UserIds}
+	}
+	return duplicates, nil
+}
+
+// NormalizeUsername returns the form of a username that is stored: lowercase without surrounding spaces
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// NormalizeEmail returns the form of an email address that is stored: lowercase without surrounding spaces
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkUniqueUser converts a violation of a unique index on users to a DuplicateUserError
+func checkUniqueUser(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		if field, ok := uniqueUserIndexes[pgErr.ConstraintName]; ok {
+			return &DuplicateUserError{Field: field, Err: err}
+		}
+	}
+	return err
+}
+
 func toDataUsers(ctx context.Context, tx sqlc.DBTX, users []sqlc.User, loadRelations bool) ([]User, error) {
 	out := make([]User, len(users))
 	for i, u := range users {
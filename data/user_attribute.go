@@ -0,0 +1,153 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/briskt/go-htmx-app/app"
+)
+
+// Attributes returns the values of the registered custom attributes that the user has, keyed by name. The values are
+// string, int, bool or time.Time, according to the type of each attribute.
+func (u User) Attributes() map[string]any {
+	attributes := map[string]any{}
+	for _, a := range app.UserAttributes {
+		if value := u.Attribute(a.Name); value != nil {
+			attributes[a.Name] = value
+		}
+	}
+	return attributes
+}
+
+// Attribute returns the value of a registered custom attribute as a string, int, bool or time.Time, according to the
+// type of the attribute. It returns nil if the user has no value, or if the attribute is not registered.
+func (u User) Attribute(name string) any {
+	a, ok := app.FindUserAttribute(name)
+	if !ok {
+		return nil
+	}
+
+	var value any
+	var found bool
+	switch a.Type {
+	case app.AttributeText:
+		value, found = u.AttributeString(name)
+	case app.AttributeNumber:
+		value, found = u.AttributeInt(name)
+	case app.AttributeBool:
+		value, found = u.AttributeBool(name)
+	case app.AttributeDate:
+		value, found = u.AttributeDate(name)
+	}
+	if !found {
+		return nil
+	}
+	return value
+}
+
+// AttributeString returns the value of a text attribute, and false if the user has no value of that type
+func (u User) AttributeString(name string) (string, bool) {
+	var s string
+	ok := u.attribute(name, &s)
+	return s, ok
+}
+
+// AttributeInt returns the value of a number attribute, and false if the user has no value of that type
+func (u User) AttributeInt(name string) (int, bool) {
+	var i int
+	ok := u.attribute(name, &i)
+	return i, ok
+}
+
+// AttributeBool returns the value of a bool attribute, and false if the user has no value of that type
+func (u User) AttributeBool(name string) (bool, bool) {
+	var b bool
+	ok := u.attribute(name, &b)
+	return b, ok
+}
+
+// AttributeDate returns the value of a date attribute, and false if the user has no value of that type
+func (u User) AttributeDate(name string) (time.Time, bool) {
+	var s string
+	if !u.attribute(name, &s) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	return t, err == nil
+}
+
+// SetAttribute changes the value of a registered custom attribute. The value must be valid for the attribute, as
+// checked by app.UserAttribute.Check. A nil value removes the attribute. The change is saved by Update.
+func (u *User) SetAttribute(name string, value any) error {
+	a, ok := app.FindUserAttribute(name)
+	if !ok {
+		return fmt.Errorf("unknown user attribute %q", name)
+	}
+
+	values, err := u.attributeValues()
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(values, name)
+	} else {
+		if err = a.Check(value); err != nil {
+			return fmt.Errorf("invalid value for user attribute %q: %w", name, err)
+		}
+		if values[name], err = json.Marshal(attributeJSON(value)); err != nil {
+			return fmt.Errorf("failed to encode user attribute %q: %w", name, err)
+		}
+	}
+
+	if u.User.Attributes, err = json.Marshal(values); err != nil {
+		return fmt.Errorf("failed to encode attributes of user %d: %w", u.ID, err)
+	}
+	return nil
+}
+
+// attribute decodes the stored value of an attribute into v, returning false if there is no value of the right type
+func (u User) attribute(name string, v any) bool {
+	values, err := u.attributeValues()
+	if err != nil {
+		return false
+	}
+	raw, ok := values[name]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// attributeValues decodes the stored attributes, including any that are not registered
+func (u User) attributeValues() (map[string]json.RawMessage, error) {
+	values := map[string]json.RawMessage{}
+	if len(u.User.Attributes) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(u.User.Attributes, &values); err != nil {
+		return nil, fmt.Errorf("invalid attributes of user %d: %w", u.ID, err)
+	}
+	return values, nil
+}
+
+// attributeJSON converts an attribute value to the form it is stored in
+func attributeJSON(value any) any {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.DateOnly)
+	}
+	return value
+}
+
+// attributeFilter converts attribute values to a JSON object, for matching the stored attributes by containment
+func attributeFilter(attributes map[string]any) (json.RawMessage, error) {
+	filter := make(map[string]any, len(attributes))
+	for name, value := range attributes {
+		filter[name] = attributeJSON(value)
+	}
+	j, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attribute filter: %w", err)
+	}
+	return j, nil
+}
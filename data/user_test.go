@@ -1,6 +1,9 @@
 package data
 
 import (
+	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -127,3 +130,317 @@ func (s *Suite) TestLoadUserRelations() {
 	s.NoError(err)
 	s.Equal(user.ID, got.ID)
 }
+
+func (s *Suite) TestListUsers() {
+	for i, name := range []string{"alice", "bob", "carol"} {
+		_, err := CreateUser(s.ctx, s.db, UserCreateInput{
+			EmployeeID: fmt.Sprintf("2000%d", i),
+			LastName:   name,
+			Username:   name,
+			Email:      name + "@example.com",
+		})
+		s.NoError(err)
+	}
+
+	users, total, err := ListUsers(s.ctx, s.db, UserFilter{SortBy: UserSortUsername, Limit: 2})
+	s.NoError(err)
+	s.Equal(3, total)
+	s.Len(users, 2)
+	s.Equal("alice", users[0].Username)
+
+	users, total, err = ListUsers(s.ctx, s.db, UserFilter{SortBy: UserSortUsername, SortDesc: true, Limit: 2, Offset: 2})
+	s.NoError(err)
+	s.Equal(3, total)
+	s.Len(users, 1)
+	s.Equal("alice", users[0].Username)
+
+	users, total, err = ListUsers(s.ctx, s.db, UserFilter{Search: "CAR", Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+	s.Equal("carol", users[0].Username)
+
+	for _, search := range []string{"_", "%", `\`} {
+		_, total, err = ListUsers(s.ctx, s.db, UserFilter{Search: search, Limit: 10})
+		s.NoError(err)
+		s.Equal(0, total, "search %q should only match the literal text", search)
+	}
+
+	users[0].Active = false
+	s.NoError(users[0].Update(s.ctx, s.db))
+	users, total, err = ListUsers(s.ctx, s.db, UserFilter{Active: sql.NullBool{Bool: true, Valid: true}, Limit: 10})
+	s.NoError(err)
+	s.Equal(2, total)
+	s.Len(users, 2)
+}
+
+func (s *Suite) TestSearchUsers() {
+	for i, name := range [][2]string{{"Alice", "Johnson"}, {"Bob", "Smith"}, {"Carol", "Smithers"}} {
+		username := strings.ToLower(name[0])
+		_, err := CreateUser(s.ctx, s.db, UserCreateInput{
+			EmployeeID: fmt.Sprintf("2000%d", i),
+			FirstName:  name[0],
+			LastName:   name[1],
+			Username:   username,
+			Email:      username + "@example.com",
+		})
+		s.NoError(err)
+	}
+
+	users, err := SearchUsers(s.ctx, s.db, "smith", 10, 0)
+	s.NoError(err)
+	s.Len(users, 2)
+	s.Equal("bob", users[0].Username, "the closer match should be first")
+
+	users, err = SearchUsers(s.ctx, s.db, "Jonson", 10, 0)
+	s.NoError(err)
+	s.Len(users, 1, "a misspelled name should match")
+	s.Equal("alice", users[0].Username)
+
+	users, err = SearchUsers(s.ctx, s.db, "carol@exmaple.com", 10, 0)
+	s.NoError(err)
+	s.Len(users, 1, "a misspelled email should match")
+	s.Equal("carol", users[0].Username)
+
+	users, err = SearchUsers(s.ctx, s.db, "20001", 10, 0)
+	s.NoError(err)
+	s.Equal("bob", users[0].Username)
+
+	users, err = SearchUsers(s.ctx, s.db, "smith", 1, 1)
+	s.NoError(err)
+	s.Len(users, 1)
+	s.Equal("carol", users[0].Username)
+
+	s.NoError(users[0].Delete(s.ctx, s.db))
+	users, err = SearchUsers(s.ctx, s.db, "smith", 10, 0)
+	s.NoError(err)
+	s.Len(users, 1, "deleted users should not be found")
+}
+
+func (s *Suite) TestUserUniqueness() {
+	user, err := CreateUser(s.ctx, s.db, UserCreateInput{
+		EmployeeID: " 20001 ",
+		Username:   " Ann_Other ",
+		Email:      "Ann.Other@Example.com",
+	})
+	s.NoError(err)
+	s.Equal("20001", user.EmployeeID)
+	s.Equal("ann_other", user.Username, "username should be normalized")
+	s.Equal("ann.other@example.com", user.Email, "email should be normalized")
+
+	got, err := FindUserByUsernameOrEmail(s.ctx, s.db, "ANN_OTHER")
+	s.NoError(err)
+	s.Equal(user.ID, got.ID)
+	got, err = FindUserByUsernameOrEmail(s.ctx, s.db, "ann.OTHER@example.com")
+	s.NoError(err)
+	s.Equal(user.ID, got.ID)
+
+	tests := []struct {
+		name      string
+		input     UserCreateInput
+		wantField string
+	}{
+		{
+			name:      "username differing only in case",
+			input:     UserCreateInput{EmployeeID: "20002", Username: "ANN_OTHER", Email: "x@example.com"},
+			wantField: "username",
+		},
+		{
+			name:      "email differing only in case",
+			input:     UserCreateInput{EmployeeID: "20002", Username: "x", Email: "ANN.OTHER@example.com"},
+			wantField: "email",
+		},
+		{
+			name:      "same employee ID",
+			input:     UserCreateInput{EmployeeID: "20001", Username: "x", Email: "x@example.com"},
+			wantField: "employee_id",
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			tx, err := s.db.Begin()
+			s.NoError(err)
+			defer func() { _ = tx.Rollback() }()
+
+			_, err = CreateUser(s.ctx, tx, tt.input)
+			var dupErr *DuplicateUserError
+			s.ErrorAs(err, &dupErr)
+			s.Equal(tt.wantField, dupErr.Field)
+		})
+	}
+
+	other := User{User: insertUser(s.db)}
+	other.Email = "ANN.OTHER@EXAMPLE.COM"
+	var dupErr *DuplicateUserError
+	s.ErrorAs(other.Update(s.ctx, s.db), &dupErr)
+	s.Equal("email", dupErr.Field)
+
+	duplicates, err := FindDuplicateUsers(s.ctx, s.db)
+	s.NoError(err)
+	s.Len(duplicates, 0)
+}
+
+func (s *Suite) TestListAdminUsers() {
+	user := User{User: insertUser(s.db)}
+
+	admins, err := ListAdminUsers(s.ctx, s.db)
+	s.NoError(err)
+	s.Len(admins, 0)
+
+	user.Admin = true
+	s.NoError(user.Update(s.ctx, s.db))
+	admins, err = ListAdminUsers(s.ctx, s.db)
+	s.NoError(err)
+	s.Len(admins, 1)
+
+	user, err = GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	user.Locked = true
+	s.NoError(user.Update(s.ctx, s.db))
+	admins, err = ListAdminUsers(s.ctx, s.db)
+	s.NoError(err)
+	s.Len(admins, 0)
+}
+
+func (s *Suite) TestUserUpdate_Conflict() {
+	user := User{User: insertUser(s.db)}
+	stale := user
+
+	user.FirstName = "Jon"
+	s.NoError(user.Update(s.ctx, s.db))
+
+	stale.LastName = "Smith"
+	s.ErrorIs(stale.Update(s.ctx, s.db), ErrorRowNotUpdated)
+
+	got, err := GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Equal("Jon", got.FirstName)
+	s.Equal("Doe", got.LastName)
+	s.Equal(user.Version+1, got.Version)
+
+	got.LastName = "Smith"
+	s.NoError(got.Update(s.ctx, s.db))
+}
+
+func (s *Suite) TestFindUsersToWarnAndDeactivate() {
+	user := User{User: insertUser(s.db)}
+	_, err := s.db.Exec("UPDATE users SET last_login_at = $1 WHERE id = $2", time.Now().Add(-100*24*time.Hour), user.ID)
+	s.NoError(err)
+
+	users, err := FindUsersToWarn(s.ctx, s.db, time.Now().Add(-90*24*time.Hour))
+	s.NoError(err)
+	s.Len(users, 1)
+
+	users, err = FindUsersToWarn(s.ctx, s.db, time.Now().Add(-110*24*time.Hour))
+	s.NoError(err)
+	s.Len(users, 0)
+
+	users, err = FindUsersToDeactivate(s.ctx, s.db, time.Now().Add(-90*24*time.Hour), time.Now().Add(time.Hour), "warning")
+	s.NoError(err)
+	s.Len(users, 0, "a user who has not been warned should not be deactivated")
+
+	s.NoError(CreateEmailLog(s.ctx, s.db, int(user.ID), "warning", ""))
+	users, err = FindUsersToDeactivate(s.ctx, s.db, time.Now().Add(-90*24*time.Hour), time.Now().Add(time.Hour), "warning")
+	s.NoError(err)
+	s.Len(users, 1)
+
+	users, err = FindUsersToDeactivate(s.ctx, s.db, time.Now().Add(-90*24*time.Hour), time.Now().Add(-time.Hour), "warning")
+	s.NoError(err)
+	s.Len(users, 0, "a user warned too recently should not be deactivated")
+}
+
+func (s *Suite) TestUserDeleteRestorePurge() {
+	user := User{User: insertUser(s.db)}
+	_, err := CreateAccessToken(s.ctx, s.db, int(user.ID), "fakehash")
+	s.NoError(err)
+	s.NoError(CreateEmailLog(s.ctx, s.db, int(user.ID), "welcome", ""))
+
+	s.NoError(user.Delete(s.ctx, s.db))
+
+	_, err = GetUser(s.ctx, s.db, int(user.ID))
+	s.Error(err)
+	_, err = FindUserByEmployeeID(s.ctx, s.db, user.EmployeeID)
+	s.Error(err)
+	_, err = FindUserByUsernameOrEmail(s.ctx, s.db, user.Username)
+	s.Error(err)
+	_, err = FindAccessTokenByHash(s.ctx, s.db, "fakehash")
+	s.Error(err, "access tokens should be removed")
+
+	users, total, err := ListUsers(s.ctx, s.db, UserFilter{Limit: 10})
+	s.NoError(err)
+	s.Equal(0, total)
+	s.Len(users, 0)
+
+	users, total, err = ListUsers(s.ctx, s.db, UserFilter{Deleted: true, Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+	s.True(users[0].IsDeleted())
+
+	deleted, err := FindUserByEmployeeIDIncludingDeleted(s.ctx, s.db, user.EmployeeID)
+	s.NoError(err)
+	s.True(deleted.IsDeleted())
+
+	s.NoError(deleted.Restore(s.ctx, s.db))
+	got, err := GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.False(got.IsDeleted())
+
+	emailLogs, err := ListEmailLogs(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Len(emailLogs, 1, "email history should be kept")
+
+	s.NoError(got.Purge(s.ctx, s.db))
+	_, err = GetUserIncludingDeleted(s.ctx, s.db, int(user.ID))
+	s.Error(err)
+	emailLogs, err = ListEmailLogs(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Len(emailLogs, 0)
+}
+
+func (s *Suite) TestUserAttributes() {
+	user := User{User: insertUser(s.db)}
+	_, ok := user.AttributeString("office")
+	s.False(ok)
+	s.Empty(user.Attributes())
+
+	s.Error(user.SetAttribute("unknown", "x"), "attribute is not registered")
+	s.Error(user.SetAttribute("office", 12), "office is text")
+	s.Error(user.SetAttribute("office", strings.Repeat("x", 101)), "office is too long")
+
+	s.NoError(user.SetAttribute("office", "Nairobi"))
+	s.NoError(user.SetAttribute("cost_center", "CC-100"))
+	s.NoError(user.Update(s.ctx, s.db))
+
+	got, err := GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	office, ok := got.AttributeString("office")
+	s.True(ok)
+	s.Equal("Nairobi", office)
+	_, ok = got.AttributeInt("office")
+	s.False(ok, "office is not a number")
+	s.Equal(map[string]any{"office": "Nairobi", "cost_center": "CC-100"}, got.Attributes())
+
+	other, err := CreateUser(s.ctx, s.db, UserCreateInput{
+		EmployeeID: "10002",
+		Username:   "jane_doe",
+		Email:      "jane_doe@example.com",
+	})
+	s.NoError(err)
+	s.NoError(other.SetAttribute("office", "Lima"))
+	s.NoError(other.Update(s.ctx, s.db))
+
+	users, total, err := ListUsers(s.ctx, s.db, UserFilter{Attributes: map[string]any{"office": "Nairobi"}, Limit: 10})
+	s.NoError(err)
+	s.Equal(1, total)
+	s.Equal(user.ID, users[0].ID)
+
+	_, total, err = ListUsers(s.ctx, s.db, UserFilter{Limit: 10})
+	s.NoError(err)
+	s.Equal(2, total, "no attribute filter matches all users")
+
+	s.NoError(got.SetAttribute("office", nil))
+	s.NoError(got.Update(s.ctx, s.db))
+	got, err = GetUser(s.ctx, s.db, int(user.ID))
+	s.NoError(err)
+	s.Nil(got.Attribute("office"))
+	s.Equal("CC-100", got.Attribute("cost_center"))
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type Service interface {
-	Send(ctx context.Context, msg message.Message) error
+	// Send sends a message and returns the ID the provider assigned to it
+	Send(ctx context.Context, msg message.Message) (string, error)
 }
 
 // SendBatch sends a batch of email messages using the given service.
@@ -22,7 +23,7 @@ func SendBatch(ctx context.Context, svc Service, messages []message.Message) err
 	var err error
 	var errors []string
 	for _, msg := range messages {
-		if err = svc.Send(ctx, msg); err != nil {
+		if _, err = svc.Send(ctx, msg); err != nil {
 			errors = append(errors, err.Error())
 		}
 	}
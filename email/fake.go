@@ -4,74 +4,103 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/briskt/go-htmx-app/email/message"
 	"github.com/briskt/go-htmx-app/log"
-	"github.com/briskt/go-htmx-app/public"
 )
 
+// FakeConfig stores the configuration of the fake email service
+type FakeConfig struct {
+	// Assets is the file system of the message images and attachment files. The default is the embedded public assets.
+	Assets fs.FS
+
+	// Clock returns the time used for the Date header and SentAt of messages. The default is time.Now.
+	Clock func() time.Time
+}
+
+// FakeEmailService keeps sent messages in memory, for tests and for the developer mail inbox. It is safe for
+// concurrent use.
 type FakeEmailService struct {
+	mu           sync.Mutex
 	sentMessages []FakeMessage
+	lastID       int
+	assets       fs.FS
+	now          func() time.Time
 }
 
+// FakeMessage is a message captured by FakeEmailService. Body is the raw MIME message.
 type FakeMessage struct {
+	ID                      int
+	SentAt                  time.Time
 	Subject, Body, From, To string
 }
 
-func NewFake() Service {
-	return &FakeEmailService{}
+// NewFake returns a fake email service
+func NewFake(config FakeConfig) Service {
+	now := config.Clock
+	if now == nil {
+		now = time.Now
+	}
+	return &FakeEmailService{assets: defaultAssets(config.Assets), now: now}
 }
 
-func (t *FakeEmailService) Send(_ context.Context, msg message.Message) error {
+// Send stores the message in memory, where it can be seen in the developer mail inbox. The returned message ID is based
+// on the number of messages sent.
+func (t *FakeEmailService) Send(_ context.Context, msg message.Message) (string, error) {
 	to := msg.To()
 	from := msg.From()
 	subject := msg.Subject()
 	body := msg.Body()
 
 	if body == "ERROR" {
-		return errors.New("mock error for testing")
+		return "", errors.New("mock error for testing")
 	}
 
-	rawMessage, err := rawEmail(to, from, subject, body, msg.Images(), public.EFS())
+	sentAt := t.now()
+	rawMessage, err := rawEmail(msg, t.assets, sentAt)
 	if err != nil {
-		return fmt.Errorf("failed to MIME encode email body: %w", err)
+		return "", fmt.Errorf("failed to MIME encode email body: %w", err)
 	}
-	t.sentMessages = append(t.sentMessages,
-		FakeMessage{
-			Subject: subject,
-			Body:    string(rawMessage),
-			From:    from,
-			To:      to,
-		})
 
-	log.WithFields(log.Fields{"subject": subject, "to": to}).Info("(fake) message sent")
-
-	err = os.MkdirAll("email"+string(os.PathSeparator)+"tmp", 0o777)
-	if err != nil {
-		return fmt.Errorf("failed to create tmp folder: %w", err)
-	}
-	filename := "email/tmp/" + time.Now().Format("2006_01_02_15_04_05.eml")
-	if err = os.WriteFile(filename, rawMessage, 0o666); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	t.mu.Lock()
+	t.lastID++
+	sent := FakeMessage{
+		ID:      t.lastID,
+		SentAt:  sentAt,
+		Subject: subject,
+		Body:    string(rawMessage),
+		From:    from,
+		To:      to,
 	}
+	t.sentMessages = append(t.sentMessages, sent)
+	t.mu.Unlock()
 
-	return nil
+	log.WithFields(log.Fields{"subject": subject, "to": to}).Info("(fake) message sent")
+	return fmt.Sprintf("fake-%d", sent.ID), nil
 }
 
 // GetNumberOfMessagesSent returns the number of messages sent since initialization or the last call to
 // DeleteSentMessages
 func (t *FakeEmailService) GetNumberOfMessagesSent() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return len(t.sentMessages)
 }
 
-// DeleteSentMessages erases the store of sent messages
+// DeleteSentMessages erases the store of sent messages. The IDs of messages sent later continue the sequence.
 func (t *FakeEmailService) DeleteSentMessages() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.sentMessages = []FakeMessage{}
 }
 
 func (t *FakeEmailService) GetLastToEmail() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if len(t.sentMessages) == 0 {
 		return ""
 	}
@@ -80,6 +109,8 @@ func (t *FakeEmailService) GetLastToEmail() string {
 }
 
 func (t *FakeEmailService) GetToEmailByIndex(i int) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if len(t.sentMessages) <= i {
 		return ""
 	}
@@ -88,6 +119,8 @@ func (t *FakeEmailService) GetToEmailByIndex(i int) string {
 }
 
 func (t *FakeEmailService) GetAllToAddresses() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	emailAddresses := make([]string, len(t.sentMessages))
 	for i := range t.sentMessages {
 		emailAddresses[i] = t.sentMessages[i].To
@@ -96,6 +129,8 @@ func (t *FakeEmailService) GetAllToAddresses() []string {
 }
 
 func (t *FakeEmailService) GetLastBody() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if len(t.sentMessages) == 0 {
 		return ""
 	}
@@ -103,6 +138,29 @@ func (t *FakeEmailService) GetLastBody() string {
 	return t.sentMessages[len(t.sentMessages)-1].Body
 }
 
+// GetSentMessages returns a copy of the sent messages, oldest first
 func (t *FakeEmailService) GetSentMessages() []FakeMessage {
-	return t.sentMessages
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.sentMessages)
+}
+
+// FindSentMessage returns the sent message with the given ID
+func (t *FakeEmailService) FindSentMessage(id int) (FakeMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := slices.IndexFunc(t.sentMessages, func(m FakeMessage) bool { return m.ID == id })
+	if i < 0 {
+		return FakeMessage{}, false
+	}
+	return t.sentMessages[i], true
+}
+
+// Parts decodes the raw MIME message into its plain text, HTML and inline image parts
+func (m FakeMessage) Parts() (MIMEParts, error) {
+	parts, err := ParseMIME([]byte(m.Body))
+	if err != nil {
+		return MIMEParts{}, fmt.Errorf("failed to decode message %d: %w", m.ID, err)
+	}
+	return parts, nil
 }
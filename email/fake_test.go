@@ -0,0 +1,85 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/go-htmx-app/email/message"
+)
+
+func TestFakeEmailService_Concurrent(t *testing.T) {
+	fake := NewFake(FakeConfig{}).(*FakeEmailService)
+
+	const n = 10
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fake.Send(context.Background(), newTestMessage())
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	sent := fake.GetSentMessages()
+	require.Len(t, sent, n)
+	ids := map[int]bool{}
+	for _, m := range sent {
+		ids[m.ID] = true
+	}
+	require.Len(t, ids, n, "message IDs should be unique")
+
+	fake.DeleteSentMessages()
+	require.Equal(t, 0, fake.GetNumberOfMessagesSent())
+	id, err := fake.Send(context.Background(), newTestMessage())
+	require.NoError(t, err)
+	require.Equal(t, "fake-11", id, "IDs should not be reused after the messages are deleted")
+}
+
+func TestFakeMessage_Parts(t *testing.T) {
+	fake := NewFake(FakeConfig{}).(*FakeEmailService)
+	msg := message.NewRendered(
+		message.NewAddress("From Name", "from@example.com"),
+		message.NewAddress("To Name", "to@example.com"),
+		"test subject",
+		`<h4>Hello</h4><img src="cid:logo"><p>End of body</p>`,
+		map[string]string{"logo": "assets/img/logo.png"},
+	)
+	_, err := fake.Send(context.Background(), msg)
+	require.NoError(t, err)
+
+	sent, ok := fake.FindSentMessage(1)
+	require.True(t, ok)
+	_, ok = fake.FindSentMessage(2)
+	require.False(t, ok)
+
+	parts, err := sent.Parts()
+	require.NoError(t, err)
+	require.Contains(t, parts.Text, "Hello")
+	require.NotContains(t, parts.Text, "<h4>")
+	require.Contains(t, parts.HTML, "<h4>Hello</h4>")
+	require.Len(t, parts.Images, 1)
+	require.Equal(t, "image/png", parts.Images["logo"].ContentType)
+	require.Equal(t, []byte("\x89PNG"), parts.Images["logo"].Data[:4])
+}
+
+func TestFakeEmailService_Clock(t *testing.T) {
+	sentAt := time.Date(2026, 3, 4, 15, 4, 5, 0, time.UTC)
+	fake := NewFake(FakeConfig{Clock: func() time.Time { return sentAt }}).(*FakeEmailService)
+	_, err := fake.Send(context.Background(), newTestMessage())
+	require.NoError(t, err)
+
+	sent, ok := fake.FindSentMessage(1)
+	require.True(t, ok)
+	require.Equal(t, sentAt, sent.SentAt)
+	parsed, err := mail.ReadMessage(strings.NewReader(sent.Body))
+	require.NoError(t, err)
+	require.Equal(t, "Wed, 04 Mar 2026 15:04:05 +0000", parsed.Header.Get("Date"), "the date should be from the clock")
+}
@@ -5,12 +5,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"time"
 
 	"github.com/mailgun/mailgun-go/v4"
 
 	"github.com/briskt/go-htmx-app/email/message"
 	"github.com/briskt/go-htmx-app/log"
-	"github.com/briskt/go-htmx-app/public"
 )
 
 // MailgunConfig stores required configuration parameters for the Mailgun SDK
@@ -18,39 +19,58 @@ type MailgunConfig struct {
 	Domain       string
 	PrivateKey   string
 	SandboxEmail string
+
+	// Assets is the file system of the message images and attachment files. The default is the embedded public assets.
+	Assets fs.FS
+
+	// Clock returns the time used for the Date header of messages. The default is time.Now.
+	Clock func() time.Time
 }
 
 // Mailgun sends email using Amazon Simple Email Service (Mailgun)
 type Mailgun struct {
 	sandbox string
+	assets  fs.FS
+	now     func() time.Time
 
 	*mailgun.MailgunImpl
 }
 
 func NewMailgun(config MailgunConfig) Service {
 	svc := mailgun.NewMailgun(config.Domain, config.PrivateKey)
-	return Mailgun{MailgunImpl: svc, sandbox: config.SandboxEmail}
+	now := config.Clock
+	if now == nil {
+		now = time.Now
+	}
+	return Mailgun{MailgunImpl: svc, sandbox: config.SandboxEmail, assets: defaultAssets(config.Assets), now: now}
 }
 
 // Send a message
-func (s Mailgun) Send(ctx context.Context, msg message.Message) error {
-	to := msg.To()
+func (s Mailgun) Send(ctx context.Context, msg message.Message) (string, error) {
 	if s.sandbox != "" {
-		to = s.sandbox
+		msg = msg.Sandboxed(s.sandbox)
 	}
+	to := msg.To()
 	log.WithFields(log.Fields{"to": to, "subject": msg.Subject()}).Debug("sending message using Mailgun")
 
-	rawBody, err := rawEmail(to, msg.From(), msg.Subject(), msg.Body(), msg.Images(), public.EFS())
+	// BCC recipients are only given to Mailgun here, since they are not in the message headers
+	recipients := msg.Recipients()
+	addresses := make([]string, len(recipients))
+	for i, r := range recipients {
+		addresses[i] = r.Addr()
+	}
+
+	// The SDK reads the whole message into memory before sending it, so there is nothing to gain from streaming it
+	rawBody, err := rawEmail(msg, s.assets, s.now())
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return "", fmt.Errorf("failed to send email: %w", err)
 	}
 
-	mgMsg := s.NewMIMEMessage(io.NopCloser(bytes.NewReader(rawBody)), to) // TODO: make a streaming version of rawEmail for this
-	status, id, err := s.MailgunImpl.Send(ctx, mgMsg)
+	status, id, err := s.MailgunImpl.Send(ctx, s.NewMIMEMessage(io.NopCloser(bytes.NewReader(rawBody)), addresses...))
 	if err != nil {
-		return fmt.Errorf("failed to send using Mailgun: %w", err)
+		return "", fmt.Errorf("failed to send using Mailgun: %w", err)
 	}
 
 	log.WithFields(log.Fields{"to": to, "status": status, "id": id}).Info("sent message using Mailgun")
-	return nil
+	return id, nil
 }
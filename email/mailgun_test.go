@@ -1,8 +1,16 @@
 package email_test
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -25,12 +33,66 @@ func TestSendMailgun(t *testing.T) {
 	params := message.Params{
 		Template: message.Welcome,
 		From:     message.NewAddress("name", "from@example.com"),
-		To:       message.NewAddress("name", "to@example.com"),
+		To:       []message.Address{message.NewAddress("name", "to@example.com")},
 		Fields:   map[string]any{},
 		Images:   map[string]string{},
 	}
 	msg, _ := message.New(params)
 
-	err := service.Send(context.Background(), msg)
+	_, err := service.Send(context.Background(), msg)
 	require.NoError(t, err)
 }
+
+func TestMailgun_Assets(t *testing.T) {
+	logo := []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`)
+
+	var mu sync.Mutex
+	var received [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("message")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		raw, _ := io.ReadAll(file)
+		mu.Lock()
+		received = append(received, raw)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"message": "Queued. Thank you.", "id": "<test@example.com>"}`))
+	}))
+	defer server.Close()
+
+	sentAt := time.Date(2026, 3, 4, 15, 4, 5, 0, time.UTC)
+	service := email.NewMailgun(email.MailgunConfig{
+		Domain:     "example.com",
+		PrivateKey: "key",
+		Assets:     fstest.MapFS{"brand/logo.svg": {Data: logo}},
+		Clock:      func() time.Time { return sentAt },
+	})
+	service.(email.Mailgun).SetAPIBase(server.URL + "/v3")
+
+	newMessage := func(logo string) message.Message {
+		return message.NewRendered(
+			message.NewAddress("", "from@example.com"),
+			message.NewAddress("", "to@example.com"),
+			"test subject",
+			`<h4>body</h4><img src="cid:logo">`,
+			map[string]string{"logo": logo},
+		)
+	}
+
+	id, err := service.Send(context.Background(), newMessage("brand/logo.svg"))
+	require.NoError(t, err)
+	require.Equal(t, "<test@example.com>", id)
+	require.Len(t, received, 1)
+	parts, err := email.ParseMIME(received[0])
+	require.NoError(t, err)
+	require.Equal(t, logo, parts.Images["logo"].Data)
+	parsed, err := mail.ReadMessage(bytes.NewReader(received[0]))
+	require.NoError(t, err)
+	require.Equal(t, "Wed, 04 Mar 2026 15:04:05 +0000", parsed.Header.Get("Date"), "the date should be from the clock")
+
+	_, err = service.Send(context.Background(), newMessage("brand/missing.svg"))
+	require.ErrorContains(t, err, "brand/missing.svg")
+	require.Len(t, received, 1, "an incomplete message should not be sent")
+}
@@ -1,5 +1,9 @@
 package message
 
+import (
+	"net/mail"
+)
+
 type Address struct {
 	name string
 	addr string
@@ -26,3 +30,12 @@ func (a Address) Addr() string {
 func (a Address) Name() string {
 	return a.name
 }
+
+// Encoded returns the address for a message header. A name that is not ASCII is encoded as an RFC 2047 encoded-word,
+// and any other name is quoted.
+func (a Address) Encoded() string {
+	if a.name == "" {
+		return a.addr
+	}
+	return (&mail.Address{Name: a.name, Address: a.addr}).String()
+}
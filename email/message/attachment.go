@@ -0,0 +1,64 @@
+package message
+
+import (
+	"mime"
+	"path"
+)
+
+// Attachment is a file attached to a message. Its content is either given as data, or read from a file in the assets
+// file system of the email service when the message is sent.
+type Attachment struct {
+	filename    string
+	contentType string
+	data        []byte
+	path        string
+}
+
+// NewAttachment returns an attachment with the given content. If contentType is empty, it is guessed from the
+// extension of filename.
+func NewAttachment(filename, contentType string, data []byte) Attachment {
+	return Attachment{
+		filename:    filename,
+		contentType: attachmentContentType(filename, contentType),
+		data:        data,
+	}
+}
+
+// NewFileAttachment returns an attachment read from a file in the assets file system, such as "assets/doc/terms.pdf",
+// named after the file. If contentType is empty, it is guessed from the extension of the file.
+func NewFileAttachment(filePath, contentType string) Attachment {
+	return Attachment{
+		filename:    path.Base(filePath),
+		contentType: attachmentContentType(filePath, contentType),
+		path:        filePath,
+	}
+}
+
+// Filename is the name of the attachment shown to the recipient
+func (a Attachment) Filename() string {
+	return a.filename
+}
+
+func (a Attachment) ContentType() string {
+	return a.contentType
+}
+
+// Data returns the content of the attachment, or nil if it is read from Path
+func (a Attachment) Data() []byte {
+	return a.data
+}
+
+// Path returns the file the attachment is read from, or "" if the content is given by Data
+func (a Attachment) Path() string {
+	return a.path
+}
+
+func attachmentContentType(filename, contentType string) string {
+	if contentType != "" {
+		return contentType
+	}
+	if byExtension := mime.TypeByExtension(path.Ext(filename)); byExtension != "" {
+		return byExtension
+	}
+	return "application/octet-stream"
+}
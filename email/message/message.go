@@ -2,81 +2,151 @@ package message
 
 import (
 	"fmt"
-	"html/template"
+	"maps"
+	"mime"
+	"net/textproto"
+	"slices"
 	"strings"
-
-	"github.com/briskt/go-htmx-app/email/templates"
 )
 
 const (
-	Welcome = "welcome"
+	Welcome            = "welcome"
+	HRSyncReport       = "hr_sync_report"
+	InactivityWarning  = "inactivity_warning"
+	EmailChangeConfirm = "email_change_confirm"
+	EmailChanged       = "email_changed"
+	DataExportReady    = "data_export_ready"
 )
 
 type Message struct {
 	from    Address
-	to      Address
+	to      []Address
+	cc      []Address
+	bcc     []Address
+	replyTo Address
 	subject string
 	body    string
 
 	// Images returns a map where the keys are the image tag (cid) and the values are the filenames.
 	// Any image that doesn't map to a corresponding `src="cid:tag"` in the body will be omitted from the inline
-	// attachments. The included filenames must be in the static.EFS() filesystem. TODO: make this file system more
-	// portable by adding it as an input to this package's initialization.
+	// attachments. The included filenames are read from the assets file system of the email service.
 	images map[string]string
-}
 
-var bodyTemplates = make(map[string]*template.Template)
+	attachments []Attachment
+}
 
 type Fields map[string]any
 
 type Params struct {
 	Template string
 	From     Address
-	To       Address
+	To       []Address
+	CC       []Address
+	BCC      []Address
+	ReplyTo  Address // optional
 	Fields   Fields
-	Images   map[string]string
-}
 
-func init() {
-	for name := range subjects {
-		parsed, err := template.ParseFS(templates.EFS(), "base.gohtml", name+".gohtml")
-		if err != nil {
-			panic(fmt.Sprintf("failed to parse subject template '%s': %v", name, err))
-		}
-		bodyTemplates[name] = parsed
-	}
+	// Locale selects the translation of the template, such as "fr" or "fr-CA", falling back to DefaultLocale
+	Locale string
+
+	// Images are added to the default images of the template, replacing any with the same content ID
+	Images map[string]string
+
+	Attachments []Attachment
 }
 
+// New renders a message from a template, in the locale given by params. All fields required by the template must be
+// given.
 func New(params Params) (Message, error) {
-	body, err := execBodyTemplate(params.Template, params.Fields)
+	t, ok := registry[params.Template]
+	if !ok {
+		return Message{}, fmt.Errorf("template '%s' not found", params.Template)
+	}
+	if field, missing := t.missingField(params.Fields); missing {
+		return Message{}, fmt.Errorf("missing field '%s' for template '%s'", field, params.Template)
+	}
+
+	localized := t.localize(params.Locale)
+	body, err := localized.execBody(t.Name, params.Fields)
 	if err != nil {
 		return Message{}, err
 	}
 
-	subject, err := execSubjectTemplate(params.Template, params.Fields)
+	subject, err := localized.execSubject(t.Name, params.Fields)
 	if err != nil {
 		return Message{}, err
 	}
 
+	images := maps.Clone(t.Images)
+	maps.Copy(images, params.Images)
+
 	m := Message{
+		body:        body,
+		from:        params.From,
+		to:          params.To,
+		cc:          params.CC,
+		bcc:         params.BCC,
+		replyTo:     params.ReplyTo,
+		subject:     subject,
+		images:      images,
+		attachments: params.Attachments,
+	}
+	return m, nil
+}
+
+// NewRendered returns a message with a subject and body that were already rendered, such as one read from a queue
+func NewRendered(from, to Address, subject, body string, images map[string]string) Message {
+	return Message{
 		body:    body,
-		from:    params.From,
-		to:      params.To,
+		from:    from,
+		to:      []Address{to},
 		subject: subject,
-		images:  params.Images,
+		images:  images,
 	}
-	return m, nil
 }
 
-func execBodyTemplate(templateName string, fields Fields) (string, error) {
+// NewRenderedFromParams returns a message with the addresses, images and attachments of params, and a subject and body
+// that were already rendered, such as one read from a queue. The template, fields and locale of params are not used.
+func NewRenderedFromParams(params Params, subject, body string) Message {
+	return Message{
+		body:        body,
+		from:        params.From,
+		to:          params.To,
+		cc:          params.CC,
+		bcc:         params.BCC,
+		replyTo:     params.ReplyTo,
+		subject:     subject,
+		images:      params.Images,
+		attachments: params.Attachments,
+	}
+}
+
+// Sandboxed returns a copy of the message sent only to addr, without CC or BCC, for keeping email from real recipients
+// outside of production
+func (m Message) Sandboxed(addr string) Message {
+	m.to = []Address{NewAddress("", addr)}
+	m.cc = nil
+	m.bcc = nil
+	return m
+}
+
+func (lt *localizedTemplate) execBody(templateName string, fields Fields) (string, error) {
 	var sb strings.Builder
-	err := bodyTemplates[templateName].ExecuteTemplate(&sb, "base.gohtml", fields)
+	err := lt.body.ExecuteTemplate(&sb, baseTemplate+templateExt, fields)
 	if err != nil {
 		return "", fmt.Errorf("failed to execute template '%s': %w", templateName, err)
 	}
 	return sb.String(), nil
 }
 
+func (lt *localizedTemplate) execSubject(templateName string, fields Fields) (string, error) {
+	var sb strings.Builder
+	if err := lt.subject.Execute(&sb, fields); err != nil {
+		return "", fmt.Errorf("failed to execute subject template '%s': %w", templateName, err)
+	}
+	return sb.String(), nil
+}
+
 func (m Message) Body() string {
 	return m.body
 }
@@ -85,8 +155,24 @@ func (m Message) From() string {
 	return m.from.String()
 }
 
+// To returns the To header of the message, listing all To addresses
 func (m Message) To() string {
-	return m.to.String()
+	return joinAddresses(m.to)
+}
+
+// CC returns the Cc header of the message, or "" if there is no CC
+func (m Message) CC() string {
+	return joinAddresses(m.cc)
+}
+
+// ReplyTo returns the Reply-To header of the message, or "" if replies go to the sender
+func (m Message) ReplyTo() string {
+	return m.replyTo.String()
+}
+
+// Recipients returns all addresses the message is delivered to: To, CC and BCC
+func (m Message) Recipients() []Address {
+	return slices.Concat(m.to, m.cc, m.bcc)
 }
 
 func (m Message) Subject() string {
@@ -96,3 +182,39 @@ func (m Message) Subject() string {
 func (m Message) Images() map[string]string {
 	return m.images
 }
+
+func (m Message) Attachments() []Attachment {
+	return m.attachments
+}
+
+// Header returns the From, To, Cc, Reply-To and Subject headers of the message, encoded for MIME. Names and a subject
+// that are not ASCII are encoded as RFC 2047 encoded-words.
+func (m Message) Header() textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("From", m.from.Encoded())
+	header.Set("To", joinEncodedAddresses(m.to))
+	if len(m.cc) > 0 {
+		header.Set("Cc", joinEncodedAddresses(m.cc))
+	}
+	if m.replyTo != (Address{}) {
+		header.Set("Reply-To", m.replyTo.Encoded())
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", m.subject))
+	return header
+}
+
+func joinAddresses(addresses []Address) string {
+	s := make([]string, len(addresses))
+	for i, a := range addresses {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+func joinEncodedAddresses(addresses []Address) string {
+	s := make([]string, len(addresses))
+	for i, a := range addresses {
+		s[i] = a.Encoded()
+	}
+	return strings.Join(s, ", ")
+}
@@ -17,11 +17,12 @@ func TestMethodVerify(t *testing.T) {
 		"SupportEmail":   "support@example.com",
 		"SupportName":    "Support Team",
 		"ToAddress":      "foo@example.com",
+		"Username":       "x_smith",
 	}
 	params := message.Params{
 		Template: message.Welcome,
 		From:     message.NewAddress("no_reply@example.com", "No Reply"),
-		To:       message.NewAddress("X Smith", "foo@example.com"),
+		To:       []message.Address{message.NewAddress("X Smith", "foo@example.com")},
 		Fields:   fields,
 		Images:   map[string]string{"logo": "logo.png"},
 	}
@@ -33,3 +34,227 @@ func TestMethodVerify(t *testing.T) {
 	require.Contains(t, msg.Body(), "message signature")
 	require.Equal(t, map[string]string{"logo": "logo.png"}, msg.Images())
 }
+
+func TestHRSyncReport(t *testing.T) {
+	type change struct {
+		EmployeeID string
+		Name       string
+		Changes    []struct{ Field, Old, New string }
+	}
+	report := struct {
+		Source      string
+		FeedRecords int
+		Created     []change
+		Updated     []change
+		Deactivated []change
+		Unchanged   int
+		Errors      []string
+		Aborted     bool
+	}{
+		Source:      "/data/hr.csv",
+		FeedRecords: 3,
+		Created:     []change{{EmployeeID: "10001", Name: "Jane Smith"}},
+		Deactivated: []change{{EmployeeID: "10002", Name: "John Doe"}},
+		Unchanged:   1,
+		Aborted:     true,
+	}
+	params := message.Params{
+		Template: message.HRSyncReport,
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "Admin", "Report": report},
+	}
+	msg, err := message.New(params)
+	require.NoError(t, err)
+	require.Equal(t, "Aborted: Test HR feed sync report", msg.Subject())
+	require.Contains(t, msg.Body(), "10001 Jane Smith")
+	require.Contains(t, msg.Body(), "10002 John Doe")
+	require.Contains(t, msg.Body(), "no changes were made")
+}
+
+func TestInactivityWarning(t *testing.T) {
+	params := message.Params{
+		Template: message.InactivityWarning,
+		Fields: message.Fields{
+			"AppName":          "Test",
+			"DisplayName":      "X Smith",
+			"LastLogin":        "January 2, 2026",
+			"DeactivationDate": "March 4, 2026",
+			"AppURL":           "https://example.com",
+		},
+	}
+	msg, err := message.New(params)
+	require.NoError(t, err)
+	require.Equal(t, "Your Test account will be deactivated", msg.Subject())
+	require.Contains(t, msg.Body(), "since January 2, 2026")
+	require.Contains(t, msg.Body(), "after March 4, 2026")
+}
+
+func TestEmailChange(t *testing.T) {
+	params := message.Params{
+		Template: message.EmailChangeConfirm,
+		Fields: message.Fields{
+			"AppName":     "Test",
+			"DisplayName": "X Smith",
+			"NewEmail":    "x.smith@example.org",
+			"ConfirmURL":  "https://example.com/profile/email/confirm?token=abc",
+			"ExpiresAt":   "March 4, 2026",
+		},
+	}
+	msg, err := message.New(params)
+	require.NoError(t, err)
+	require.Equal(t, "Confirm your new Test email address", msg.Subject())
+	require.Contains(t, msg.Body(), `href="https://example.com/profile/email/confirm?token=abc"`)
+	require.Contains(t, msg.Body(), "expires on March 4, 2026")
+
+	params = message.Params{
+		Template: message.EmailChanged,
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "X Smith", "NewEmail": "x.smith@example.org"},
+	}
+	msg, err = message.New(params)
+	require.NoError(t, err)
+	require.Equal(t, "Your Test email address was changed", msg.Subject())
+	require.Contains(t, msg.Body(), "changed to x.smith@example.org")
+}
+
+func TestDataExportReady(t *testing.T) {
+	params := message.Params{
+		Template: message.DataExportReady,
+		Fields: message.Fields{
+			"AppName":     "Test",
+			"DisplayName": "Admin",
+			"Self":        false,
+			"SubjectName": "X Smith",
+			"DownloadURL": "https://example.com/exports/download?token=abc",
+			"ExpiresAt":   "March 4, 2026",
+		},
+	}
+	msg, err := message.New(params)
+	require.NoError(t, err)
+	require.Equal(t, "Your Test data export is ready", msg.Subject())
+	require.Contains(t, msg.Body(), "data of X Smith is ready")
+	require.Contains(t, msg.Body(), `href="https://example.com/exports/download?token=abc"`)
+}
+
+func TestSampleFields(t *testing.T) {
+	for _, name := range message.Templates() {
+		t.Run(name, func(t *testing.T) {
+			fields, err := message.SampleFields(name)
+			require.NoError(t, err)
+			fields["AppName"] = "Test"
+			fields["DisplayName"] = "X Smith"
+
+			msg, err := message.New(message.Params{Template: name, Fields: fields})
+			require.NoError(t, err)
+			require.Contains(t, msg.Subject(), "Test")
+			require.Contains(t, msg.Body(), "Dear X Smith")
+		})
+	}
+
+	_, err := message.SampleFields("unknown")
+	require.Error(t, err)
+}
+
+func TestLocale(t *testing.T) {
+	fields := message.Fields{
+		"AppName":      "Test",
+		"DisplayName":  "X Smith",
+		"SupportEmail": "support@example.com",
+		"Username":     "x_smith",
+	}
+	tests := []struct {
+		name        string
+		locale      string
+		wantSubject string
+		wantBody    []string
+	}{
+		{
+			name:        "default",
+			locale:      "",
+			wantSubject: "Important information about your Test account",
+			wantBody:    []string{"Dear X Smith", "Thank you"},
+		},
+		{
+			name:        "translated",
+			locale:      "fr",
+			wantSubject: "Informations importantes sur votre compte Test",
+			wantBody:    []string{"Bonjour X Smith", "Merci"},
+		},
+		{
+			name:        "region falls back to language",
+			locale:      "es-MX",
+			wantSubject: "Información importante sobre su cuenta de Test",
+			wantBody:    []string{"Estimado/a X Smith", "Gracias"},
+		},
+		{
+			name:        "unsupported falls back to default",
+			locale:      "de",
+			wantSubject: "Important information about your Test account",
+			wantBody:    []string{"Dear X Smith", "Thank you"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := message.New(message.Params{Template: message.Welcome, Locale: tt.locale, Fields: fields})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantSubject, msg.Subject())
+			for _, want := range tt.wantBody {
+				require.Contains(t, msg.Body(), want)
+			}
+		})
+	}
+
+	// A template without a translation is rendered in the default locale, with the shared strings translated
+	msg, err := message.New(message.Params{
+		Template: message.EmailChanged,
+		Locale:   "fr",
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "X Smith", "NewEmail": "x.smith@example.org"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Your Test email address was changed", msg.Subject())
+	require.Contains(t, msg.Body(), "Merci")
+}
+
+func TestRecipients(t *testing.T) {
+	msg, err := message.New(message.Params{
+		Template: message.Welcome,
+		From:     message.NewAddress("No Reply", "no_reply@example.com"),
+		To:       []message.Address{message.NewAddress("X Smith", "x@example.com"), message.NewAddress("", "y@example.com")},
+		CC:       []message.Address{message.NewAddress("Manager", "manager@example.com")},
+		BCC:      []message.Address{message.NewAddress("", "audit@example.com")},
+		ReplyTo:  message.NewAddress("Support", "support@example.com"),
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "X Smith", "Username": "x_smith"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "X Smith <x@example.com>, y@example.com", msg.To())
+	require.Equal(t, "Manager <manager@example.com>", msg.CC())
+	require.Equal(t, "Support <support@example.com>", msg.ReplyTo())
+	require.Equal(t, []message.Address{
+		message.NewAddress("X Smith", "x@example.com"),
+		message.NewAddress("", "y@example.com"),
+		message.NewAddress("Manager", "manager@example.com"),
+		message.NewAddress("", "audit@example.com"),
+	}, msg.Recipients())
+
+	sandboxed := msg.Sandboxed("sandbox@example.com")
+	require.Equal(t, "sandbox@example.com", sandboxed.To())
+	require.Empty(t, sandboxed.CC())
+	require.Equal(t, []message.Address{message.NewAddress("", "sandbox@example.com")}, sandboxed.Recipients())
+	require.Equal(t, "Support <support@example.com>", sandboxed.ReplyTo())
+	require.Len(t, msg.Recipients(), 4, "the original message should not be changed")
+}
+
+func TestAttachment(t *testing.T) {
+	a := message.NewAttachment("export.json", "", []byte("{}"))
+	require.Equal(t, "export.json", a.Filename())
+	require.Equal(t, "application/json", a.ContentType())
+	require.Equal(t, []byte("{}"), a.Data())
+	require.Empty(t, a.Path())
+
+	a = message.NewFileAttachment("assets/doc/terms.pdf", "")
+	require.Equal(t, "terms.pdf", a.Filename())
+	require.Equal(t, "application/pdf", a.ContentType())
+	require.Nil(t, a.Data())
+	require.Equal(t, "assets/doc/terms.pdf", a.Path())
+
+	a = message.NewAttachment("data.unknown-extension", "", nil)
+	require.Equal(t, "application/octet-stream", a.ContentType())
+}
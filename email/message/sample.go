@@ -0,0 +1,17 @@
+package message
+
+import (
+	"fmt"
+
+	"github.com/briskt/go-htmx-app/email/templates"
+)
+
+// SampleFields returns example values of the fields specific to a template, for previewing it. They are read from the
+// template's sample file, next to the template, such as "welcome.sample.json". The fields common to all messages, like
+// AppName and DisplayName, are not included.
+func SampleFields(templateName string) (Fields, error) {
+	if _, ok := registry[templateName]; !ok {
+		return nil, fmt.Errorf("template '%s' not found", templateName)
+	}
+	return readSampleFields(templates.EFS(), templateName)
+}
@@ -0,0 +1,387 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/briskt/go-htmx-app/email/templates"
+)
+
+const (
+	// DefaultLocale is the locale of the templates and subjects without a locale in their filename
+	DefaultLocale = "en"
+
+	baseTemplate     = "base"
+	templateExt      = ".gohtml"
+	sampleExt        = ".sample.json"
+	catalogDir       = "catalog"
+	frontMatterDelim = "---"
+)
+
+// Template is a message template, with the subject, fields and images declared in its front matter
+type Template struct {
+	Name string
+
+	// Fields are the names of the fields that must be given to render the template, including the fields required by
+	// the base template
+	Fields []string
+
+	// Images are the inline images added to every message, keyed by content ID, with the filenames in the assets file
+	// system
+	Images map[string]string
+
+	// locales holds the subject and body of the template in each locale, including DefaultLocale
+	locales map[string]*localizedTemplate
+}
+
+// localizedTemplate is the subject and body of a template in one locale
+type localizedTemplate struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// frontMatter is the declaration at the start of a template file
+type frontMatter struct {
+	subject        string
+	requiredFields []string
+	optionalFields []string
+	images         map[string]string
+}
+
+// catalog holds the translations of the strings shared by all templates in one locale, keyed by the English string
+type catalog map[string]string
+
+var registry map[string]*Template
+
+func init() {
+	var err error
+	registry, err = loadTemplates(templates.EFS())
+	if err != nil {
+		panic(fmt.Sprintf("invalid email templates: %v", err))
+	}
+}
+
+// Templates returns the names of all message templates, sorted
+func Templates() []string {
+	return slices.Sorted(maps.Keys(registry))
+}
+
+// loadTemplates parses and validates all message templates in fsys, in all locales that have a catalog. Each
+// template is rendered with its sample fields, failing on a field that is not declared in the front matter or on a
+// string missing from a catalog.
+func loadTemplates(fsys fs.FS) (map[string]*Template, error) {
+	baseFront, baseContent, err := readTemplateFile(fsys, baseTemplate)
+	if err != nil {
+		return nil, err
+	}
+	base, err := htmltemplate.New(baseTemplate + templateExt).Funcs(translateFuncs(nil, false)).Parse(baseContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base template: %w", err)
+	}
+
+	catalogs, err := readCatalogs(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames, err := fs.Glob(fsys, "*"+templateExt)
+	if err != nil {
+		return nil, err
+	}
+
+	// files lists the template files by template name and locale, such as "welcome.fr" for "welcome" in "fr"
+	files := map[string]map[string]string{}
+	for _, filename := range filenames {
+		id := strings.TrimSuffix(path.Base(filename), templateExt)
+		name, locale, localized := strings.Cut(id, ".")
+		if !localized {
+			locale = DefaultLocale
+		} else if _, ok := catalogs[locale]; !ok {
+			return nil, fmt.Errorf("template '%s' has no catalog for locale '%s'", id, locale)
+		}
+		if name == baseTemplate {
+			if localized {
+				return nil, fmt.Errorf("template '%s' cannot be localized, add its strings to the catalogs instead", id)
+			}
+			continue
+		}
+		if files[name] == nil {
+			files[name] = map[string]string{}
+		}
+		files[name][locale] = id
+	}
+
+	loaded := map[string]*Template{}
+	for name, localeFiles := range files {
+		if _, ok := localeFiles[DefaultLocale]; !ok {
+			return nil, fmt.Errorf("localized template '%s' has no default template '%s'", name, name+templateExt)
+		}
+		t, err := loadTemplate(fsys, name, localeFiles, base, baseFront, catalogs)
+		if err != nil {
+			return nil, err
+		}
+		loaded[name] = t
+	}
+	return loaded, nil
+}
+
+func loadTemplate(fsys fs.FS, name string, localeFiles map[string]string, base *htmltemplate.Template,
+	baseFront frontMatter, catalogs map[string]catalog,
+) (*Template, error) {
+	front, content, err := readTemplateFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if front.subject == "" {
+		return nil, fmt.Errorf("template '%s' has no subject", name)
+	}
+
+	t := &Template{
+		Name:    name,
+		Fields:  append(slices.Clone(baseFront.requiredFields), front.requiredFields...),
+		Images:  maps.Clone(baseFront.images),
+		locales: map[string]*localizedTemplate{},
+	}
+	maps.Copy(t.Images, front.images)
+
+	sample, err := readDeclaredSample(fsys, name, baseFront, front)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template '%s': %w", name, err)
+	}
+
+	for _, locale := range append([]string{DefaultLocale}, slices.Sorted(maps.Keys(catalogs))...) {
+		if _, ok := t.locales[locale]; ok {
+			continue
+		}
+
+		// A locale without its own template file uses the default subject and body, with the base template's shared
+		// strings translated
+		id, subject, localeContent := name, front.subject, content
+		if localeID, ok := localeFiles[locale]; ok && localeID != name {
+			id = localeID
+			localeFront, c, err := readTemplateFile(fsys, id)
+			if err != nil {
+				return nil, err
+			}
+			if localeFront.subject == "" {
+				return nil, fmt.Errorf("template '%s' has no subject", id)
+			}
+			if len(localeFront.requiredFields)+len(localeFront.optionalFields)+len(localeFront.images) > 0 {
+				return nil, fmt.Errorf("template '%s' may only declare a subject, its fields and images are those of '%s'",
+					id, name+templateExt)
+			}
+			subject, localeContent = localeFront.subject, c
+		}
+
+		lt := &localizedTemplate{}
+		if lt.subject, err = texttemplate.New(id).Parse(subject); err != nil {
+			return nil, fmt.Errorf("failed to parse subject of template '%s': %w", id, err)
+		}
+		body := htmltemplate.Must(base.Clone()).Funcs(translateFuncs(catalogs[locale], false))
+		if lt.body, err = body.Parse(localeContent); err != nil {
+			return nil, fmt.Errorf("failed to parse template '%s': %w", id, err)
+		}
+		if lt.body.Lookup("body") == nil {
+			return nil, fmt.Errorf("template '%s' does not define \"body\"", id)
+		}
+
+		if err = lt.validate(sample, catalogs[locale]); err != nil {
+			return nil, fmt.Errorf("invalid template '%s' in locale '%s': %w", id, locale, err)
+		}
+		t.locales[locale] = lt
+	}
+	return t, nil
+}
+
+// readDeclaredSample returns the sample values of all fields declared by the base template and by a template, read
+// from the sample files of both. It is an error if a declared field has no sample value.
+func readDeclaredSample(fsys fs.FS, name string, baseFront, front frontMatter) (Fields, error) {
+	baseSample, err := readSampleFields(fsys, baseTemplate)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := readSampleFields(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(baseSample, sample)
+
+	declared := Fields{}
+	for _, fields := range [][]string{
+		baseFront.requiredFields, baseFront.optionalFields, front.requiredFields, front.optionalFields,
+	} {
+		for _, field := range fields {
+			value, ok := baseSample[field]
+			if !ok {
+				return nil, fmt.Errorf("no sample value for field '%s'", field)
+			}
+			declared[field] = value
+		}
+	}
+	return declared, nil
+}
+
+// validate renders the template with the declared sample fields. Rendering fails if the template uses a field that is
+// not declared, or a shared string that is not in the catalog of its locale.
+func (lt *localizedTemplate) validate(sample Fields, c catalog) error {
+	subject, err := lt.subject.Clone()
+	if err != nil {
+		return err
+	}
+	if err = subject.Option("missingkey=error").Execute(io.Discard, sample); err != nil {
+		return fmt.Errorf("subject: %w", err)
+	}
+	body, err := lt.body.Clone()
+	if err != nil {
+		return err
+	}
+	body = body.Funcs(translateFuncs(c, true)).Option("missingkey=error")
+	if err = body.ExecuteTemplate(io.Discard, baseTemplate+templateExt, sample); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	return nil
+}
+
+// localize returns the template in a locale, such as "fr" or "fr-CA". A regional locale falls back to its language,
+// and a locale without templates falls back to DefaultLocale.
+func (t *Template) localize(locale string) *localizedTemplate {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if lt, ok := t.locales[locale]; ok {
+		return lt
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if lt, ok := t.locales[language]; ok {
+		return lt
+	}
+	return t.locales[DefaultLocale]
+}
+
+// missingField returns the name of the first required field not in fields, if any
+func (t *Template) missingField(fields Fields) (string, bool) {
+	for _, field := range t.Fields {
+		if _, ok := fields[field]; !ok {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// translateFuncs returns the template functions for translating the shared strings of the base template, like
+// {{ t "Thank you" }}. With a nil catalog, the strings are not translated. A string missing from the catalog is an
+// error if strict, and otherwise is not translated.
+func translateFuncs(c catalog, strict bool) htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{
+		"t": func(s string) (string, error) {
+			if c == nil {
+				return s, nil
+			}
+			if translated, ok := c[s]; ok {
+				return translated, nil
+			}
+			if strict {
+				return "", fmt.Errorf("no translation of %q in the catalog", s)
+			}
+			return s, nil
+		},
+	}
+}
+
+// readCatalogs reads the catalogs of all locales other than the default, such as "catalog/fr.json" for "fr"
+func readCatalogs(fsys fs.FS) (map[string]catalog, error) {
+	filenames, err := fs.Glob(fsys, catalogDir+"/*.json")
+	if err != nil {
+		return nil, err
+	}
+	catalogs := map[string]catalog{}
+	for _, filename := range filenames {
+		locale := strings.TrimSuffix(path.Base(filename), ".json")
+		file, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog '%s': %w", locale, err)
+		}
+		c := catalog{}
+		if err = json.Unmarshal(file, &c); err != nil {
+			return nil, fmt.Errorf("invalid catalog '%s': %w", locale, err)
+		}
+		catalogs[locale] = c
+	}
+	return catalogs, nil
+}
+
+// readTemplateFile reads a template file and separates the front matter from the template content
+func readTemplateFile(fsys fs.FS, name string) (frontMatter, string, error) {
+	file, err := fs.ReadFile(fsys, name+templateExt)
+	if err != nil {
+		return frontMatter{}, "", fmt.Errorf("failed to read template '%s': %w", name, err)
+	}
+	front, content, err := parseFrontMatter(file)
+	if err != nil {
+		return frontMatter{}, "", fmt.Errorf("invalid front matter in template '%s': %w", name, err)
+	}
+	return front, content, nil
+}
+
+// parseFrontMatter reads the "key: value" lines between the "---" lines at the start of a template file
+func parseFrontMatter(file []byte) (frontMatter, string, error) {
+	front := frontMatter{images: map[string]string{}}
+
+	lines := strings.SplitAfter(string(file), "\n")
+	if strings.TrimSpace(lines[0]) != frontMatterDelim {
+		return front, "", fmt.Errorf("file must start with %q", frontMatterDelim)
+	}
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(line) == frontMatterDelim {
+			return front, strings.Join(lines[i+2:], ""), nil
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return front, "", fmt.Errorf("invalid line %q", strings.TrimSpace(line))
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "subject":
+			front.subject = value
+		case "fields":
+			for _, field := range strings.Fields(value) {
+				if optional, ok := strings.CutSuffix(field, "?"); ok {
+					front.optionalFields = append(front.optionalFields, optional)
+				} else {
+					front.requiredFields = append(front.requiredFields, field)
+				}
+			}
+		case "images":
+			for _, image := range strings.Fields(value) {
+				cid, filename, ok := strings.Cut(image, "=")
+				if !ok {
+					return front, "", fmt.Errorf("invalid image %q, must be cid=filename", image)
+				}
+				front.images[cid] = filename
+			}
+		default:
+			return front, "", fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return front, "", fmt.Errorf("missing closing %q", frontMatterDelim)
+}
+
+// readSampleFields reads the example values of the fields of a template
+func readSampleFields(fsys fs.FS, name string) (Fields, error) {
+	file, err := fs.ReadFile(fsys, name+sampleExt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sample fields of template '%s': %w", name, err)
+	}
+	fields := Fields{}
+	if err = json.Unmarshal(file, &fields); err != nil {
+		return nil, fmt.Errorf("invalid sample fields of template '%s': %w", name, err)
+	}
+	return fields, nil
+}
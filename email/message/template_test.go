@@ -0,0 +1,154 @@
+package message
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	const base = "---\nfields: AppName Language?\nimages: logo=assets/img/logo.png\n---\n" +
+		`<html lang="{{ or .Language "en" }}">{{ template "body" . }} {{ t "Thank you" }}</html>`
+	const note = "---\nsubject: Note from {{ .AppName }}\nfields: Text\nimages: icon=assets/img/icon.png\n---\n" +
+		`{{ define "body" }}{{ .Text }}{{ end }}`
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"note.gohtml":      note,
+				"note.sample.json": `{"Text": "Hello"}`,
+			},
+		},
+		{
+			name: "localized",
+			files: map[string]string{
+				"note.gohtml":      note,
+				"note.fr.gohtml":   "---\nsubject: Note de {{ .AppName }}\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+				"catalog/fr.json":  `{"Thank you": "Merci"}`,
+			},
+		},
+		{
+			name: "localized without catalog",
+			files: map[string]string{
+				"note.gohtml":      note,
+				"note.fr.gohtml":   "---\nsubject: Note de {{ .AppName }}\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+			},
+			wantErr: "template 'note.fr' has no catalog for locale 'fr'",
+		},
+		{
+			name: "localized declares fields",
+			files: map[string]string{
+				"note.gohtml":      note,
+				"note.fr.gohtml":   "---\nsubject: Note\nfields: Other\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+				"catalog/fr.json":  `{"Thank you": "Merci"}`,
+			},
+			wantErr: "template 'note.fr' may only declare a subject",
+		},
+		{
+			name: "localized without default",
+			files: map[string]string{
+				"other.fr.gohtml": "---\nsubject: Note\n---\n" + `{{ define "body" }}Bonjour{{ end }}`,
+				"catalog/fr.json": `{"Thank you": "Merci"}`,
+			},
+			wantErr: "localized template 'other' has no default template",
+		},
+		{
+			name: "missing translation",
+			files: map[string]string{
+				"note.gohtml":      note,
+				"note.sample.json": `{"Text": "Hello"}`,
+				"catalog/fr.json":  `{}`,
+			},
+			wantErr: `invalid template 'note' in locale 'fr': body: template: base.gohtml:1:64: ` +
+				`executing "base.gohtml" at <t "Thank you">: error calling t: no translation of "Thank you" in the catalog`,
+		},
+		{
+			name: "parse error",
+			files: map[string]string{
+				"note.gohtml":      "---\nsubject: Note\nfields: Text\n---\n" + `{{ define "body" }}{{ .Text }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+			},
+			wantErr: "failed to parse template 'note'",
+		},
+		{
+			name: "no subject",
+			files: map[string]string{
+				"note.gohtml":      "---\nfields: Text\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+			},
+			wantErr: "template 'note' has no subject",
+		},
+		{
+			name: "no front matter",
+			files: map[string]string{
+				"note.gohtml":      `{{ define "body" }}Hello{{ end }}`,
+				"note.sample.json": `{}`,
+			},
+			wantErr: "invalid front matter in template 'note'",
+		},
+		{
+			name: "no sample value",
+			files: map[string]string{
+				"note.gohtml":      "---\nsubject: Note\nfields: Text\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{}`,
+			},
+			wantErr: "no sample value for field 'Text'",
+		},
+		{
+			name: "undeclared field in body",
+			files: map[string]string{
+				"note.gohtml":      "---\nsubject: Note\nfields: Text\n---\n" + `{{ define "body" }}{{ .Text }} {{ .Other }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello", "Other": "World"}`,
+			},
+			wantErr: `map has no entry for key "Other"`,
+		},
+		{
+			name: "undeclared field in subject",
+			files: map[string]string{
+				"note.gohtml":      "---\nsubject: Note {{ .Other }}\nfields: Text\n---\n" + `{{ define "body" }}{{ .Text }}{{ end }}`,
+				"note.sample.json": `{"Text": "Hello"}`,
+			},
+			wantErr: "subject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"base.gohtml":      {Data: []byte(base)},
+				"base.sample.json": {Data: []byte(`{"AppName": "Test", "Language": "en"}`)},
+			}
+			for name, content := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+
+			loaded, err := loadTemplates(fsys)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			note := loaded["note"]
+			require.Equal(t, []string{"AppName", "Text"}, note.Fields)
+			require.Equal(t, map[string]string{"logo": "assets/img/logo.png", "icon": "assets/img/icon.png"}, note.Images)
+			require.Contains(t, note.locales, DefaultLocale)
+		})
+	}
+}
+
+func TestNew_MissingField(t *testing.T) {
+	_, err := New(Params{Template: Welcome, Fields: Fields{"AppName": "Test", "DisplayName": "X Smith"}})
+	require.ErrorContains(t, err, "missing field 'Username'")
+
+	_, err = New(Params{Template: "unknown", Fields: Fields{}})
+	require.ErrorContains(t, err, "template 'unknown' not found")
+}
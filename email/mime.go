@@ -1,23 +1,49 @@
 package email
 
 import (
+	"bufio"
 	"bytes"
-	"embed"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
 	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
 	"net/textproto"
+	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"jaytaylor.com/html2text"
+
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/public"
+)
+
+const (
+	crlf = "\r\n"
+
+	// base64LineLength is the maximum length of a line of base64 encoded content, from RFC 2045
+	base64LineLength = 76
 )
 
-// rawEmail generates a multipart MIME email message with a plain text, html text, and inline image attachments
+// writeMIME writes a message to w as a multipart MIME email message dated date, with a plain text, html text, inline
+// image attachments and file attachments. The images and the files of attachments not given as data are read from
+// assets while they are written, so large files are never held in memory whole.
 // The images should be provided as a map, where the keys are the image tag and the values are the filenames.
 // Any image that doesn't map to a corresponding `src="cid:tag"` in the body will be omitted from the inline
-// attachments. The included filenames must be in the static.EFS() filesystem. TODO: make this file system more
-// portable by adding it as an input to this package's initialization.
-// The generated email can be summarized as follows:
+// attachments.
+// The generated email can be summarized as follows, where multipart/mixed is only added if there are attachments:
+//
+//   - multipart/mixed
 //
 //   - multipart/alternative
 //
@@ -29,14 +55,20 @@ import (
 //
 //   - image/png
 //
-//     Abbreviated example of the generated email message:
+//   - application/pdf (attachment)
+//
+//     Abbreviated example of the generated email message, which has CRLF line endings:
+//     Date: Mon, 02 Jan 2006 15:04:05 +0000
+//     Message-ID: <random@example.com>
 //     From: from@example.com
-//     To: to@example.com
+//     To: =?utf-8?q?Ren=C3=A9?= <to@example.com>
 //     Subject: subject text
+//     MIME-Version: 1.0
 //     Content-Type: multipart/alternative; boundary="boundary_alternative"
 //
 //     --boundary_alternative
 //     Content-Type: text/plain; charset=utf-8
+//     Content-Transfer-Encoding: quoted-printable
 //
 //     Plain text body
 //     --boundary_alternative
@@ -44,6 +76,7 @@ import (
 //
 //     --boundary_related
 //     Content-Type: text/html; charset=utf-8
+//     Content-Transfer-Encoding: quoted-printable
 //
 //     HTML body
 //     --boundary_related
@@ -52,71 +85,155 @@ import (
 //     Content-ID: <logo>
 //     --boundary_related--
 //     --boundary_alternative--
-func rawEmail(to, from, subject, body string, images map[string]string, fileSys *embed.FS) ([]byte, error) {
-	if images == nil {
-		images = map[string]string{}
-	}
+func writeMIME(w io.Writer, msg message.Message, assets fs.FS, date time.Time) error {
+	body := msg.Body()
 
 	tbody, err := html2text.FromString(body)
 	if err != nil {
-		return nil, fmt.Errorf("error converting html email to plain text: %q", err)
+		return fmt.Errorf("error converting html email to plain text: %q", err)
 	}
 
-	b := &bytes.Buffer{}
+	header := msg.Header()
+	messageID, err := newMessageID(header.Get("From"))
+	if err != nil {
+		return err
+	}
+	header.Set("Date", date.Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID)
+	header.Set("MIME-Version", "1.0")
 
-	b.WriteString("From: " + from + "\n")
-	b.WriteString("To: " + to + "\n")
-	b.WriteString("Subject: " + subject + "\n")
-	b.WriteString("MIME-Version: 1.0\n")
+	var mixedWriter *multipart.Writer
+	alternativeWriter := multipart.NewWriter(w)
+	alternativeType := `multipart/alternative; type="text/plain"; boundary="` + alternativeWriter.Boundary() + `"`
+	if len(msg.Attachments()) > 0 {
+		mixedWriter = multipart.NewWriter(w)
+		header.Set("Content-Type", `multipart/mixed; boundary="`+mixedWriter.Boundary()+`"`)
+	} else {
+		header.Set("Content-Type", alternativeType)
+	}
+	if err = writeHeader(w, header); err != nil {
+		return fmt.Errorf("failed to write MIME header: %q", err)
+	}
 
-	alternativeWriter := multipart.NewWriter(b)
-	b.WriteString(`Content-Type: multipart/alternative; type="text/plain"; boundary="` +
-		alternativeWriter.Boundary() + `"` + "\n\n")
+	if mixedWriter != nil {
+		_, err = mixedWriter.CreatePart(textproto.MIMEHeader{"Content-Type": {alternativeType}})
+		if err != nil {
+			return fmt.Errorf("failed to create MIME alternative part: %q", err)
+		}
+	}
 
-	w, err := alternativeWriter.CreatePart(textproto.MIMEHeader{
-		"Content-Type":        {"text/plain; charset=utf-8"},
-		"Content-Disposition": {"inline"},
+	part, err := alternativeWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Disposition":       {"inline"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MIME text part: %q", err)
-	} else {
-		_, _ = fmt.Fprint(w, tbody)
+		return fmt.Errorf("failed to create MIME text part: %q", err)
+	}
+	if err = writeQuotedPrintable(part, tbody); err != nil {
+		return fmt.Errorf("failed to write MIME text part: %q", err)
 	}
 
-	relatedWriter := multipart.NewWriter(b)
+	relatedWriter := multipart.NewWriter(w)
 	_, err = alternativeWriter.CreatePart(textproto.MIMEHeader{
 		"Content-Type": {`multipart/related; type="text/html"; boundary="` + relatedWriter.Boundary() + `"`},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MIME related part: %q", err)
+		return fmt.Errorf("failed to create MIME related part: %q", err)
 	}
 
-	w, err = relatedWriter.CreatePart(textproto.MIMEHeader{
-		"Content-Type":        {"text/html; charset=utf-8"},
-		"Content-Disposition": {"inline"},
+	part, err = relatedWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Disposition":       {"inline"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MIME html part: %q", err)
-	} else {
-		_, _ = fmt.Fprint(w, body)
+		return fmt.Errorf("failed to create MIME html part: %q", err)
+	}
+	if err = writeQuotedPrintable(part, body); err != nil {
+		return fmt.Errorf("failed to write MIME html part: %q", err)
 	}
 
-	cids := findImagesInBody(body, images)
-	if err = attachImages(relatedWriter, b, cids, fileSys); err != nil {
-		return nil, fmt.Errorf("failed to attach images: %q", err)
+	cids := findImagesInBody(body, msg.Images())
+	if err = attachImages(relatedWriter, cids, assets); err != nil {
+		return fmt.Errorf("failed to attach images: %q", err)
 	}
 
 	if err = relatedWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close MIME related part: %q", err)
+		return fmt.Errorf("failed to close MIME related part: %q", err)
 	}
 
 	if err = alternativeWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close MIME alternative part: %q", err)
+		return fmt.Errorf("failed to close MIME alternative part: %q", err)
+	}
+
+	if mixedWriter == nil {
+		return nil
 	}
 
+	if err = attachFiles(mixedWriter, msg.Attachments(), assets); err != nil {
+		return fmt.Errorf("failed to attach files: %q", err)
+	}
+
+	if err = mixedWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close MIME mixed part: %q", err)
+	}
+	return nil
+}
+
+// rawEmail returns a message as a multipart MIME email message dated date, for providers that take the whole message
+// at once. See writeMIME.
+func rawEmail(msg message.Message, assets fs.FS, date time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writeMIME(&b, msg, assets, date); err != nil {
+		return nil, err
+	}
 	return b.Bytes(), nil
 }
 
+// headerOrder is the order of the top-level headers of a message
+var headerOrder = []string{
+	"Date", "Message-ID", "From", "To", "Cc", "Reply-To", "Subject", "MIME-Version", "Content-Type",
+}
+
+// writeHeader writes the top-level headers of a message, and the blank line that ends them
+func writeHeader(w io.Writer, header textproto.MIMEHeader) error {
+	var sb strings.Builder
+	for _, key := range headerOrder {
+		if value := header.Get(key); value != "" {
+			sb.WriteString(key + ": " + value + crlf)
+		}
+	}
+	sb.WriteString(crlf)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// newMessageID returns a unique Message-ID on the domain of the sender's address
+func newMessageID(from string) (string, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return "", fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	_, domain, _ := strings.Cut(address.Address, "@")
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate Message-ID: %w", err)
+	}
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">", nil
+}
+
+// writeQuotedPrintable writes s to w as quoted-printable text, which has CRLF line endings and lines of at most 76
+// characters
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
 func findImagesInBody(body string, images map[string]string) map[string]string {
 	imagesFound := map[string]string{}
 	for cid, filename := range images {
@@ -127,42 +244,225 @@ func findImagesInBody(body string, images map[string]string) map[string]string {
 	return imagesFound
 }
 
-func attachImages(relatedWriter *multipart.Writer, b *bytes.Buffer, images map[string]string, fileSys *embed.FS) error {
-	for cid, filename := range images {
-		_, err := relatedWriter.CreatePart(textproto.MIMEHeader{
-			"Content-Type":              {"image/png"},
-			"Content-Disposition":       {"inline"},
-			"Content-ID":                {"<" + cid + ">"},
+func attachImages(relatedWriter *multipart.Writer, images map[string]string, assets fs.FS) error {
+	for _, cid := range slices.Sorted(maps.Keys(images)) {
+		if err := attachImage(relatedWriter, cid, images[cid], assets); err != nil {
+			return fmt.Errorf("failed to attach image '%s': %w", cid, err)
+		}
+	}
+	return nil
+}
+
+func attachImage(relatedWriter *multipart.Writer, cid, filename string, assets fs.FS) error {
+	file, err := assets.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s' file: %w", filename, err)
+	}
+	defer file.Close()
+
+	// the start of the file is read ahead, for detecting the content type of a file without a known extension
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(512)
+
+	part, err := relatedWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {detectContentType(filename, head)},
+		"Content-Disposition":       {"inline"},
+		"Content-ID":                {"<" + cid + ">"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MIME image part: %w", err)
+	}
+
+	if err = encode(part, reader); err != nil {
+		return fmt.Errorf("failed to encode file '%s': %w", filename, err)
+	}
+	return nil
+}
+
+// detectContentType returns the media type of a file from its extension or, if the extension is unknown, from the
+// first 512 bytes of its content
+func detectContentType(filename string, head []byte) string {
+	if contentType := mime.TypeByExtension(path.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(head)
+}
+
+func attachFiles(mixedWriter *multipart.Writer, attachments []message.Attachment, assets fs.FS) error {
+	for _, attachment := range attachments {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename()})
+		part, err := mixedWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType()},
+			"Content-Disposition":       {disposition},
 			"Content-Transfer-Encoding": {"base64"},
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create MIME image part for '%s': %w", cid, err)
+			return fmt.Errorf("failed to create MIME attachment part for '%s': %w", attachment.Filename(), err)
 		}
 
-		if err = encodeFile(fileSys, filename, b); err != nil {
-			return fmt.Errorf("failed to encode file for '%s': %w", cid, err)
+		if attachment.Data() == nil {
+			err = encodeFile(assets, attachment.Path(), part)
+		} else {
+			err = encode(part, bytes.NewReader(attachment.Data()))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode attachment '%s': %w", attachment.Filename(), err)
 		}
 	}
 	return nil
 }
 
-// encodeFile reads a file from an embedded file system, base64 encodes it, and streams into a bytes.Buffer
-func encodeFile(fileSys *embed.FS, filename string, buffer *bytes.Buffer) error {
-	file, err := fileSys.ReadFile(filename)
+// encodeFile reads a file from a file system, base64 encodes it, and streams it into w
+func encodeFile(assets fs.FS, filename string, w io.Writer) error {
+	file, err := assets.Open(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read '%s' file: %w", filename, err)
+		return fmt.Errorf("failed to open '%s' file: %w", filename, err)
 	}
+	defer file.Close()
 
-	encoder := base64.NewEncoder(base64.StdEncoding, buffer)
-	_, err = encoder.Write(file)
-	if err != nil {
+	if err = encode(w, file); err != nil {
 		return fmt.Errorf("failed to encode file '%s': %w", filename, err)
 	}
+	return nil
+}
+
+// encode base64 encodes everything read from r into w, in lines of base64LineLength characters
+func encode(w io.Writer, r io.Reader) error {
+	encoder := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w})
+	if _, err := io.Copy(encoder, r); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to close base64 encoder: %w", err)
+	}
+	return nil
+}
+
+// lineWrapper is a writer that starts a new line, with CRLF, after every base64LineLength bytes written through it
+type lineWrapper struct {
+	w io.Writer
 
-	err = encoder.Close()
+	// n is the length of the current line
+	n int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.n == base64LineLength {
+			if _, err := io.WriteString(l.w, crlf); err != nil {
+				return written, err
+			}
+			l.n = 0
+		}
+		n, err := l.w.Write(p[:min(len(p), base64LineLength-l.n)])
+		written += n
+		l.n += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// RawMessage returns a message as MIME, as it is sent by the email services, with the images and attachment files
+// read from assets
+func RawMessage(msg message.Message, assets fs.FS) ([]byte, error) {
+	return rawEmail(msg, assets, time.Now())
+}
+
+// defaultAssets returns assets, or the embedded public assets if it is nil
+func defaultAssets(assets fs.FS) fs.FS {
+	if assets == nil {
+		return public.EFS()
+	}
+	return assets
+}
+
+// MIMEParts holds the decoded content of a MIME message
+type MIMEParts struct {
+	Text string
+	HTML string
+
+	// Images are the inline images, keyed by content ID
+	Images map[string]MIMEImage
+
+	Attachments []MIMEAttachment
+}
+
+// MIMEImage is an inline image of a MIME message
+type MIMEImage struct {
+	ContentType string
+	Data        []byte
+}
+
+// MIMEAttachment is a file attached to a MIME message
+type MIMEAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ParseMIME decodes a MIME message into its plain text, HTML, inline image and attachment parts
+func ParseMIME(raw []byte) (MIMEParts, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
 	if err != nil {
-		return fmt.Errorf("failed to close '%s' base64 encoder: %w", filename, err)
+		return MIMEParts{}, fmt.Errorf("failed to read MIME message: %w", err)
 	}
+	parts := MIMEParts{Images: map[string]MIMEImage{}}
+	if err = parts.read(textproto.MIMEHeader(msg.Header), msg.Body); err != nil {
+		return MIMEParts{}, fmt.Errorf("failed to decode MIME message: %w", err)
+	}
+	return parts, nil
+}
 
+// read decodes one MIME part, and any parts nested in it
+func (p *MIMEParts) read(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err = p.read(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	switch {
+	case disposition == "attachment":
+		p.Attachments = append(p.Attachments, MIMEAttachment{
+			Filename:    dispositionParams["filename"],
+			ContentType: mediaType,
+			Data:        content,
+		})
+	case mediaType == "text/plain":
+		p.Text = string(content)
+	case mediaType == "text/html":
+		p.HTML = string(content)
+	case strings.HasPrefix(mediaType, "image/"):
+		cid := strings.Trim(header.Get("Content-ID"), "<>")
+		p.Images[cid] = MIMEImage{ContentType: mediaType, Data: content}
+	}
 	return nil
 }
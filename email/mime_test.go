@@ -3,25 +3,219 @@ package email
 import (
 	"bytes"
 	"embed"
+	"maps"
+	"mime"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/go-htmx-app/email/message"
 )
 
 //go:embed logo_test.svg
 var files embed.FS
 
 func TestRawEmail(t *testing.T) {
-	raw, err := rawEmail(
-		"to@example.com",
-		"from@example.com",
+	msg := message.NewRendered(
+		message.NewAddress("", "from@example.com"),
+		message.NewAddress("", "to@example.com"),
 		"test subject",
 		`<h4>body</h4><img src="cid:logo"><p>End of body</p>`,
 		map[string]string{"logo": "logo_test.svg"},
-		&files)
+	)
+	raw, err := rawEmail(msg, &files, time.Now())
 	require.NoError(t, err)
 
 	require.Greater(t, len(raw), 1000)
+	require.Contains(t, string(raw), "Content-Type: multipart/alternative")
+	require.NotContains(t, string(raw), "multipart/mixed")
+}
+
+func TestRawEmail_Attachments(t *testing.T) {
+	msg, err := message.New(message.Params{
+		Template: message.Welcome,
+		From:     message.NewAddress("", "from@example.com"),
+		To:       []message.Address{message.NewAddress("", "to@example.com")},
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "X Smith", "Username": "x_smith"},
+		Images:   map[string]string{"logo": "logo_test.svg"},
+		Attachments: []message.Attachment{
+			message.NewAttachment("report.csv", "text/csv", []byte("id,name\n1,X Smith\n")),
+			message.NewFileAttachment("logo_test.svg", ""),
+		},
+	})
+	require.NoError(t, err)
+
+	raw, err := rawEmail(msg, &files, time.Now())
+	require.NoError(t, err)
+	require.Contains(t, string(raw), "Content-Type: multipart/mixed")
+
+	parts, err := ParseMIME(raw)
+	require.NoError(t, err)
+	require.Contains(t, parts.Text, "x_smith")
+	require.Contains(t, parts.HTML, "x_smith")
+	require.Equal(t, []MIMEAttachment{
+		{Filename: "report.csv", ContentType: "text/csv", Data: []byte("id,name\n1,X Smith\n")},
+		{Filename: "logo_test.svg", ContentType: "image/svg+xml", Data: mustReadFile(t, "logo_test.svg")},
+	}, parts.Attachments)
+	require.Equal(t, []string{"logo"}, slices.Collect(maps.Keys(parts.Images)), "an attached image is not inline")
+
+	_, err = rawEmail(message.NewRendered(message.Address{}, message.Address{}, "", "", nil), &files, time.Now())
+	require.ErrorContains(t, err, "invalid sender address")
+}
+
+func TestRawEmail_Headers(t *testing.T) {
+	msg, err := message.New(message.Params{
+		Template: message.Welcome,
+		From:     message.NewAddress("Équipe App", "no_reply@app.example.com"),
+		To:       []message.Address{message.NewAddress("René Müller", "rene@example.com")},
+		CC:       []message.Address{message.NewAddress("Smith, John", "john@example.com")},
+		BCC:      []message.Address{message.NewAddress("", "audit@example.com")},
+		ReplyTo:  message.NewAddress("Support", "support@example.com"),
+		Locale:   "fr",
+		Fields:   message.Fields{"AppName": "Café ☕", "DisplayName": "René Müller", "Username": "rene"},
+		Images:   map[string]string{"logo": "logo_test.svg"},
+	})
+	require.NoError(t, err)
+
+	sentAt := time.Date(2026, 3, 4, 15, 4, 5, 0, time.FixedZone("", -5*60*60))
+	raw, err := rawEmail(msg, &files, sentAt)
+	require.NoError(t, err)
+
+	require.NotRegexp(t, "[^\r]\n", string(raw), "all line endings should be CRLF")
+	header, _, _ := strings.Cut(string(raw), "\r\n\r\n")
+	for _, line := range strings.Split(header, "\r\n") {
+		require.Regexp(t, "^[\\x20-\\x7e\\t]*$", line, "header lines should be ASCII")
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	require.Equal(t, "Wed, 04 Mar 2026 15:04:05 -0500", parsed.Header.Get("Date"))
+	require.Regexp(t, "^<[0-9a-f]{32}@app\\.example\\.com>$", parsed.Header.Get("Message-ID"))
+
+	from, err := parsed.Header.AddressList("From")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Équipe App", Address: "no_reply@app.example.com"}}, from)
+	to, err := parsed.Header.AddressList("To")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "René Müller", Address: "rene@example.com"}}, to)
+	cc, err := parsed.Header.AddressList("Cc")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Smith, John", Address: "john@example.com"}}, cc)
+	replyTo, err := parsed.Header.AddressList("Reply-To")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Support", Address: "support@example.com"}}, replyTo)
+	require.Empty(t, parsed.Header.Get("Bcc"))
+	require.NotContains(t, string(raw), "audit@example.com")
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Informations importantes sur votre compte Café ☕", subject)
+
+	parts, err := ParseMIME(raw)
+	require.NoError(t, err)
+	require.Contains(t, parts.HTML, "Bonjour René Müller")
+	require.Equal(t, "image/svg+xml", parts.Images["logo"].ContentType)
+	require.Equal(t, mustReadFile(t, "logo_test.svg"), parts.Images["logo"].Data)
+}
+
+func TestWriteMIME(t *testing.T) {
+	logo := mustReadFile(t, "logo_test.svg")
+	assets := fstest.MapFS{
+		"img/logo.svg":  {Data: logo},
+		"doc/terms.txt": {Data: []byte("terms of use\n")},
+	}
+	msg, err := message.New(message.Params{
+		Template:    message.Welcome,
+		From:        message.NewAddress("", "from@example.com"),
+		To:          []message.Address{message.NewAddress("", "to@example.com")},
+		Fields:      message.Fields{"AppName": "Test", "DisplayName": "X Smith", "Username": "x_smith"},
+		Images:      map[string]string{"logo": "img/logo.svg"},
+		Attachments: []message.Attachment{message.NewFileAttachment("doc/terms.txt", "")},
+	})
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, writeMIME(&b, msg, assets, time.Now()))
+
+	parts, err := ParseMIME(b.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, logo, parts.Images["logo"].Data)
+	require.Equal(t, []MIMEAttachment{
+		{Filename: "terms.txt", ContentType: "text/plain", Data: []byte("terms of use\n")},
+	}, parts.Attachments)
+
+	delete(assets, "doc/terms.txt")
+	err = writeMIME(&bytes.Buffer{}, msg, assets, time.Now())
+	require.ErrorContains(t, err, "doc/terms.txt")
+}
+
+func TestRawEmail_LineLength(t *testing.T) {
+	body := "<p>" + strings.Repeat("Très long paragraphe, sans retour à la ligne. ", 200) + `</p><img src="cid:logo">`
+	attachment := bytes.Repeat([]byte{0, 1, 2, 253, 254, 255}, 2000)
+	msg := message.NewRenderedFromParams(message.Params{
+		From:        message.NewAddress("", "from@example.com"),
+		To:          []message.Address{message.NewAddress("", "to@example.com")},
+		Images:      map[string]string{"logo": "logo_test.svg"},
+		Attachments: []message.Attachment{message.NewAttachment("data.bin", "", attachment)},
+	}, "test subject", body)
+
+	raw, err := rawEmail(msg, &files, time.Now())
+	require.NoError(t, err)
+
+	base64Line := regexp.MustCompile(`^[A-Za-z0-9+/]+=*$`)
+	for i, line := range strings.Split(string(raw), "\r\n") {
+		require.LessOrEqual(t, len(line), 998, "line %d is too long", i+1)
+		if base64Line.MatchString(line) {
+			require.LessOrEqual(t, len(line), 76, "base64 line %d is too long", i+1)
+		}
+		require.NotContains(t, line, "\n", "line %d does not end with CRLF", i+1)
+	}
+
+	parts, err := ParseMIME(raw)
+	require.NoError(t, err)
+	require.Equal(t, body, parts.HTML)
+	require.Contains(t, parts.Text, "Très long paragraphe")
+	require.Equal(t, mustReadFile(t, "logo_test.svg"), parts.Images["logo"].Data)
+	require.Len(t, parts.Attachments, 1)
+	require.Equal(t, attachment, parts.Attachments[0].Data)
+}
+
+func TestRawEmail_MessageID(t *testing.T) {
+	msg := message.NewRendered(
+		message.NewAddress("", "from@example.com"),
+		message.NewAddress("", "to@example.com"),
+		"test subject",
+		"<p>body</p>",
+		nil,
+	)
+	ids := map[string]bool{}
+	for range 3 {
+		raw, err := rawEmail(msg, &files, time.Now())
+		require.NoError(t, err)
+		parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+		require.NoError(t, err)
+		ids[parsed.Header.Get("Message-ID")] = true
+	}
+	require.Len(t, ids, 3, "each message should have a unique Message-ID")
+}
+
+func Test_detectContentType(t *testing.T) {
+	require.Equal(t, "image/png", detectContentType("logo.png", nil))
+	require.Equal(t, "image/svg+xml", detectContentType("logo.svg", nil))
+	require.Equal(t, "image/gif", detectContentType("logo.unknown-extension", []byte("GIF89a")))
+}
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	data, err := files.ReadFile(filename)
+	require.NoError(t, err)
+	return data
 }
 
 func Test_encodeFile(t *testing.T) {
@@ -41,7 +235,9 @@ func Test_encodeFile(t *testing.T) {
 			name:     "good",
 			filename: "logo_test.svg",
 			wantErr:  false,
-			want:     "PHN2ZyB3aWR0aD0iMTAiIGhlaWdodD0iMTAiIHhtbG5zPSJodHRwOi8vd3d3LnczLm9yZy8yMDAwL3N2ZyI+PHJlY3Qgd2lkdGg9IjEwIiBoZWlnaHQ9IjEwIiBzdHlsZT0iZmlsbDpyZWQiLz48L3N2Zz4K",
+			want: "PHN2ZyB3aWR0aD0iMTAiIGhlaWdodD0iMTAiIHhtbG5zPSJodHRwOi8vd3d3LnczLm9yZy8yMDAw\r\n" +
+				"L3N2ZyI+PHJlY3Qgd2lkdGg9IjEwIiBoZWlnaHQ9IjEwIiBzdHlsZT0iZmlsbDpyZWQiLz48L3N2\r\n" +
+				"Zz4K",
 		},
 	}
 	for _, tt := range tests {
@@ -3,56 +3,83 @@ package email
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/aws/aws-sdk-go-v2/service/ses/types"
 
 	"github.com/briskt/go-htmx-app/email/message"
 	"github.com/briskt/go-htmx-app/log"
-	"github.com/briskt/go-htmx-app/public"
 )
 
+// SESConfig stores the configuration of the SES service. The AWS credentials and region are read from the environment,
+// according to the AWS SDK documentation.
+type SESConfig struct {
+	SandboxEmail string
+
+	// Assets is the file system of the message images and attachment files. The default is the embedded public assets.
+	Assets fs.FS
+
+	// Clock returns the time used for the Date header of messages. The default is time.Now.
+	Clock func() time.Time
+}
+
 // SES sends email using Amazon Simple Email Service (SES)
 type SES struct {
 	sandbox string
+	assets  fs.FS
+	now     func() time.Time
 
 	*ses.Client
 }
 
 // NewSES returns an SES service provider for the Service interface
-func NewSES(sandboxEmail string) (Service, error) {
-	defaultConfig, err := config.LoadDefaultConfig(context.Background())
+func NewSES(config SESConfig) (Service, error) {
+	defaultConfig, err := awsconfig.LoadDefaultConfig(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load SES configuration: %w", err)
 	}
 	client := ses.NewFromConfig(defaultConfig)
-	return SES{Client: client, sandbox: sandboxEmail}, nil
+	now := config.Clock
+	if now == nil {
+		now = time.Now
+	}
+	return SES{Client: client, sandbox: config.SandboxEmail, assets: defaultAssets(config.Assets), now: now}, nil
 }
 
 // Send a message
-func (s SES) Send(ctx context.Context, msg message.Message) error {
-	to := msg.To()
+func (s SES) Send(ctx context.Context, msg message.Message) (string, error) {
 	if s.sandbox != "" {
-		to = s.sandbox
+		msg = msg.Sandboxed(s.sandbox)
 	}
-	rawBody, err := rawEmail(to, msg.From(), msg.Subject(), msg.Body(), msg.Images(), public.EFS())
+	rawBody, err := rawEmail(msg, s.assets, s.now())
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+
+	// BCC recipients are only given to SES as destinations, since they are not in the message headers
+	recipients := msg.Recipients()
+	destinations := make([]string, len(recipients))
+	for i, r := range recipients {
+		destinations[i] = r.Addr()
 	}
-	return s.SendRaw(ctx, rawBody)
+	return s.SendRaw(ctx, rawBody, destinations...)
 }
 
-// SendRaw sends a message using SES, given a pre-built raw byte stream
-func (s SES) SendRaw(ctx context.Context, data []byte) error {
+// SendRaw sends a message using SES, given a pre-built raw byte stream, and returns the SES message ID. If no
+// destinations are given, the message is sent to the addresses in its To, Cc and Bcc headers.
+func (s SES) SendRaw(ctx context.Context, data []byte, destinations ...string) (string, error) {
 	input := ses.SendRawEmailInput{
-		RawMessage: &types.RawMessage{Data: data},
+		RawMessage:   &types.RawMessage{Data: data},
+		Destinations: destinations,
 	}
 	output, err := s.Client.SendRawEmail(ctx, &input)
 	if err != nil {
-		return fmt.Errorf("failed to send using SES: %w", err)
+		return "", fmt.Errorf("failed to send using SES: %w", err)
 	}
 
 	log.WithFields(log.Fields{"messageID": *output.MessageId}).Info("message sent using SES")
-	return nil
+	return *output.MessageId, nil
 }
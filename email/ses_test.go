@@ -3,6 +3,7 @@ package email
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -14,19 +15,19 @@ import (
 func TestSendRaw(t *testing.T) {
 	t.Skip("only for use in local environment if configured with credentials")
 
-	data, err := rawEmail(
-		"me@example.com",
-		"from@example.com",
+	data, err := rawEmail(message.NewRendered(
+		message.NewAddress("", "from@example.com"),
+		message.NewAddress("", "me@example.com"),
 		"test subject",
 		`<h4>body</h4><img src="cid:logo"><p>End of body</p>`,
 		map[string]string{"logo": "logo.png"},
-		&files)
+	), &files, time.Now())
 	require.NoError(t, err)
 
-	ses, err := NewSES("me@example.com")
+	ses, err := NewSES(SESConfig{SandboxEmail: "me@example.com"})
 	require.NoError(t, err)
 
-	err = ses.(SES).SendRaw(context.Background(), data)
+	_, err = ses.(SES).SendRaw(context.Background(), data)
 	require.NoError(t, err)
 }
 
@@ -35,18 +36,18 @@ func TestSendRaw(t *testing.T) {
 func TestSendSES(t *testing.T) {
 	t.Skip("only for use in local environment if configured with credentials")
 
-	service, err := NewSES("me@example.com")
+	service, err := NewSES(SESConfig{SandboxEmail: "me@example.com"})
 	require.NoError(t, err)
 
 	params := message.Params{
 		Template: message.Welcome,
 		From:     message.NewAddress("name", "from@example.com"),
-		To:       message.NewAddress("name", "to@example.com"),
+		To:       []message.Address{message.NewAddress("name", "to@example.com")},
 		Fields:   map[string]any{},
 		Images:   map[string]string{},
 	}
 	msg, _ := message.New(params)
 
-	err = service.Send(context.Background(), msg)
+	_, err = service.Send(context.Background(), msg)
 	require.NoError(t, err)
 }
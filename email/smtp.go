@@ -0,0 +1,281 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+const (
+	SMTPStartTLS    = "starttls" // upgrade a plain connection with the STARTTLS command, which must be supported
+	SMTPImplicitTLS = "tls"      // connect using TLS, usually on port 465
+	SMTPNoTLS       = "none"     // never use TLS, only for a relay on a trusted network
+
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+// SMTPConfig stores the configuration parameters of an SMTP relay
+type SMTPConfig struct {
+	Host string
+	Port int
+
+	// TLSMode is SMTPStartTLS, SMTPImplicitTLS or SMTPNoTLS. The default is SMTPStartTLS.
+	TLSMode string
+
+	// TLSConfig, if not nil, is used instead of the default TLS configuration for Host
+	TLSConfig *tls.Config
+
+	// Username and Password are not sent unless both are given. AuthMechanism is SMTPAuthPlain (the default) or
+	// SMTPAuthLogin. Credentials are only sent over TLS, or to a server on localhost.
+	Username      string
+	Password      string
+	AuthMechanism string
+
+	// Timeout limits the time to connect and to send a message. The default is 30 seconds.
+	Timeout time.Duration
+
+	SandboxEmail string
+
+	// Assets is the file system of the message images and attachment files. The default is the embedded public assets.
+	Assets fs.FS
+
+	// Clock returns the time used for the Date header of messages. The default is time.Now.
+	Clock func() time.Time
+}
+
+// SMTP sends email through an SMTP relay. Each message uses a new connection.
+type SMTP struct {
+	config SMTPConfig
+}
+
+// NewSMTP returns an SMTP service provider for the Service interface
+func NewSMTP(config SMTPConfig) (Service, error) {
+	if config.Host == "" {
+		return nil, errors.New("SMTP host is required")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.TLSMode == "" {
+		config.TLSMode = SMTPStartTLS
+	}
+	if config.AuthMechanism == "" {
+		config.AuthMechanism = SMTPAuthPlain
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+	config.Assets = defaultAssets(config.Assets)
+	switch config.TLSMode {
+	case SMTPStartTLS, SMTPImplicitTLS, SMTPNoTLS:
+	default:
+		return nil, fmt.Errorf("invalid SMTP TLS mode %q", config.TLSMode)
+	}
+	switch config.AuthMechanism {
+	case SMTPAuthPlain, SMTPAuthLogin:
+	default:
+		return nil, fmt.Errorf("invalid SMTP auth mechanism %q", config.AuthMechanism)
+	}
+	return SMTP{config: config}, nil
+}
+
+// Send a message, and return the server's reply to the message data, which usually includes its queue ID
+func (s SMTP) Send(ctx context.Context, msg message.Message) (string, error) {
+	if s.config.SandboxEmail != "" {
+		msg = msg.Sandboxed(s.config.SandboxEmail)
+	}
+	to := msg.To()
+	log.WithFields(log.Fields{"to": to, "subject": msg.Subject()}).Debug("sending message using SMTP")
+
+	var recipients []string
+	for _, r := range msg.Recipients() {
+		address, err := mail.ParseAddress(r.String())
+		if err != nil {
+			return "", fmt.Errorf("invalid recipient address %q: %w", r.String(), err)
+		}
+		recipients = append(recipients, address.Address)
+	}
+	if len(recipients) == 0 {
+		return "", errors.New("message has no recipients")
+	}
+	fromAddress, err := mail.ParseAddress(msg.From())
+	if err != nil {
+		return "", fmt.Errorf("invalid sender address %q: %w", msg.From(), err)
+	}
+
+	reply, err := s.send(ctx, fromAddress.Address, recipients, func(w io.Writer) error {
+		return writeMIME(w, msg, s.config.Assets, s.config.Clock())
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send using SMTP: %w", err)
+	}
+
+	log.WithFields(log.Fields{"to": to, "reply": reply}).Info("sent message using SMTP")
+	return reply, nil
+}
+
+// send delivers a message to its recipients in a single SMTP session, streaming the raw message written by
+// writeMessage. The message is not sent if any recipient is rejected, or if writeMessage fails.
+func (s SMTP) send(ctx context.Context, from string, to []string, writeMessage func(io.Writer) error) (string, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		return "", fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if s.config.TLSMode == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return "", errors.New("server does not support STARTTLS")
+		}
+		if err = client.StartTLS(s.tlsConfig()); err != nil {
+			return "", fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if s.config.Username != "" && s.config.Password != "" {
+		if err = client.Auth(s.auth()); err != nil {
+			return "", fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return "", fmt.Errorf("sender rejected: %w", err)
+	}
+	for _, recipient := range to {
+		if err = client.Rcpt(recipient); err != nil {
+			return "", fmt.Errorf("recipient %s rejected: %w", recipient, err)
+		}
+	}
+	reply, err := sendData(client, writeMessage)
+	if err != nil {
+		return "", err
+	}
+	if err = client.Quit(); err != nil {
+		log.Warningf("failed to end SMTP session after sending: %s", err)
+	}
+	return reply, nil
+}
+
+func (s SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	if s.config.TLSMode == SMTPImplicitTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}
+		conn, err := tlsDialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s using TLS: %w", addr, err)
+		}
+		return conn, nil
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+func (s SMTP) tlsConfig() *tls.Config {
+	if s.config.TLSConfig != nil {
+		return s.config.TLSConfig
+	}
+	return &tls.Config{ServerName: s.config.Host, MinVersion: tls.VersionTLS12}
+}
+
+func (s SMTP) auth() smtp.Auth {
+	if s.config.AuthMechanism == SMTPAuthLogin {
+		return &loginAuth{username: s.config.Username, password: s.config.Password, host: s.config.Host}
+	}
+	return smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+}
+
+// sendData sends the DATA command and the message. Unlike smtp.Client.Data, it returns the text of the server's final
+// reply, which is used as the message ID. If writeMessage fails, the data is not terminated, so the server discards the
+// message when the connection is closed.
+func sendData(client *smtp.Client, writeMessage func(io.Writer) error) (string, error) {
+	id, err := client.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	client.Text.StartResponse(id)
+	_, _, err = client.Text.ReadResponse(354)
+	client.Text.EndResponse(id)
+	if err != nil {
+		return "", fmt.Errorf("message data rejected: %w", err)
+	}
+
+	w := client.Text.DotWriter()
+	if err = writeMessage(w); err != nil {
+		return "", fmt.Errorf("failed to write message data: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return "", fmt.Errorf("failed to write message data: %w", err)
+	}
+	_, reply, err := client.Text.ReadResponse(250)
+	if err != nil {
+		return "", fmt.Errorf("message not accepted: %w", err)
+	}
+	return reply, nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp does not provide. Like smtp.PlainAuth, it
+// refuses to send the credentials over an unencrypted connection, except to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,409 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/go-htmx-app/email/message"
+	"github.com/briskt/go-htmx-app/log"
+)
+
+func init() {
+	log.Init()
+}
+
+// testSMTPServer is a minimal SMTP server for testing the SMTP service. It supports STARTTLS, implicit TLS and the
+// PLAIN and LOGIN authentication mechanisms, and records the messages it receives.
+type testSMTPServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	noStartTLS  bool
+	noGreeting  bool
+	username    string
+	password    string
+
+	mu       sync.Mutex
+	messages []testSMTPMessage
+}
+
+type testSMTPMessage struct {
+	From, Data string
+	To         []string
+	AuthUser   string
+	TLS        bool
+}
+
+func newTestSMTPServer(t *testing.T, configure func(*testSMTPServer)) *testSMTPServer {
+	s := &testSMTPServer{tlsConfig: testTLSConfig(t), username: "user", password: "secret"}
+	if configure != nil {
+		configure(s)
+	}
+
+	var err error
+	if s.implicitTLS {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testSMTPServer) received() []testSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testSMTPMessage{}, s.messages...)
+}
+
+func (s *testSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	if s.noGreeting {
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+		return
+	}
+
+	_, isTLS := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...any) { _ = text.PrintfLine(format, args...) }
+	reply("220 test.example.com ESMTP")
+
+	var msg testSMTPMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-test.example.com")
+			if !isTLS && !s.noStartTLS {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, isTLS = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			user, ok := s.authenticate(text, arg)
+			if !ok {
+				reply("535 authentication failed")
+				continue
+			}
+			msg.AuthUser = user
+			reply("235 authenticated")
+		case "MAIL":
+			msg.From = strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">")
+			reply("250 ok")
+		case "RCPT":
+			msg.To = append(msg.To, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			msg.TLS = isTLS
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			n := len(s.messages)
+			s.mu.Unlock()
+			reply("250 ok queued as TEST%d", n)
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *testSMTPServer) authenticate(text *textproto.Conn, arg string) (string, bool) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var user, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		decoded, err := base64.StdEncoding.DecodeString(initial)
+		if err != nil {
+			return "", false
+		}
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) != 3 {
+			return "", false
+		}
+		user, password = parts[1], parts[2]
+	case "LOGIN":
+		var ok bool
+		if user, ok = challenge(text, "Username:"); !ok {
+			return "", false
+		}
+		if password, ok = challenge(text, "Password:"); !ok {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return user, user == s.username && password == s.password
+}
+
+func challenge(text *textproto.Conn, prompt string) (string, bool) {
+	_ = text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+	line, err := text.ReadLine()
+	if err != nil {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(line)
+	return string(decoded), err == nil
+}
+
+// testTLSConfig returns a TLS configuration with a self-signed certificate for 127.0.0.1
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// clientTLSConfig returns a client TLS configuration that trusts the server's self-signed certificate
+func (s *testSMTPServer) clientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	cert, _ := x509.ParseCertificate(s.tlsConfig.Certificates[0].Certificate[0])
+	pool.AddCert(cert)
+	return &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+func newTestMessage() message.Message {
+	return message.NewRendered(
+		message.NewAddress("From Name", "from@example.com"),
+		message.NewAddress("To Name", "to@example.com"),
+		"test subject",
+		`<h4>body</h4><p>End of body</p>`,
+		nil,
+	)
+}
+
+func TestSMTP_Send(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    func(*testSMTPServer)
+		config    SMTPConfig
+		wantTLS   bool
+		wantUser  string
+		wantError string
+	}{
+		{
+			name:     "STARTTLS with PLAIN auth",
+			config:   SMTPConfig{TLSMode: SMTPStartTLS, Username: "user", Password: "secret"},
+			wantTLS:  true,
+			wantUser: "user",
+		},
+		{
+			name:     "implicit TLS with LOGIN auth",
+			server:   func(s *testSMTPServer) { s.implicitTLS = true },
+			config:   SMTPConfig{TLSMode: SMTPImplicitTLS, Username: "user", Password: "secret", AuthMechanism: SMTPAuthLogin},
+			wantTLS:  true,
+			wantUser: "user",
+		},
+		{
+			name:   "no TLS without auth",
+			config: SMTPConfig{TLSMode: SMTPNoTLS},
+		},
+		{
+			name:      "STARTTLS not offered",
+			server:    func(s *testSMTPServer) { s.noStartTLS = true },
+			config:    SMTPConfig{TLSMode: SMTPStartTLS},
+			wantError: "server does not support STARTTLS",
+		},
+		{
+			name:      "wrong password",
+			config:    SMTPConfig{TLSMode: SMTPStartTLS, Username: "user", Password: "wrong"},
+			wantError: "authentication failed",
+		},
+		{
+			name:      "timeout",
+			server:    func(s *testSMTPServer) { s.noGreeting = true },
+			config:    SMTPConfig{TLSMode: SMTPNoTLS, Timeout: 100 * time.Millisecond},
+			wantError: "i/o timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestSMTPServer(t, tt.server)
+			config := tt.config
+			config.Host = "127.0.0.1"
+			config.Port = server.port()
+			config.TLSConfig = server.clientTLSConfig()
+
+			svc, err := NewSMTP(config)
+			require.NoError(t, err)
+
+			id, err := svc.Send(context.Background(), newTestMessage())
+			if tt.wantError != "" {
+				require.ErrorContains(t, err, tt.wantError)
+				require.Empty(t, server.received())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "ok queued as TEST1", id)
+
+			received := server.received()
+			require.Len(t, received, 1)
+			require.Equal(t, "from@example.com", received[0].From)
+			require.Equal(t, []string{"to@example.com"}, received[0].To)
+			require.Equal(t, tt.wantTLS, received[0].TLS)
+			require.Equal(t, tt.wantUser, received[0].AuthUser)
+			require.Contains(t, received[0].Data, "Subject: test subject")
+			require.Contains(t, received[0].Data, "<h4>body</h4>")
+		})
+	}
+}
+
+func TestSMTP_SandboxEmail(t *testing.T) {
+	server := newTestSMTPServer(t, nil)
+	svc, err := NewSMTP(SMTPConfig{
+		Host:         "127.0.0.1",
+		Port:         server.port(),
+		TLSConfig:    server.clientTLSConfig(),
+		SandboxEmail: "sandbox@example.com",
+	})
+	require.NoError(t, err)
+
+	_, err = svc.Send(context.Background(), newTestMessage())
+	require.NoError(t, err)
+
+	received := server.received()
+	require.Len(t, received, 1)
+	require.Equal(t, []string{"sandbox@example.com"}, received[0].To)
+	require.Contains(t, received[0].Data, "To: sandbox@example.com")
+}
+
+func TestSMTP_Recipients(t *testing.T) {
+	server := newTestSMTPServer(t, nil)
+	svc, err := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: server.port(), TLSConfig: server.clientTLSConfig()})
+	require.NoError(t, err)
+
+	msg, err := message.New(message.Params{
+		Template: message.Welcome,
+		From:     message.NewAddress("From Name", "from@example.com"),
+		To:       []message.Address{message.NewAddress("One", "one@example.com"), message.NewAddress("", "two@example.com")},
+		CC:       []message.Address{message.NewAddress("Copy", "cc@example.com")},
+		BCC:      []message.Address{message.NewAddress("Hidden", "bcc@example.com")},
+		ReplyTo:  message.NewAddress("Support", "support@example.com"),
+		Fields:   message.Fields{"AppName": "Test", "DisplayName": "One", "Username": "one"},
+	})
+	require.NoError(t, err)
+
+	_, err = svc.Send(context.Background(), msg)
+	require.NoError(t, err)
+
+	received := server.received()
+	require.Len(t, received, 1)
+	require.Equal(t, []string{"one@example.com", "two@example.com", "cc@example.com", "bcc@example.com"}, received[0].To)
+	require.Contains(t, received[0].Data, `To: "One" <one@example.com>, two@example.com`)
+	require.Contains(t, received[0].Data, `Cc: "Copy" <cc@example.com>`)
+	require.Contains(t, received[0].Data, `Reply-To: "Support" <support@example.com>`)
+	require.NotContains(t, received[0].Data, "bcc@example.com")
+}
+
+func TestSMTP_Assets(t *testing.T) {
+	server := newTestSMTPServer(t, nil)
+	svc, err := NewSMTP(SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      server.port(),
+		TLSConfig: server.clientTLSConfig(),
+		Assets:    fstest.MapFS{"brand/logo.svg": {Data: mustReadFile(t, "logo_test.svg")}},
+	})
+	require.NoError(t, err)
+
+	newMessage := func(logo string) message.Message {
+		return message.NewRendered(
+			message.NewAddress("", "from@example.com"),
+			message.NewAddress("", "to@example.com"),
+			"test subject",
+			`<h4>body</h4><img src="cid:logo">`,
+			map[string]string{"logo": logo},
+		)
+	}
+
+	_, err = svc.Send(context.Background(), newMessage("brand/logo.svg"))
+	require.NoError(t, err)
+
+	received := server.received()
+	require.Len(t, received, 1)
+	parts, err := ParseMIME([]byte(received[0].Data))
+	require.NoError(t, err)
+	require.Equal(t, mustReadFile(t, "logo_test.svg"), parts.Images["logo"].Data)
+
+	_, err = svc.Send(context.Background(), newMessage("brand/missing.svg"))
+	require.ErrorContains(t, err, "brand/missing.svg")
+	require.Len(t, server.received(), 1, "a message with a missing image should not be delivered")
+}
+
+func TestNewSMTP(t *testing.T) {
+	_, err := NewSMTP(SMTPConfig{})
+	require.ErrorContains(t, err, "host is required")
+
+	_, err = NewSMTP(SMTPConfig{Host: "smtp.example.com", TLSMode: "ssl"})
+	require.ErrorContains(t, err, "invalid SMTP TLS mode")
+
+	_, err = NewSMTP(SMTPConfig{Host: "smtp.example.com", AuthMechanism: "cram-md5"})
+	require.ErrorContains(t, err, "invalid SMTP auth mechanism")
+
+	svc, err := NewSMTP(SMTPConfig{Host: "smtp.example.com"})
+	require.NoError(t, err)
+	config := svc.(SMTP).config
+	require.Equal(t, 587, config.Port)
+	require.Equal(t, SMTPStartTLS, config.TLSMode)
+	require.Equal(t, SMTPAuthPlain, config.AuthMechanism)
+	require.Equal(t, 30*time.Second, config.Timeout)
+}
@@ -1,3 +1,25 @@
+// Package templates holds the email message templates.
+//
+// Each message template is a file named <name>.gohtml that defines a "body" template, which is rendered inside
+// base.gohtml. The file starts with a front matter block that declares the message:
+//
+//	---
+//	subject: Your {{ .AppName }} email address was changed
+//	fields: NewEmail ConfirmURL? ...
+//	images: cid=assets/img/file.png ...
+//	---
+//
+// The subject is a text/template. The fields are the names of the fields the template uses, in addition to the fields
+// declared by base.gohtml; a field is required unless its name ends in "?". The images are the inline images added to
+// every message, by content ID, read from the public file system.
+//
+// Each template also has a <name>.sample.json file with example values of its fields, used to validate the template
+// at startup and to preview it.
+//
+// A template is translated to another locale in a file named <name>.<locale>.gohtml, such as welcome.fr.gohtml, which
+// declares only its subject; a message in a locale without a translation uses the default (English) template. The
+// strings in base.gohtml are translated with {{ t "..." }}, from the catalog of the locale in catalog/<locale>.json.
+// Each locale of a translated template must have a catalog.
 package templates
 
 import (
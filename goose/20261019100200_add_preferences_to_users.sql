@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "public"."users"
+    ADD COLUMN "time_zone" varchar(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN "language" varchar(8) NOT NULL DEFAULT 'en',
+    ADD COLUMN "email_notifications" boolean NOT NULL DEFAULT TRUE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "public"."users"
+    DROP COLUMN "time_zone",
+    DROP COLUMN "language",
+    DROP COLUMN "email_notifications";
+-- +goose StatementEnd
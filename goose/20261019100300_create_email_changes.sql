@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE email_changes (
+    id SERIAL PRIMARY KEY,
+    user_id int NOT NULL,
+    new_email character varying(255) NOT NULL,
+    hash character varying(255) NOT NULL UNIQUE,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT email_changes_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE ON UPDATE NO ACTION
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE email_changes;
+-- +goose StatementEnd
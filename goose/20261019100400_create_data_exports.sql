@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE data_exports (
+    id SERIAL PRIMARY KEY,
+    user_id int NOT NULL,
+    requested_by int NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    hash character varying(255) DEFAULT NULL UNIQUE,
+    archive bytea DEFAULT NULL,
+    expires_at timestamp DEFAULT NULL,
+    created_at timestamp NOT NULL,
+    completed_at timestamp DEFAULT NULL,
+    CONSTRAINT data_exports_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE ON UPDATE NO ACTION,
+    CONSTRAINT data_exports_requested_by FOREIGN KEY (requested_by)
+        REFERENCES users(id) ON DELETE CASCADE ON UPDATE NO ACTION
+);
+CREATE INDEX data_exports_status ON data_exports (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE data_exports;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "public"."users" ADD COLUMN "deleted_at" timestamp DEFAULT NULL;
+CREATE INDEX users_deleted_at ON "public"."users" (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE "public"."email_logs"
+    DROP CONSTRAINT email_logs_users_id_fk,
+    ADD CONSTRAINT email_logs_users_id_fk FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "public"."email_logs"
+    DROP CONSTRAINT email_logs_users_id_fk,
+    ADD CONSTRAINT email_logs_users_id_fk FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE SET NULL;
+
+DROP INDEX users_deleted_at;
+ALTER TABLE "public"."users" DROP COLUMN "deleted_at";
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id int DEFAULT NULL,
+    impersonator_id int DEFAULT NULL,
+    action character varying(64) NOT NULL,
+    target_type character varying(32) NOT NULL,
+    target_id character varying(64) NOT NULL,
+    before jsonb NOT NULL DEFAULT '{}',
+    after jsonb NOT NULL DEFAULT '{}',
+    ip character varying(64) NOT NULL DEFAULT '',
+    request_id character varying(64) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    CONSTRAINT audit_events_actor_id FOREIGN KEY (actor_id)
+        REFERENCES users(id) ON DELETE SET NULL ON UPDATE NO ACTION,
+    CONSTRAINT audit_events_impersonator_id FOREIGN KEY (impersonator_id)
+        REFERENCES users(id) ON DELETE SET NULL ON UPDATE NO ACTION
+);
+CREATE INDEX audit_events_created_at ON audit_events (created_at);
+CREATE INDEX audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX audit_events_actor_id ON audit_events (actor_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_full_name_trgm ON "public"."users" USING gin ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX users_display_name_trgm ON "public"."users" USING gin (display_name gin_trgm_ops);
+CREATE INDEX users_username_trgm ON "public"."users" USING gin (username gin_trgm_ops);
+CREATE INDEX users_email_trgm ON "public"."users" USING gin (email gin_trgm_ops);
+CREATE INDEX users_employee_id_trgm ON "public"."users" USING gin (employee_id gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_employee_id_trgm;
+DROP INDEX users_email_trgm;
+DROP INDEX users_username_trgm;
+DROP INDEX users_display_name_trgm;
+DROP INDEX users_full_name_trgm;
+-- +goose StatementEnd
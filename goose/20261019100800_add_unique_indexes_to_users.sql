@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Stop with a list of the duplicates, if any, since they must be resolved by hand before the indexes can be added.
+-- The same list is shown by the "users duplicates" command, which can be run before upgrading.
+DO $$
+DECLARE
+    duplicates text;
+BEGIN
+    SELECT string_agg(format('%s %L: user IDs %s', field, value, user_ids), E'\n' ORDER BY field, value)
+    INTO duplicates
+    FROM (
+        SELECT 'username' AS field, lower(trim(username)) AS value, string_agg(id::text, ', ' ORDER BY id) AS user_ids
+        FROM users GROUP BY lower(trim(username)) HAVING count(*) > 1
+        UNION ALL
+        SELECT 'email', lower(trim(email)), string_agg(id::text, ', ' ORDER BY id)
+        FROM users GROUP BY lower(trim(email)) HAVING count(*) > 1
+        UNION ALL
+        SELECT 'employee_id', trim(employee_id), string_agg(id::text, ', ' ORDER BY id)
+        FROM users GROUP BY trim(employee_id) HAVING count(*) > 1
+    ) AS d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION E'users have duplicate values, which must be resolved before upgrading:\n%', duplicates;
+    END IF;
+END
+$$;
+
+UPDATE "public"."users"
+SET username = lower(trim(username)), email = lower(trim(email)), employee_id = trim(employee_id)
+WHERE username <> lower(trim(username)) OR email <> lower(trim(email)) OR employee_id <> trim(employee_id);
+
+CREATE UNIQUE INDEX users_username_unique ON "public"."users" (lower(username));
+CREATE UNIQUE INDEX users_email_unique ON "public"."users" (lower(email));
+CREATE UNIQUE INDEX users_employee_id_unique ON "public"."users" (employee_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_employee_id_unique;
+DROP INDEX users_email_unique;
+DROP INDEX users_username_unique;
+-- +goose StatementEnd
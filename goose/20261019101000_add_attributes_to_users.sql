@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "public"."users" ADD COLUMN "attributes" jsonb NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX users_attributes_index ON "public"."users" USING GIN ("attributes" jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_attributes_index;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE "public"."users" DROP COLUMN "attributes";
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE email_outbox (
+    id SERIAL PRIMARY KEY,
+    user_id int NOT NULL,
+    message_type character varying(255) NOT NULL,
+    from_name character varying(255) NOT NULL DEFAULT '',
+    from_address character varying(255) NOT NULL,
+    to_name character varying(255) NOT NULL DEFAULT '',
+    to_address character varying(255) NOT NULL,
+    subject text NOT NULL,
+    body text NOT NULL,
+    images jsonb NOT NULL DEFAULT '{}',
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT email_outbox_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE ON UPDATE NO ACTION
+);
+CREATE INDEX email_outbox_pending ON email_outbox (next_attempt_at) WHERE status = 'pending';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE email_logs ADD COLUMN provider_message_id character varying(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE email_logs DROP COLUMN provider_message_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE email_outbox;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "public"."email_outbox"
+    ADD COLUMN "to_addresses" jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN "cc" jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN "bcc" jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN "reply_to_name" character varying(255) NOT NULL DEFAULT '',
+    ADD COLUMN "reply_to_address" character varying(255) NOT NULL DEFAULT '',
+    ADD COLUMN "attachments" jsonb NOT NULL DEFAULT '[]';
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE "public"."email_outbox"
+SET "to_addresses" = jsonb_build_array(jsonb_build_object('name', "to_name", 'address', "to_address"));
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE "public"."email_outbox"
+    DROP COLUMN "to_name",
+    DROP COLUMN "to_address";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "public"."email_outbox"
+    ADD COLUMN "to_name" character varying(255) NOT NULL DEFAULT '',
+    ADD COLUMN "to_address" character varying(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE "public"."email_outbox"
+SET "to_name" = COALESCE("to_addresses"->0->>'name', ''),
+    "to_address" = COALESCE("to_addresses"->0->>'address', '');
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE "public"."email_outbox"
+    DROP COLUMN "to_addresses",
+    DROP COLUMN "cc",
+    DROP COLUMN "bcc",
+    DROP COLUMN "reply_to_name",
+    DROP COLUMN "reply_to_address",
+    DROP COLUMN "attachments";
+-- +goose StatementEnd
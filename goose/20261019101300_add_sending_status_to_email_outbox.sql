@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+DROP INDEX email_outbox_pending;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX email_outbox_due ON email_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE email_outbox SET status = 'pending' WHERE status = 'sending';
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX email_outbox_due;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX email_outbox_pending ON email_outbox (next_attempt_at) WHERE status = 'pending';
+-- +goose StatementEnd
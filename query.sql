@@ -24,6 +24,117 @@ VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;
 DELETE FROM tokens
 WHERE id = $1;
 
+-- name: DeleteAccessTokensByUser :exec
+DELETE FROM tokens
+WHERE user_id = $1;
+
+-- name: ListAccessTokensByUser :many
+SELECT * FROM tokens
+WHERE user_id = $1
+ORDER BY created_utc;
+
+
+--
+-- EmailChange Table
+--
+
+-- name: CreateEmailChange :one
+INSERT INTO email_changes
+(user_id,
+ new_email,
+ hash,
+ expires_at,
+ created_at)
+VALUES ($1, $2, $3, $4, NOW()) RETURNING *;
+
+-- name: FindEmailChangeByHash :one
+SELECT * FROM email_changes
+WHERE hash = $1 LIMIT 1;
+
+-- name: DeleteEmailChangesByUser :exec
+DELETE FROM email_changes
+WHERE user_id = $1;
+
+
+--
+-- AuditEvent Table
+--
+
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events
+(actor_id,
+ impersonator_id,
+ action,
+ target_type,
+ target_id,
+ before,
+ after,
+ ip,
+ request_id,
+ created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW());
+
+-- name: ListAuditEvents :many
+SELECT sqlc.embed(audit_events),
+    COALESCE(actors.username, '')::text AS actor_username,
+    COALESCE(impersonators.username, '')::text AS impersonator_username
+FROM audit_events
+    LEFT JOIN users actors ON actors.id = audit_events.actor_id
+    LEFT JOIN users impersonators ON impersonators.id = audit_events.impersonator_id
+WHERE (@action::text = '' OR audit_events.action = @action::text)
+    AND (@actor::text = '' OR lower(actors.username) = lower(@actor::text))
+    AND (@target_type::text = '' OR audit_events.target_type = @target_type::text)
+    AND (@target_id::text = '' OR audit_events.target_id = @target_id::text)
+    AND (sqlc.narg(since)::timestamp IS NULL OR audit_events.created_at >= sqlc.narg(since)::timestamp)
+    AND (sqlc.narg(until)::timestamp IS NULL OR audit_events.created_at < sqlc.narg(until)::timestamp)
+ORDER BY audit_events.created_at DESC, audit_events.id DESC
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: CountAuditEvents :one
+SELECT count(*)
+FROM audit_events
+    LEFT JOIN users actors ON actors.id = audit_events.actor_id
+WHERE (@action::text = '' OR audit_events.action = @action::text)
+    AND (@actor::text = '' OR lower(actors.username) = lower(@actor::text))
+    AND (@target_type::text = '' OR audit_events.target_type = @target_type::text)
+    AND (@target_id::text = '' OR audit_events.target_id = @target_id::text)
+    AND (sqlc.narg(since)::timestamp IS NULL OR audit_events.created_at >= sqlc.narg(since)::timestamp)
+    AND (sqlc.narg(until)::timestamp IS NULL OR audit_events.created_at < sqlc.narg(until)::timestamp);
+
+
+--
+-- DataExport Table
+--
+
+-- name: CreateDataExport :one
+INSERT INTO data_exports
+(user_id, requested_by, status, created_at)
+VALUES ($1, $2, 'pending', NOW()) RETURNING *;
+
+-- name: FindPendingDataExports :many
+SELECT * FROM data_exports
+WHERE status = 'pending'
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = $2,
+    hash = $3,
+    archive = $4,
+    expires_at = $5,
+    completed_at = NOW()
+WHERE id = $1;
+
+-- name: FindDataExportByHash :one
+SELECT * FROM data_exports
+WHERE hash = $1 LIMIT 1;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at < $1;
+
 
 --
 -- EmailLog Table
@@ -31,15 +142,72 @@ WHERE id = $1;
 
 -- name: CreateEmailLog :exec
 INSERT INTO email_logs
-(user_id, message_type, created_at)
-VALUES ($1, $2, NOW());
+(user_id, message_type, provider_message_id, created_at)
+VALUES ($1, $2, $3, NOW());
 
--- name: CountRecentEmails :one
-SELECT count(*)
-FROM email_logs
+-- name: ListEmailLogsByUser :many
+SELECT * FROM email_logs
 WHERE user_id = $1
-    AND message_type = $2
-    AND created_at >= NOW() - INTERVAL '31 days';
+ORDER BY created_at;
+
+-- name: CreateOutboxEmail :one
+INSERT INTO email_outbox
+(user_id, message_type, from_name, from_address, to_addresses, cc, bcc, reply_to_name, reply_to_address, subject,
+ body, images, attachments, next_attempt_at, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW()) RETURNING *;
+
+-- name: ClaimDueOutboxEmails :many
+-- Marks the messages that are due to be sent as being sent until the lease expires, skipping those locked by another
+-- worker. A message whose lease expired before its outcome was recorded is claimed again.
+UPDATE email_outbox
+SET status = 'sending',
+    next_attempt_at = @lease_until::timestamp
+WHERE id IN (
+    SELECT id FROM email_outbox
+    WHERE status IN ('pending', 'sending')
+        AND next_attempt_at <= @now::timestamp
+    ORDER BY next_attempt_at, id
+    LIMIT @row_limit
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RetryOutboxEmail :exec
+UPDATE email_outbox
+SET status = 'pending',
+    attempts = $2,
+    last_error = $3,
+    next_attempt_at = $4
+WHERE id = $1;
+
+-- name: KillOutboxEmail :exec
+UPDATE email_outbox
+SET status = 'dead',
+    attempts = $2,
+    last_error = $3
+WHERE id = $1;
+
+-- name: DeleteOutboxEmail :exec
+DELETE FROM email_outbox WHERE id = $1;
+
+-- name: ListDeadOutboxEmails :many
+SELECT * FROM email_outbox
+WHERE status = 'dead'
+ORDER BY id;
+
+-- name: CountRecentEmails :one
+-- Counts the messages sent to a user recently, and those still waiting in the outbox to be sent. The outbox holds the
+-- template name, which the email log stores with dashes.
+SELECT ((SELECT count(*)
+         FROM email_logs
+         WHERE email_logs.user_id = @user_id
+             AND email_logs.message_type = @message_type
+             AND email_logs.created_at >= NOW() - INTERVAL '31 days')
+      + (SELECT count(*)
+         FROM email_outbox
+         WHERE email_outbox.user_id = @user_id
+             AND replace(email_outbox.message_type, '_', '-') = @message_type
+             AND email_outbox.status <> 'dead'))::bigint AS count;
 
 
 --
@@ -49,25 +217,49 @@ WHERE user_id = $1
 -- name: GetUser :one
 SELECT *
 FROM users
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: GetUserIncludingDeleted :one
+SELECT *
+FROM users
 WHERE id = $1
 LIMIT 1;
 
 -- name: FindUserByEmployeeID :one
 SELECT *
 FROM users
+WHERE employee_id = $1 AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: FindUserByEmployeeIDIncludingDeleted :one
+SELECT *
+FROM users
 WHERE employee_id = $1
 LIMIT 1;
 
 -- name: FindUserByUsername :one
 SELECT *
 FROM users
-WHERE username = $1
+WHERE lower(username) = lower($1) AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: FindUserByUsernameIncludingDeleted :one
+SELECT *
+FROM users
+WHERE lower(username) = lower($1)
 LIMIT 1;
 
 -- name: FindUserByEmail :one
 SELECT *
 FROM users
-WHERE email = $1
+WHERE lower(email) = lower($1) AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: FindUserByEmailIncludingDeleted :one
+SELECT *
+FROM users
+WHERE lower(email) = lower($1)
 LIMIT 1;
 
 -- name: CreateUser :one
@@ -77,12 +269,120 @@ INSERT INTO users
 VALUES ($1, $2, $3, $4, $5, $6, TRUE, FALSE, NOW(), NOW(), NOW()) RETURNING *;
 
 -- name: ListActiveUnlockedUsers :many
-SELECT * FROM users WHERE active and NOT locked;
+SELECT * FROM users WHERE active and NOT locked AND deleted_at IS NULL;
+
+-- name: ListActiveUsers :many
+SELECT * FROM users WHERE active AND deleted_at IS NULL ORDER BY id;
+
+-- name: ListAdminUsers :many
+SELECT * FROM users WHERE admin AND active AND NOT locked AND deleted_at IS NULL ORDER BY id;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+WHERE (sqlc.narg(active)::boolean IS NULL OR active = sqlc.narg(active)::boolean)
+    AND (sqlc.narg(locked)::boolean IS NULL OR locked = sqlc.narg(locked)::boolean)
+    AND (deleted_at IS NOT NULL) = @deleted::boolean
+    AND (@search::text = ''
+        OR first_name ILIKE '%' || @search::text || '%'
+        OR last_name ILIKE '%' || @search::text || '%'
+        OR display_name ILIKE '%' || @search::text || '%'
+        OR username ILIKE '%' || @search::text || '%'
+        OR email ILIKE '%' || @search::text || '%'
+        OR employee_id ILIKE '%' || @search::text || '%')
+    AND attributes @> @attributes::jsonb
+ORDER BY
+    CASE WHEN @sort_by::text = 'name' AND NOT @sort_desc::boolean THEN last_name END,
+    CASE WHEN @sort_by::text = 'name' AND NOT @sort_desc::boolean THEN first_name END,
+    CASE WHEN @sort_by::text = 'name' AND @sort_desc::boolean THEN last_name END DESC,
+    CASE WHEN @sort_by::text = 'name' AND @sort_desc::boolean THEN first_name END DESC,
+    CASE WHEN @sort_by::text = 'username' AND NOT @sort_desc::boolean THEN username END,
+    CASE WHEN @sort_by::text = 'username' AND @sort_desc::boolean THEN username END DESC,
+    CASE WHEN @sort_by::text = 'email' AND NOT @sort_desc::boolean THEN email END,
+    CASE WHEN @sort_by::text = 'email' AND @sort_desc::boolean THEN email END DESC,
+    CASE WHEN @sort_by::text = 'employee_id' AND NOT @sort_desc::boolean THEN employee_id END,
+    CASE WHEN @sort_by::text = 'employee_id' AND @sort_desc::boolean THEN employee_id END DESC,
+    CASE WHEN @sort_by::text = 'last_login' AND NOT @sort_desc::boolean THEN last_login_at END,
+    CASE WHEN @sort_by::text = 'last_login' AND @sort_desc::boolean THEN last_login_at END DESC,
+    id
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: CountUsers :one
+SELECT count(*)
+FROM users
+WHERE (sqlc.narg(active)::boolean IS NULL OR active = sqlc.narg(active)::boolean)
+    AND (sqlc.narg(locked)::boolean IS NULL OR locked = sqlc.narg(locked)::boolean)
+    AND (deleted_at IS NOT NULL) = @deleted::boolean
+    AND (@search::text = ''
+        OR first_name ILIKE '%' || @search::text || '%'
+        OR last_name ILIKE '%' || @search::text || '%'
+        OR display_name ILIKE '%' || @search::text || '%'
+        OR username ILIKE '%' || @search::text || '%'
+        OR email ILIKE '%' || @search::text || '%'
+        OR employee_id ILIKE '%' || @search::text || '%')
+    AND attributes @> @attributes::jsonb;
+
+-- name: SearchUsers :many
+-- Ranks users by the trigram similarity of the search text to any of their names, username, email or employee ID,
+-- which finds partial and misspelled values. Word similarity is compared to the threshold given, rather than with the
+-- <% operator, whose threshold is a server setting.
+SELECT users.*
+FROM users,
+    LATERAL (SELECT greatest(
+        word_similarity(@search::text, first_name || ' ' || last_name),
+        word_similarity(@search::text, display_name),
+        word_similarity(@search::text, username),
+        word_similarity(@search::text, email),
+        word_similarity(@search::text, employee_id)) AS word_score) AS scores
+WHERE deleted_at IS NULL
+    AND (scores.word_score >= @threshold::real
+        OR (first_name || ' ' || last_name) % @search::text
+        OR email % @search::text)
+ORDER BY greatest(
+        scores.word_score,
+        similarity(first_name || ' ' || last_name, @search::text),
+        similarity(email, @search::text)) DESC,
+    last_name, first_name, id
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: FindDuplicateUsers :many
+-- Lists the values of username, email and employee_id that are shared by more than one user, ignoring case and
+-- surrounding spaces, along with the IDs of the users that share each.
+SELECT field::text, value::text, user_ids::text
+FROM (
+    SELECT 'username' AS field, lower(trim(username)) AS value, string_agg(id::text, ', ' ORDER BY id) AS user_ids
+    FROM users GROUP BY lower(trim(username)) HAVING count(*) > 1
+    UNION ALL
+    SELECT 'email', lower(trim(email)), string_agg(id::text, ', ' ORDER BY id)
+    FROM users GROUP BY lower(trim(email)) HAVING count(*) > 1
+    UNION ALL
+    SELECT 'employee_id', trim(employee_id), string_agg(id::text, ', ' ORDER BY id)
+    FROM users GROUP BY trim(employee_id) HAVING count(*) > 1
+) AS duplicates
+ORDER BY field, value;
+
+-- name: FindUsersToWarn :many
+SELECT *
+FROM users
+WHERE active AND NOT locked AND deleted_at IS NULL AND last_login_at < $1
+ORDER BY id;
+
+-- name: FindUsersToDeactivate :many
+SELECT users.*
+FROM users
+WHERE active AND deleted_at IS NULL AND last_login_at < @inactive_since
+    AND EXISTS (SELECT 1
+        FROM email_logs
+        WHERE email_logs.user_id = users.id
+            AND email_logs.message_type = @message_type
+            AND email_logs.created_at > users.last_login_at
+            AND email_logs.created_at < @warned_before)
+ORDER BY id;
 
 -- name: FindUsersToPurge :many
 SELECT *
 FROM users
-WHERE NOT active AND updated_at < $1;
+WHERE (NOT active OR deleted_at IS NOT NULL) AND updated_at < $1;
 
 -- name: UpdateUserLastLoggedIn :exec
 UPDATE users
@@ -90,7 +390,8 @@ SET last_login_at   = NOW(),
     updated_at = NOW()
 WHERE id = $1;
 
--- name: UpdateUser :exec
+-- name: UpdateUser :execrows
+-- Saves the user only if it has not changed since it was read, as shown by the version
 UPDATE users
 SET employee_id          = $2,
     first_name           = $3,
@@ -100,7 +401,27 @@ SET employee_id          = $2,
     email                = $7,
     active               = $8,
     locked               = $9,
+    admin                = $10,
+    time_zone            = $11,
+    language             = $12,
+    email_notifications  = $13,
+    attributes           = $15,
+    version              = version + 1,
     updated_at           = NOW()
+WHERE id = $1 AND version = $14;
+
+-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(),
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: RestoreUser :exec
+UPDATE users
+SET deleted_at = NULL,
+    version = version + 1,
+    updated_at = NOW()
 WHERE id = $1;
 
 -- name: DeleteUser :exec
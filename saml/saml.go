@@ -99,26 +99,32 @@ func New(config Config) (*Provider, error) {
 	return p, nil
 }
 
-func (p *Provider) GetUser(c echo.Context) (string, error) {
+// GetUser validates the SAML response of a login and returns the employee number of the user, along with the first
+// value of each attribute in the assertion
+func (p *Provider) GetUser(c echo.Context) (string, map[string]string, error) {
 	samlResp := c.FormValue("SAMLResponse")
 	if samlResp == "" {
-		return "", fmt.Errorf("no SAML response provided in query")
+		return "", nil, fmt.Errorf("no SAML response provided in query")
 	}
 
 	info, err := p.RetrieveAssertionInfo(samlResp)
 	if err != nil {
-		return "", fmt.Errorf("invalid SAML assertion: %s", err)
+		return "", nil, fmt.Errorf("invalid SAML assertion: %s", err)
 	}
 
 	if info.WarningInfo.InvalidTime {
-		return "", fmt.Errorf("invalid SAML assertion time")
+		return "", nil, fmt.Errorf("invalid SAML assertion time")
 	}
 
 	if info.WarningInfo.NotInAudience {
-		return "", fmt.Errorf("invalid SAML assertion, not in audience")
+		return "", nil, fmt.Errorf("invalid SAML assertion, not in audience")
 	}
 	attributes := info.Assertions[0].AttributeStatement.Attributes
-	return getFirstValue("employeeNumber", attributes), nil
+	values := make(map[string]string, len(attributes))
+	for _, attr := range attributes {
+		values[attr.Name] = getFirstValue(attr.Name, attributes)
+	}
+	return getFirstValue("employeeNumber", attributes), values, nil
 }
 
 func getFirstValue(attrName string, attributes []types.Attribute) string {
@@ -0,0 +1,194 @@
+package scim
+
+// ServiceProviderConfig describes the SCIM features supported by this service provider
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	DocumentationURI      string                 `json:"documentationUri,omitempty"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	ETag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// ResourceType describes a type of resource available from the service provider
+type ResourceType struct {
+	Schemas          []string          `json:"schemas"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Endpoint         string            `json:"endpoint"`
+	Description      string            `json:"description"`
+	Schema           string            `json:"schema"`
+	SchemaExtensions []SchemaExtension `json:"schemaExtensions"`
+	Meta             Meta              `json:"meta"`
+}
+
+type SchemaExtension struct {
+	Schema   string `json:"schema"`
+	Required bool   `json:"required"`
+}
+
+// Schema describes the attributes of a resource or extension
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        Meta        `json:"meta"`
+}
+
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Description   string      `json:"description"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+// NewServiceProviderConfig returns the configuration of this service provider. The baseURL is the address of the
+// SCIM endpoints, e.g. https://example.com/scim/v2
+func NewServiceProviderConfig(baseURL string, maxResults int) ServiceProviderConfig {
+	return ServiceProviderConfig{
+		Schemas:        []string{SchemaServiceProviderConfig},
+		Patch:          Supported{Supported: true},
+		Bulk:           BulkSupport{},
+		Filter:         FilterSupport{Supported: true, MaxResults: maxResults},
+		ChangePassword: Supported{},
+		Sort:           Supported{},
+		ETag:           Supported{},
+		AuthenticationSchemes: []AuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer Token",
+			Description: "Authentication using a bearer token in the Authorization header",
+			Primary:     true,
+		}},
+		Meta: Meta{ResourceType: "ServiceProviderConfig", Location: baseURL + "/ServiceProviderConfig"},
+	}
+}
+
+// NewUserResourceType returns the ResourceType of User
+func NewUserResourceType(baseURL string) ResourceType {
+	return ResourceType{
+		Schemas:          []string{SchemaResourceType},
+		ID:               "User",
+		Name:             "User",
+		Endpoint:         "/Users",
+		Description:      "User Account",
+		Schema:           SchemaUser,
+		SchemaExtensions: []SchemaExtension{{Schema: SchemaEnterpriseUser, Required: true}},
+		Meta:             Meta{ResourceType: "ResourceType", Location: baseURL + "/ResourceTypes/User"},
+	}
+}
+
+// NewSchemas returns the schemas of User and its enterprise extension, listing only the supported attributes
+func NewSchemas(baseURL string) []Schema {
+	return []Schema{
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          SchemaUser,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []Attribute{
+				stringAttribute("userName", "Unique identifier for the user, used to sign in", true, "server"),
+				{
+					Name:        "name",
+					Type:        "complex",
+					Description: "The components of the user's name",
+					Mutability:  "readWrite",
+					Returned:    "default",
+					Uniqueness:  "none",
+					SubAttributes: []Attribute{
+						stringAttribute("formatted", "The full name", false, "none"),
+						stringAttribute("givenName", "The given name, or first name", false, "none"),
+						stringAttribute("familyName", "The family name, or last name", false, "none"),
+					},
+				},
+				stringAttribute("displayName", "The name of the user, suitable for display", false, "none"),
+				{
+					Name:        "emails",
+					Type:        "complex",
+					MultiValued: true,
+					Description: "Email addresses for the user. Only the primary address is stored.",
+					Required:    true,
+					Mutability:  "readWrite",
+					Returned:    "default",
+					Uniqueness:  "none",
+					SubAttributes: []Attribute{
+						stringAttribute("value", "Email address", true, "none"),
+						stringAttribute("type", "A label indicating the email's function, e.g. 'work'", false, "none"),
+						{
+							Name:        "primary",
+							Type:        "boolean",
+							Description: "Indicates the primary email address",
+							Mutability:  "readWrite",
+							Returned:    "default",
+							Uniqueness:  "none",
+						},
+					},
+				},
+				{
+					Name:        "active",
+					Type:        "boolean",
+					Description: "The user's administrative status. Deleting a user sets this to false.",
+					Mutability:  "readWrite",
+					Returned:    "default",
+					Uniqueness:  "none",
+				},
+			},
+			Meta: Meta{ResourceType: "Schema", Location: baseURL + "/Schemas/" + SchemaUser},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          SchemaEnterpriseUser,
+			Name:        "EnterpriseUser",
+			Description: "Enterprise User",
+			Attributes: []Attribute{
+				stringAttribute("employeeNumber", "Unique identifier assigned by the organization", true, "server"),
+			},
+			Meta: Meta{ResourceType: "Schema", Location: baseURL + "/Schemas/" + SchemaEnterpriseUser},
+		},
+	}
+}
+
+func stringAttribute(name, description string, required bool, uniqueness string) Attribute {
+	return Attribute{
+		Name:        name,
+		Type:        "string",
+		Description: description,
+		Required:    required,
+		Mutability:  "readWrite",
+		Returned:    "default",
+		Uniqueness:  uniqueness,
+	}
+}
@@ -0,0 +1,74 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Attributes supported in a Filter
+const (
+	FilterAttributeID             = "id"
+	FilterAttributeUserName       = "userName"
+	FilterAttributeEmail          = "emails.value"
+	FilterAttributeEmployeeNumber = "employeeNumber"
+)
+
+// ErrInvalidFilter is returned for a filter that cannot be parsed or is not supported
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a parsed SCIM filter expression. Only a single equality comparison on one of the FilterAttribute*
+// attributes is supported, which covers the lookups made by identity providers before provisioning a user, for
+// example `userName eq "john_doe"`.
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+var (
+	filterExpression = regexp.MustCompile(`^((?:[^\s\[]+|\[[^\]]*\])+)\s+(\S+)\s+(.+)$`)
+	emailValuePath   = regexp.MustCompile(`^emails(\[type eq "\w+"\])?\.value$`)
+)
+
+// ParseFilter parses a filter expression. The attribute names are case-insensitive, as required by RFC 7644.
+func ParseFilter(s string) (Filter, error) {
+	m := filterExpression.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Filter{}, fmt.Errorf("%w: %q is not a comparison", ErrInvalidFilter, s)
+	}
+
+	if !strings.EqualFold(m[2], "eq") {
+		return Filter{}, fmt.Errorf("%w: operator %q is not supported", ErrInvalidFilter, m[2])
+	}
+
+	var value string
+	if err := json.Unmarshal([]byte(m[3]), &value); err != nil {
+		return Filter{}, fmt.Errorf("%w: value %s is not a string", ErrInvalidFilter, m[3])
+	}
+
+	attribute := normalizeAttribute(m[1])
+	switch {
+	case attribute == "id":
+		return Filter{Attribute: FilterAttributeID, Value: value}, nil
+	case attribute == "username":
+		return Filter{Attribute: FilterAttributeUserName, Value: value}, nil
+	case attribute == "emails" || emailValuePath.MatchString(attribute):
+		return Filter{Attribute: FilterAttributeEmail, Value: value}, nil
+	case attribute == enterpriseAttributePrefix+"employeenumber" || attribute == "employeenumber":
+		return Filter{Attribute: FilterAttributeEmployeeNumber, Value: value}, nil
+	}
+	return Filter{}, fmt.Errorf("%w: attribute %q is not supported", ErrInvalidFilter, m[1])
+}
+
+const (
+	userAttributePrefix       = "urn:ietf:params:scim:schemas:core:2.0:user:"
+	enterpriseAttributePrefix = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:"
+)
+
+// normalizeAttribute lowercases an attribute path and removes the optional core User schema prefix
+func normalizeAttribute(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	return strings.TrimPrefix(path, userAttributePrefix)
+}
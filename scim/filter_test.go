@@ -0,0 +1,78 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    Filter
+		wantErr bool
+	}{
+		{
+			name:   "userName",
+			filter: `userName eq "john_doe"`,
+			want:   Filter{Attribute: FilterAttributeUserName, Value: "john_doe"},
+		},
+		{
+			name:   "case-insensitive attribute and operator",
+			filter: `USERNAME EQ "john_doe"`,
+			want:   Filter{Attribute: FilterAttributeUserName, Value: "john_doe"},
+		},
+		{
+			name:   "schema prefix",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "john_doe"`,
+			want:   Filter{Attribute: FilterAttributeUserName, Value: "john_doe"},
+		},
+		{
+			name:   "typed email",
+			filter: `emails[type eq "work"].value eq "john@example.com"`,
+			want:   Filter{Attribute: FilterAttributeEmail, Value: "john@example.com"},
+		},
+		{
+			name:   "employee number",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "10001"`,
+			want:   Filter{Attribute: FilterAttributeEmployeeNumber, Value: "10001"},
+		},
+		{
+			name:   "escaped quote",
+			filter: `userName eq "john \"jd\" doe"`,
+			want:   Filter{Attribute: FilterAttributeUserName, Value: `john "jd" doe`},
+		},
+		{
+			name:    "unsupported operator",
+			filter:  `userName co "john"`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported attribute",
+			filter:  `title eq "boss"`,
+			wantErr: true,
+		},
+		{
+			name:    "unquoted value",
+			filter:  `userName eq john`,
+			wantErr: true,
+		},
+		{
+			name:    "logical expression",
+			filter:  `userName eq "john" and active eq true`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidFilter)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPatch is returned for a PATCH operation that cannot be applied
+var ErrInvalidPatch = errors.New("invalid patch operation")
+
+// PatchRequest is the body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is one change in a PatchRequest
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply makes the changes described by the request's operations to the user, in order. Attributes that are not part
+// of User are ignored, since identity providers commonly send more attributes than a service provider supports.
+func (p PatchRequest) Apply(u *User) error {
+	for _, op := range p.Operations {
+		if err := u.applyOperation(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *User) applyOperation(op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if op.Path != "" {
+			return u.setAttribute(op.Path, op.Value)
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return fmt.Errorf("%w: value must be an object if there is no path", ErrInvalidPatch)
+		}
+		for path, value := range values {
+			if err := u.setAttribute(path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "remove":
+		if op.Path == "" {
+			return fmt.Errorf("%w: path is required for remove", ErrInvalidPatch)
+		}
+		return u.setAttribute(op.Path, nil)
+	}
+	return fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+}
+
+var typedEmailValuePath = regexp.MustCompile(`^emails\[type eq "(\w+)"\]\.value$`)
+
+// setAttribute sets the attribute at path to value. A nil value removes the attribute.
+func (u *User) setAttribute(path string, value json.RawMessage) error {
+	attribute := normalizeAttribute(path)
+	var err error
+
+	switch attribute {
+	case "username":
+		u.UserName, err = decodeString(value)
+	case "displayname":
+		u.DisplayName, err = decodeString(value)
+	case "externalid":
+		u.ExternalID, err = decodeString(value)
+	case "active":
+		u.Active, err = decodeBool(value)
+	case "name":
+		u.Name = nil
+		if value != nil {
+			err = json.Unmarshal(value, &u.Name)
+		}
+	case "name.givenname":
+		u.ensureName()
+		u.Name.GivenName, err = decodeString(value)
+	case "name.familyname":
+		u.ensureName()
+		u.Name.FamilyName, err = decodeString(value)
+	case "name.formatted":
+		u.ensureName()
+		u.Name.Formatted, err = decodeString(value)
+	case "emails":
+		u.Emails = nil
+		if value != nil {
+			err = json.Unmarshal(value, &u.Emails)
+		}
+	case "emails.value":
+		var email string
+		if email, err = decodeString(value); err == nil {
+			u.setEmail("", email)
+		}
+	case strings.TrimSuffix(enterpriseAttributePrefix, ":"):
+		u.Enterprise = nil
+		if value != nil {
+			err = json.Unmarshal(value, &u.Enterprise)
+		}
+	case enterpriseAttributePrefix + "employeenumber":
+		if u.Enterprise == nil {
+			u.Enterprise = &EnterpriseUser{}
+		}
+		u.Enterprise.EmployeeNumber, err = decodeString(value)
+	default:
+		m := typedEmailValuePath.FindStringSubmatch(attribute)
+		if m == nil {
+			return nil
+		}
+		var email string
+		if email, err = decodeString(value); err == nil {
+			u.setEmail(m[1], email)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid value for %q: %w", ErrInvalidPatch, path, err)
+	}
+	return nil
+}
+
+func (u *User) ensureName() {
+	if u.Name == nil {
+		u.Name = &Name{}
+	}
+}
+
+// setEmail sets the address of the email with the given type, or of the primary email if emailType is empty. If there
+// is no such email, one is added.
+func (u *User) setEmail(emailType, address string) {
+	for i, e := range u.Emails {
+		if (emailType == "" && e.Primary) || (emailType != "" && strings.EqualFold(e.Type, emailType)) {
+			u.Emails[i].Value = address
+			return
+		}
+	}
+	if emailType == "" {
+		emailType = "work"
+	}
+	u.Emails = append(u.Emails, Email{Value: address, Type: emailType, Primary: len(u.Emails) == 0})
+}
+
+func decodeString(value json.RawMessage) (string, error) {
+	var s string
+	if value == nil {
+		return s, nil
+	}
+	err := json.Unmarshal(value, &s)
+	return s, err
+}
+
+// decodeBool decodes a JSON boolean. Some identity providers send booleans as strings, such as "True", so those are
+// accepted as well.
+func decodeBool(value json.RawMessage) (*bool, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return &b, nil
+	}
+	s, err := decodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	b, err = strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,96 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchRequest_Apply(t *testing.T) {
+	newUser := func() User {
+		active := true
+		return User{
+			UserName:   "john_doe",
+			Name:       &Name{GivenName: "John", FamilyName: "Doe"},
+			Emails:     []Email{{Value: "john@example.com", Type: "work", Primary: true}},
+			Active:     &active,
+			Enterprise: &EnterpriseUser{EmployeeNumber: "10001"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		check   func(*testing.T, User)
+		wantErr bool
+	}{
+		{
+			name:  "replace active with string value",
+			patch: `{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			check: func(t *testing.T, u User) { require.False(t, u.IsActive()) },
+		},
+		{
+			name:  "replace without path",
+			patch: `{"Operations":[{"op":"replace","value":{"active":false,"displayName":"JD"}}]}`,
+			check: func(t *testing.T, u User) {
+				require.False(t, u.IsActive())
+				require.Equal(t, "JD", u.DisplayName)
+			},
+		},
+		{
+			name:  "replace typed email",
+			patch: `{"Operations":[{"op":"replace","path":"emails[type eq \"work\"].value","value":"jd@example.com"}]}`,
+			check: func(t *testing.T, u User) { require.Equal(t, "jd@example.com", u.PrimaryEmail()) },
+		},
+		{
+			name:  "replace name component",
+			patch: `{"Operations":[{"op":"replace","path":"name.familyName","value":"Smith"}]}`,
+			check: func(t *testing.T, u User) {
+				require.Equal(t, "John", u.GivenName())
+				require.Equal(t, "Smith", u.FamilyName())
+			},
+		},
+		{
+			name: "replace employee number",
+			patch: `{"Operations":[{"op":"add",` +
+				`"path":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber","value":"20002"}]}`,
+			check: func(t *testing.T, u User) { require.Equal(t, "20002", u.EmployeeNumber()) },
+		},
+		{
+			name:  "remove display name",
+			patch: `{"Operations":[{"op":"replace","path":"displayName","value":"JD"},{"op":"remove","path":"displayName"}]}`,
+			check: func(t *testing.T, u User) { require.Equal(t, "", u.DisplayName) },
+		},
+		{
+			name:  "unsupported attribute is ignored",
+			patch: `{"Operations":[{"op":"replace","path":"title","value":"Boss"}]}`,
+			check: func(t *testing.T, u User) { require.Equal(t, newUser(), u) },
+		},
+		{
+			name:    "unknown op",
+			patch:   `{"Operations":[{"op":"move","path":"userName","value":"x"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "wrong value type",
+			patch:   `{"Operations":[{"op":"replace","path":"userName","value":5}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p PatchRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.patch), &p))
+
+			u := newUser()
+			err := p.Apply(&u)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidPatch)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, u)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package scim
+
+import "strings"
+
+// User is the SCIM User resource, with the enterprise extension for the employee number
+type User struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *Name           `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []Email         `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Enterprise  *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+// Name holds the components of a user's name
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is one of a user's email addresses
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// EnterpriseUser holds the attributes of the enterprise User extension
+type EnterpriseUser struct {
+	EmployeeNumber string `json:"employeeNumber,omitempty"`
+}
+
+// PrimaryEmail returns the address of the email marked as primary, or else the first work email, or else the first
+// email. If the user has no email, it returns an empty string.
+func (u User) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	for _, e := range u.Emails {
+		if strings.EqualFold(e.Type, "work") {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// GivenName returns the user's given name, or an empty string if there is none
+func (u User) GivenName() string {
+	if u.Name == nil {
+		return ""
+	}
+	return u.Name.GivenName
+}
+
+// FamilyName returns the user's family name, or an empty string if there is none
+func (u User) FamilyName() string {
+	if u.Name == nil {
+		return ""
+	}
+	return u.Name.FamilyName
+}
+
+// EmployeeNumber returns the employee number from the enterprise extension, or an empty string if there is none
+func (u User) EmployeeNumber() string {
+	if u.Enterprise == nil {
+		return ""
+	}
+	return u.Enterprise.EmployeeNumber
+}
+
+// IsActive returns the active attribute, which is true if not provided
+func (u User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}